@@ -1,13 +1,27 @@
 module github.com/imgabe/todo
 
-go 1.16
+go 1.19
 
 require (
 	github.com/go-chi/chi v1.5.4
-	github.com/go-chi/chi/v5 v5.0.2 // indirect
-	github.com/go-chi/render v1.0.1 // indirect
-	github.com/google/go-cmp v0.5.5 // indirect
-	github.com/jmoiron/sqlx v1.3.3 // indirect
-	github.com/mattn/go-sqlite3 v1.14.6 // indirect
-	github.com/urfave/cli/v2 v2.3.0 // indirect
+	github.com/go-chi/chi/v5 v5.0.2
+	github.com/go-chi/render v1.0.1
+	github.com/gorilla/websocket v1.5.3
+	github.com/graph-gophers/graphql-go v1.5.0
+	github.com/jmoiron/sqlx v1.3.3
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/urfave/cli/v2 v2.3.0
+	golang.org/x/crypto v0.21.0
+	google.golang.org/grpc v1.63.2
+	google.golang.org/protobuf v1.34.1
+)
+
+require (
+	github.com/cpuguy83/go-md2man/v2 v2.0.0-20190314233015-f79a8a8ca69d // indirect
+	github.com/russross/blackfriday/v2 v2.0.1 // indirect
+	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
 )
@@ -0,0 +1,216 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/imgabe/todo/pkg/api/rpc/todopb"
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/api/web/limit"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/logging"
+	"github.com/imgabe/todo/pkg/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// scopes are the scopes the token of a call must grant, by method
+var scopes = map[string]models.Scope{
+	todopb.TodoService_CreateTask_FullMethodName: models.ScopeWrite,
+	todopb.TodoService_GetTask_FullMethodName:    models.ScopeRead,
+	todopb.TodoService_ListTasks_FullMethodName:  models.ScopeRead,
+	todopb.TodoService_UpdateTask_FullMethodName: models.ScopeWrite,
+	todopb.TodoService_DeleteTask_FullMethodName: models.ScopeWrite,
+	todopb.TodoService_WatchTasks_FullMethodName: models.ScopeRead,
+}
+
+// statusCodes maps the statuses of problem documents to gRPC status codes
+var statusCodes = map[int]codes.Code{
+	400: codes.InvalidArgument,
+	401: codes.Unauthenticated,
+	403: codes.PermissionDenied,
+	404: codes.NotFound,
+	409: codes.AlreadyExists,
+	412: codes.FailedPrecondition,
+	413: codes.ResourceExhausted,
+	422: codes.InvalidArgument,
+	428: codes.FailedPrecondition,
+	429: codes.ResourceExhausted,
+	503: codes.Unavailable,
+}
+
+// toStatus maps the errors returned by the stores to gRPC statuses like
+// 'errors.FromError' maps them to problem documents. Unexpected errors are
+// logged and reported without details.
+func toStatus(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	problem := errors.FromError(err)
+	if problem == errors.ErrInternal && err != errors.ErrInternal {
+		logging.FromContext(ctx).Error("internal error", "error", err)
+	}
+
+	code, ok := statusCodes[problem.HTTPStatusCode]
+	if !ok {
+		code = codes.Internal
+	}
+
+	return status.Error(code, problem.Error())
+}
+
+// authenticate reads the bearer token of the call's metadata and returns
+// the context of the call carrying it, once it is known to grant the scope
+// of 'method'
+func authenticate(ctx context.Context, tokens auth.TokenStore, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var raw string
+	if values := md.Get("authorization"); len(values) > 0 {
+		if header := values[0]; len(header) >= 7 && strings.EqualFold(header[:7], "Bearer ") {
+			raw = strings.TrimSpace(header[7:])
+		}
+	}
+	if raw == "" {
+		return ctx, errors.ErrUnauthorized
+	}
+
+	token, err := tokens.SelectByToken(raw)
+	if err != nil || token.Expired(time.Now()) {
+		return ctx, errors.ErrUnauthorized
+	}
+
+	// methods without a known scope are kept to administrators
+	scope, ok := scopes[method]
+	if !ok {
+		scope = models.ScopeAdmin
+	}
+	if !token.HasScope(scope) {
+		return ctx, errors.ErrForbidden
+	}
+
+	return context.WithValue(ctx, auth.TokenContextKey, token), nil
+}
+
+// admit authenticates a call, limiting callers by token like the REST API.
+// Failed authentications are charged to the address of the caller, which
+// is refused before its token is looked up once it ran out.
+func admit(ctx context.Context, tokens auth.TokenStore, limiter *limit.Limiter, method string) (context.Context, error) {
+	if limiter == nil {
+		return authenticate(ctx, tokens, method)
+	}
+
+	addr := limit.AddrKey("")
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = limit.AddrKey(p.Addr.String())
+	}
+	if allowed, _ := limiter.Peek(addr); !allowed {
+		return ctx, errors.ErrTooManyRequests
+	}
+
+	ctx, err := authenticate(ctx, tokens, method)
+	if err == errors.ErrUnauthorized {
+		limiter.Allow(addr)
+	}
+	if err != nil {
+		return ctx, err
+	}
+
+	token := ctx.Value(auth.TokenContextKey).(models.Token)
+	if allowed, _, _ := limiter.Allow(limit.TokenKey(token.ID)); !allowed {
+		return ctx, errors.ErrTooManyRequests
+	}
+
+	return ctx, nil
+}
+
+func authenticateUnary(tokens auth.TokenStore, limiter *limit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := admit(ctx, tokens, limiter, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func authenticateStream(tokens auth.TokenStore, limiter *limit.Limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := admit(ss.Context(), tokens, limiter, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream replaces the context of a stream
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// logger returns the default logger tagged with the method and the
+// address of the caller
+func logger(ctx context.Context, method string) *logging.Logger {
+	l := logging.Default().With("method", method)
+	if p, ok := peer.FromContext(ctx); ok {
+		l = l.With("remote", p.Addr.String())
+	}
+
+	return l
+}
+
+// served logs a call once it ends, at error level when the server failed
+func served(l *logging.Logger, err error, start time.Time) {
+	code := status.Code(err)
+
+	level := logging.LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		level = logging.LevelError
+	}
+
+	l.Log(level, "call served", "code", code.String(), "duration", time.Since(start))
+}
+
+// logUnary puts a logger tagged with the method in the context of unary
+// calls, maps their errors to statuses and logs them once served
+func logUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	l := logger(ctx, info.FullMethod)
+	ctx = logging.NewContext(ctx, l)
+
+	res, err := handler(ctx, req)
+	err = toStatus(ctx, err)
+	served(l, err, start)
+
+	return res, err
+}
+
+// logStream is the equivalent of logUnary for streaming calls
+func logStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	l := logger(ss.Context(), info.FullMethod)
+	ctx := logging.NewContext(ss.Context(), l)
+
+	err := handler(srv, serverStream{ServerStream: ss, ctx: ctx})
+	err = toStatus(ctx, err)
+	served(l, err, start)
+
+	return err
+}
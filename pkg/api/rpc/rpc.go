@@ -0,0 +1,214 @@
+package rpc
+
+//go:generate protoc --go_out=todopb --go_opt=paths=source_relative --go-grpc_out=todopb --go-grpc_opt=paths=source_relative todo.proto
+
+import (
+	"context"
+	"sort"
+
+	"github.com/imgabe/todo/pkg/api/rpc/todopb"
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/api/web/limit"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/models"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Stores holds the stores calls are served from
+type Stores struct {
+	Tasks  controllers.TaskStoreFor
+	Tokens auth.TokenStore
+	Users  controllers.UserStore
+	Events controllers.Subscriber
+}
+
+// NewServer returns a gRPC server offering the TodoService, authenticating
+// calls with the tokens of the REST API. Calls are rate limited by
+// 'limiter' like requests to the REST API, unless it is nil. 'opts' are
+// passed on to the server, such as its transport credentials.
+func NewServer(stores Stores, limiter *limit.Limiter, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(logUnary, authenticateUnary(stores.Tokens, limiter)),
+		grpc.ChainStreamInterceptor(logStream, authenticateStream(stores.Tokens, limiter)),
+	)
+	server := grpc.NewServer(opts...)
+	todopb.RegisterTodoServiceServer(server, &Service{Stores: stores.Tasks, Users: stores.Users, Events: stores.Events})
+
+	return server
+}
+
+// Service implements the TodoService on top of the same stores as
+// 'controllers.TasksController', on behalf of the user of the token
+type Service struct {
+	todopb.UnimplementedTodoServiceServer
+
+	Stores controllers.TaskStoreFor
+	Users  controllers.UserStore
+	Events controllers.Subscriber
+}
+
+// store returns the task store of the user making the call
+func (s *Service) store(ctx context.Context) controllers.TaskStore {
+	return s.Stores(ctx, auth.OwnerID(ctx))
+}
+
+// toTask converts a task to its protobuf message
+func toTask(task models.Task) *todopb.Task {
+	return &todopb.Task{
+		Id:          task.ID,
+		Description: task.Description,
+		Done:        task.Done,
+		OwnerId:     task.OwnerID,
+		AssigneeId:  task.AssigneeID,
+		Version:     task.Version,
+	}
+}
+
+// eventTypes maps the types of task events to their protobuf enum
+var eventTypes = map[events.Type]todopb.TaskEvent_Type{
+	events.TaskCreated: todopb.TaskEvent_TYPE_CREATED,
+	events.TaskUpdated: todopb.TaskEvent_TYPE_UPDATED,
+	events.TaskChecked: todopb.TaskEvent_TYPE_CHECKED,
+	events.TaskDeleted: todopb.TaskEvent_TYPE_DELETED,
+}
+
+func (s *Service) CreateTask(ctx context.Context, req *todopb.CreateTaskRequest) (*todopb.Task, error) {
+	task := models.Task{Description: req.GetDescription()}
+	if err := task.Bind(nil); err != nil {
+		return nil, errors.ErrInvalidRequest(err)
+	}
+
+	task, err := s.store(ctx).Insert(task)
+	if err != nil {
+		return nil, err
+	}
+
+	return toTask(task), nil
+}
+
+func (s *Service) GetTask(ctx context.Context, req *todopb.GetTaskRequest) (*todopb.Task, error) {
+	task, err := s.store(ctx).Select(models.Task{ID: req.GetId()})
+	if err != nil {
+		return nil, err
+	}
+
+	return toTask(task), nil
+}
+
+// ListTasks reads the tasks like 'GET /tasks', then sends the ones
+// matching the request
+func (s *Service) ListTasks(req *todopb.ListTasksRequest, stream todopb.TodoService_ListTasksServer) error {
+	ts := s.store(stream.Context())
+
+	var tasks []models.Task
+	var err error
+	switch {
+	case req.GetAssignedToMe():
+		tasks, err = ts.SelectAssigned(true, models.Page{})
+	case req.GetOwner() != "":
+		owner, ownerErr := s.Users.SelectByName(req.GetOwner())
+		if ownerErr != nil {
+			return ownerErr
+		}
+
+		tasks, err = ts.SelectShared(owner.ID, true, models.Page{})
+	default:
+		tasks, err = ts.SelectAll(true, models.Page{})
+	}
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+
+	for _, task := range tasks {
+		if req.Done != nil && task.Done != req.GetDone() {
+			continue
+		}
+
+		if err := stream.Send(toTask(task)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) UpdateTask(ctx context.Context, req *todopb.UpdateTaskRequest) (*todopb.Task, error) {
+	patch := models.TaskPatch{Description: req.Description, Done: req.Done}
+	if err := patch.Bind(nil); err != nil {
+		return nil, errors.ErrInvalidRequest(err)
+	}
+
+	ts := s.store(ctx)
+
+	task, err := ts.Select(models.Task{ID: req.GetId()})
+	if err != nil {
+		return nil, err
+	}
+	task.Version = req.GetVersion()
+
+	task, err = ts.Update(patch.Apply(task))
+	if err != nil {
+		return nil, err
+	}
+
+	return toTask(task), nil
+}
+
+func (s *Service) DeleteTask(ctx context.Context, req *todopb.DeleteTaskRequest) (*todopb.Task, error) {
+	ts := s.store(ctx)
+
+	task, err := ts.Select(models.Task{ID: req.GetId()})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ts.DeleteVersion(task.ID, req.GetVersion()); err != nil {
+		return nil, err
+	}
+
+	return toTask(task), nil
+}
+
+// WatchTasks sends the events of the tasks the user may read until the
+// client cancels the call or the server shuts down
+func (s *Service) WatchTasks(req *todopb.WatchTasksRequest, stream todopb.TodoService_WatchTasksServer) error {
+	ctx := stream.Context()
+	ts := s.store(ctx)
+
+	types := make(map[todopb.TaskEvent_Type]bool)
+	for _, t := range req.GetTypes() {
+		types[t] = true
+	}
+
+	ch, cancel := s.Events.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-ch:
+			if !ok {
+				return nil
+			}
+
+			typ := eventTypes[event.Type]
+			if len(types) > 0 && !types[typ] {
+				continue
+			}
+			if visible, err := ts.CanRead(event.Task); err != nil || !visible {
+				continue
+			}
+
+			msg := &todopb.TaskEvent{Type: typ, Task: toTask(event.Task), Time: timestamppb.New(event.Time)}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package rpc_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/imgabe/todo/pkg/api/rpc"
+	"github.com/imgabe/todo/pkg/api/rpc/todopb"
+	"github.com/imgabe/todo/pkg/api/web"
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/api/web/limit"
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/imgabe/todo/pkg/store/storetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// testClient serves the TodoService from a storetest.Fixture, and returns a
+// client along with the task store of alice and her tokens with every
+// scope and with only the read scope. Calls are rate limited by 'limiter',
+// unless it is nil.
+func testClient(t *testing.T, limiter *limit.Limiter) (todopb.TodoServiceClient, store.TaskStore, string, string) {
+	t.Helper()
+
+	f := storetest.New(t)
+	broker := events.NewBroker()
+	t.Cleanup(broker.Close)
+
+	ts := store.TaskStore{DB: f.DB, Events: broker}
+
+	server := rpc.NewServer(rpc.Stores{
+		Tasks:  func(ctx context.Context, ownerID int64) controllers.TaskStore { return ts.ForOwner(ownerID) },
+		Tokens: store.TokenStore{DB: f.DB},
+		Users:  store.UserStore{DB: f.DB},
+		Events: broker,
+	}, limiter)
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return todopb.NewTodoServiceClient(conn), ts.ForOwner(f.Alice.ID), f.Admin, f.Reader
+}
+
+// withToken returns a context sending 'token' as the bearer token of calls
+func withToken(token string) context.Context {
+	ctx := context.Background()
+	if token == "" {
+		return ctx
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+// list reads every task streamed by ListTasks
+func list(ctx context.Context, client todopb.TodoServiceClient, req *todopb.ListTasksRequest) ([]*todopb.Task, error) {
+	stream, err := client.ListTasks(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []*todopb.Task
+	for {
+		task, err := stream.Recv()
+		if err == io.EOF {
+			return tasks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, task)
+	}
+}
+
+func TestService(t *testing.T) {
+	client, _, admin, reader := testClient(t, nil)
+
+	tests := []struct {
+		name  string
+		token string
+		call  func(ctx context.Context) (interface{}, error)
+		want  codes.Code
+		task  *todopb.Task
+	}{
+		{
+			name:  "Create",
+			token: admin,
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.CreateTask(ctx, &todopb.CreateTaskRequest{Description: "Buy milk"})
+			},
+			want: codes.OK,
+			task: &todopb.Task{Id: 1, Description: "Buy milk", Version: 1},
+		},
+		{
+			name:  "Create another",
+			token: admin,
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.CreateTask(ctx, &todopb.CreateTaskRequest{Description: "Walk the dog"})
+			},
+			want: codes.OK,
+			task: &todopb.Task{Id: 2, Description: "Walk the dog", Version: 1},
+		},
+		{
+			name:  "Create without description",
+			token: admin,
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.CreateTask(ctx, &todopb.CreateTaskRequest{})
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name:  "Create with read scope",
+			token: reader,
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.CreateTask(ctx, &todopb.CreateTaskRequest{Description: "Nope"})
+			},
+			want: codes.PermissionDenied,
+		},
+		{
+			name:  "Create without token",
+			token: "",
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.CreateTask(ctx, &todopb.CreateTaskRequest{Description: "Nope"})
+			},
+			want: codes.Unauthenticated,
+		},
+		{
+			name:  "Create with unknown token",
+			token: "nope",
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.CreateTask(ctx, &todopb.CreateTaskRequest{Description: "Nope"})
+			},
+			want: codes.Unauthenticated,
+		},
+		{
+			name:  "Get",
+			token: reader,
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.GetTask(ctx, &todopb.GetTaskRequest{Id: 2})
+			},
+			want: codes.OK,
+			task: &todopb.Task{Id: 2, Description: "Walk the dog", Version: 1},
+		},
+		{
+			name:  "Get non-existent",
+			token: reader,
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.GetTask(ctx, &todopb.GetTaskRequest{Id: 99})
+			},
+			want: codes.NotFound,
+		},
+		{
+			name:  "Check",
+			token: admin,
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.UpdateTask(ctx, &todopb.UpdateTaskRequest{Id: 1, Version: 1, Done: proto.Bool(true)})
+			},
+			want: codes.OK,
+			task: &todopb.Task{Id: 1, Description: "Buy milk", Done: true, Version: 2},
+		},
+		{
+			name:  "Update stale version",
+			token: admin,
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.UpdateTask(ctx, &todopb.UpdateTaskRequest{Id: 1, Version: 1, Description: proto.String("Buy oat milk")})
+			},
+			want: codes.FailedPrecondition,
+		},
+		{
+			name:  "Update any version",
+			token: admin,
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.UpdateTask(ctx, &todopb.UpdateTaskRequest{Id: 1, Description: proto.String("Buy oat milk")})
+			},
+			want: codes.OK,
+			task: &todopb.Task{Id: 1, Description: "Buy oat milk", Done: true, Version: 3},
+		},
+		{
+			name:  "Update with empty description",
+			token: admin,
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.UpdateTask(ctx, &todopb.UpdateTaskRequest{Id: 1, Description: proto.String("")})
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name:  "List",
+			token: reader,
+			call: func(ctx context.Context) (interface{}, error) {
+				return list(ctx, client, &todopb.ListTasksRequest{})
+			},
+			want: codes.OK,
+		},
+		{
+			name:  "List unknown owner",
+			token: reader,
+			call: func(ctx context.Context) (interface{}, error) {
+				return list(ctx, client, &todopb.ListTasksRequest{Owner: "nobody"})
+			},
+			want: codes.NotFound,
+		},
+		{
+			name:  "Delete stale version",
+			token: admin,
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.DeleteTask(ctx, &todopb.DeleteTaskRequest{Id: 2, Version: 7})
+			},
+			want: codes.FailedPrecondition,
+		},
+		{
+			name:  "Delete",
+			token: admin,
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.DeleteTask(ctx, &todopb.DeleteTaskRequest{Id: 2, Version: 1})
+			},
+			want: codes.OK,
+			task: &todopb.Task{Id: 2, Description: "Walk the dog", Version: 1},
+		},
+		{
+			name:  "Delete again",
+			token: admin,
+			call: func(ctx context.Context) (interface{}, error) {
+				return client.DeleteTask(ctx, &todopb.DeleteTaskRequest{Id: 2, Version: 1})
+			},
+			want: codes.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.call(withToken(tt.token))
+			if code := status.Code(err); code != tt.want {
+				t.Fatalf("code = %s, want %s: %v", code, tt.want, err)
+			}
+			if tt.task == nil {
+				return
+			}
+
+			task := res.(*todopb.Task)
+			task.OwnerId = nil
+			if !proto.Equal(task, tt.task) {
+				t.Errorf("task = %v, want %v", task, tt.task)
+			}
+		})
+	}
+}
+
+func TestService_ListTasks(t *testing.T) {
+	client, ts, _, reader := testClient(t, nil)
+
+	for _, description := range []string{"Buy milk", "Walk the dog", "Buy bread"} {
+		if _, err := ts.Insert(models.Task{Description: description}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ts.Update(models.Task{ID: 2, Description: "Walk the dog", Done: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  *todopb.ListTasksRequest
+		want []int64
+	}{
+		{name: "All", req: &todopb.ListTasksRequest{}, want: []int64{1, 2, 3}},
+		{name: "Done", req: &todopb.ListTasksRequest{Done: proto.Bool(true)}, want: []int64{2}},
+		{name: "Open", req: &todopb.ListTasksRequest{Done: proto.Bool(false)}, want: []int64{1, 3}},
+		{name: "Assigned to me", req: &todopb.ListTasksRequest{AssignedToMe: true}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks, err := list(withToken(reader), client, tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []int64
+			for _, task := range tasks {
+				ids = append(ids, task.Id)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("ids = %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Fatalf("ids = %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestService_WatchTasks(t *testing.T) {
+	client, ts, _, reader := testClient(t, nil)
+
+	ctx, cancel := context.WithTimeout(withToken(reader), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchTasks(ctx, &todopb.WatchTasksRequest{Types: []todopb.TaskEvent_Type{todopb.TaskEvent_TYPE_CHECKED}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the subscription starts in the background, so tasks are added and
+	// checked until one of them is seen
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				task, err := ts.Insert(models.Task{Description: "Task"})
+				if err == nil {
+					ts.Check(task.ID)
+				}
+			}
+		}
+	}()
+
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != todopb.TaskEvent_TYPE_CHECKED || !event.Task.Done || event.Task.Description != "Task" || event.Time == nil {
+		t.Errorf("event = %v, want a checked task", event)
+	}
+}
+
+func TestService_RateLimit(t *testing.T) {
+	// there is no task, so calls let through are answered with NotFound
+	tests := []struct {
+		name   string
+		tokens []string
+		want   []codes.Code
+	}{
+		{
+			name:   "Token",
+			tokens: []string{"admin", "admin", "admin", "reader"},
+			want:   []codes.Code{codes.NotFound, codes.NotFound, codes.ResourceExhausted, codes.NotFound},
+		},
+		{
+			name:   "Failed authentications",
+			tokens: []string{"nope", "", "nope", "admin"},
+			want:   []codes.Code{codes.Unauthenticated, codes.Unauthenticated, codes.ResourceExhausted, codes.ResourceExhausted},
+		},
+		{
+			name:   "Authenticated calls are not charged to the address",
+			tokens: []string{"admin", "admin", "nope", "reader"},
+			want:   []codes.Code{codes.NotFound, codes.NotFound, codes.Unauthenticated, codes.NotFound},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _, admin, reader := testClient(t, limit.NewLimiter(0.001, 2))
+			tokens := map[string]string{"admin": admin, "reader": reader}
+
+			for i, name := range tt.tokens {
+				token, ok := tokens[name]
+				if !ok {
+					token = name
+				}
+
+				_, err := client.GetTask(withToken(token), &todopb.GetTaskRequest{Id: 1})
+				if got := status.Code(err); got != tt.want[i] {
+					t.Errorf("call %d with %q = %v, want %v", i+1, name, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNewServer_TLS(t *testing.T) {
+	cert, err := web.SelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	server := rpc.NewServer(rpc.Stores{Tokens: store.TokenStore{}}, nil,
+		grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}})))
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	tests := []struct {
+		name  string
+		creds credentials.TransportCredentials
+		want  codes.Code
+	}{
+		{name: "TLS", creds: credentials.NewTLS(&tls.Config{RootCAs: roots, ServerName: "localhost"}), want: codes.Unauthenticated},
+		{name: "Plaintext", creds: insecure.NewCredentials(), want: codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := grpc.Dial("bufnet",
+				grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+				grpc.WithTransportCredentials(tt.creds),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			// the call reaches authentication only over TLS
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err = todopb.NewTodoServiceClient(conn).GetTask(ctx, &todopb.GetTaskRequest{Id: 1})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("GetTask() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
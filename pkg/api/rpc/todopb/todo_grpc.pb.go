@@ -0,0 +1,373 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: todo.proto
+
+package todopb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	TodoService_CreateTask_FullMethodName = "/todo.v1.TodoService/CreateTask"
+	TodoService_GetTask_FullMethodName    = "/todo.v1.TodoService/GetTask"
+	TodoService_ListTasks_FullMethodName  = "/todo.v1.TodoService/ListTasks"
+	TodoService_UpdateTask_FullMethodName = "/todo.v1.TodoService/UpdateTask"
+	TodoService_DeleteTask_FullMethodName = "/todo.v1.TodoService/DeleteTask"
+	TodoService_WatchTasks_FullMethodName = "/todo.v1.TodoService/WatchTasks"
+)
+
+// TodoServiceClient is the client API for TodoService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TodoServiceClient interface {
+	// CreateTask adds a task. Requires the write scope.
+	CreateTask(ctx context.Context, in *CreateTaskRequest, opts ...grpc.CallOption) (*Task, error)
+	// GetTask reads a single task. Requires the read scope.
+	GetTask(ctx context.Context, in *GetTaskRequest, opts ...grpc.CallOption) (*Task, error)
+	// ListTasks streams the tasks matching the request, ordered by ID.
+	// Requires the read scope.
+	ListTasks(ctx context.Context, in *ListTasksRequest, opts ...grpc.CallOption) (TodoService_ListTasksClient, error)
+	// UpdateTask changes the fields set on the request of a task still at
+	// 'version', failing with FAILED_PRECONDITION otherwise, whatever its
+	// version when 'version' is zero. Requires the write scope.
+	UpdateTask(ctx context.Context, in *UpdateTaskRequest, opts ...grpc.CallOption) (*Task, error)
+	// DeleteTask deletes a task still at 'version' and returns it. Requires
+	// the write scope.
+	DeleteTask(ctx context.Context, in *DeleteTaskRequest, opts ...grpc.CallOption) (*Task, error)
+	// WatchTasks streams the changes made to the tasks the user can read
+	// until the client cancels the call or the server shuts down. Requires
+	// the read scope.
+	WatchTasks(ctx context.Context, in *WatchTasksRequest, opts ...grpc.CallOption) (TodoService_WatchTasksClient, error)
+}
+
+type todoServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTodoServiceClient(cc grpc.ClientConnInterface) TodoServiceClient {
+	return &todoServiceClient{cc}
+}
+
+func (c *todoServiceClient) CreateTask(ctx context.Context, in *CreateTaskRequest, opts ...grpc.CallOption) (*Task, error) {
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TodoService_CreateTask_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoServiceClient) GetTask(ctx context.Context, in *GetTaskRequest, opts ...grpc.CallOption) (*Task, error) {
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TodoService_GetTask_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoServiceClient) ListTasks(ctx context.Context, in *ListTasksRequest, opts ...grpc.CallOption) (TodoService_ListTasksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &TodoService_ServiceDesc.Streams[0], TodoService_ListTasks_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &todoServiceListTasksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type TodoService_ListTasksClient interface {
+	Recv() (*Task, error)
+	grpc.ClientStream
+}
+
+type todoServiceListTasksClient struct {
+	grpc.ClientStream
+}
+
+func (x *todoServiceListTasksClient) Recv() (*Task, error) {
+	m := new(Task)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *todoServiceClient) UpdateTask(ctx context.Context, in *UpdateTaskRequest, opts ...grpc.CallOption) (*Task, error) {
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TodoService_UpdateTask_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoServiceClient) DeleteTask(ctx context.Context, in *DeleteTaskRequest, opts ...grpc.CallOption) (*Task, error) {
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TodoService_DeleteTask_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoServiceClient) WatchTasks(ctx context.Context, in *WatchTasksRequest, opts ...grpc.CallOption) (TodoService_WatchTasksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &TodoService_ServiceDesc.Streams[1], TodoService_WatchTasks_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &todoServiceWatchTasksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type TodoService_WatchTasksClient interface {
+	Recv() (*TaskEvent, error)
+	grpc.ClientStream
+}
+
+type todoServiceWatchTasksClient struct {
+	grpc.ClientStream
+}
+
+func (x *todoServiceWatchTasksClient) Recv() (*TaskEvent, error) {
+	m := new(TaskEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TodoServiceServer is the server API for TodoService service.
+// All implementations must embed UnimplementedTodoServiceServer
+// for forward compatibility
+type TodoServiceServer interface {
+	// CreateTask adds a task. Requires the write scope.
+	CreateTask(context.Context, *CreateTaskRequest) (*Task, error)
+	// GetTask reads a single task. Requires the read scope.
+	GetTask(context.Context, *GetTaskRequest) (*Task, error)
+	// ListTasks streams the tasks matching the request, ordered by ID.
+	// Requires the read scope.
+	ListTasks(*ListTasksRequest, TodoService_ListTasksServer) error
+	// UpdateTask changes the fields set on the request of a task still at
+	// 'version', failing with FAILED_PRECONDITION otherwise, whatever its
+	// version when 'version' is zero. Requires the write scope.
+	UpdateTask(context.Context, *UpdateTaskRequest) (*Task, error)
+	// DeleteTask deletes a task still at 'version' and returns it. Requires
+	// the write scope.
+	DeleteTask(context.Context, *DeleteTaskRequest) (*Task, error)
+	// WatchTasks streams the changes made to the tasks the user can read
+	// until the client cancels the call or the server shuts down. Requires
+	// the read scope.
+	WatchTasks(*WatchTasksRequest, TodoService_WatchTasksServer) error
+	mustEmbedUnimplementedTodoServiceServer()
+}
+
+// UnimplementedTodoServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedTodoServiceServer struct {
+}
+
+func (UnimplementedTodoServiceServer) CreateTask(context.Context, *CreateTaskRequest) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTask not implemented")
+}
+func (UnimplementedTodoServiceServer) GetTask(context.Context, *GetTaskRequest) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTask not implemented")
+}
+func (UnimplementedTodoServiceServer) ListTasks(*ListTasksRequest, TodoService_ListTasksServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListTasks not implemented")
+}
+func (UnimplementedTodoServiceServer) UpdateTask(context.Context, *UpdateTaskRequest) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateTask not implemented")
+}
+func (UnimplementedTodoServiceServer) DeleteTask(context.Context, *DeleteTaskRequest) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteTask not implemented")
+}
+func (UnimplementedTodoServiceServer) WatchTasks(*WatchTasksRequest, TodoService_WatchTasksServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchTasks not implemented")
+}
+func (UnimplementedTodoServiceServer) mustEmbedUnimplementedTodoServiceServer() {}
+
+// UnsafeTodoServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TodoServiceServer will
+// result in compilation errors.
+type UnsafeTodoServiceServer interface {
+	mustEmbedUnimplementedTodoServiceServer()
+}
+
+func RegisterTodoServiceServer(s grpc.ServiceRegistrar, srv TodoServiceServer) {
+	s.RegisterService(&TodoService_ServiceDesc, srv)
+}
+
+func _TodoService_CreateTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServiceServer).CreateTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TodoService_CreateTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServiceServer).CreateTask(ctx, req.(*CreateTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TodoService_GetTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServiceServer).GetTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TodoService_GetTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServiceServer).GetTask(ctx, req.(*GetTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TodoService_ListTasks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListTasksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TodoServiceServer).ListTasks(m, &todoServiceListTasksServer{stream})
+}
+
+type TodoService_ListTasksServer interface {
+	Send(*Task) error
+	grpc.ServerStream
+}
+
+type todoServiceListTasksServer struct {
+	grpc.ServerStream
+}
+
+func (x *todoServiceListTasksServer) Send(m *Task) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _TodoService_UpdateTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServiceServer).UpdateTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TodoService_UpdateTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServiceServer).UpdateTask(ctx, req.(*UpdateTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TodoService_DeleteTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServiceServer).DeleteTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TodoService_DeleteTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServiceServer).DeleteTask(ctx, req.(*DeleteTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TodoService_WatchTasks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchTasksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TodoServiceServer).WatchTasks(m, &todoServiceWatchTasksServer{stream})
+}
+
+type TodoService_WatchTasksServer interface {
+	Send(*TaskEvent) error
+	grpc.ServerStream
+}
+
+type todoServiceWatchTasksServer struct {
+	grpc.ServerStream
+}
+
+func (x *todoServiceWatchTasksServer) Send(m *TaskEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// TodoService_ServiceDesc is the grpc.ServiceDesc for TodoService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TodoService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "todo.v1.TodoService",
+	HandlerType: (*TodoServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateTask",
+			Handler:    _TodoService_CreateTask_Handler,
+		},
+		{
+			MethodName: "GetTask",
+			Handler:    _TodoService_GetTask_Handler,
+		},
+		{
+			MethodName: "UpdateTask",
+			Handler:    _TodoService_UpdateTask_Handler,
+		},
+		{
+			MethodName: "DeleteTask",
+			Handler:    _TodoService_DeleteTask_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListTasks",
+			Handler:       _TodoService_ListTasks_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchTasks",
+			Handler:       _TodoService_WatchTasks_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "todo.proto",
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// ContextKey is used as a key type on 'context.Context'
+type ContextKey string
+
+// TokenContextKey is the context key used to store the authenticated token
+var TokenContextKey ContextKey = "token"
+
+// TokenStore is the set of store operations authentication relies on,
+// satisfied by 'store.TokenStore'
+type TokenStore interface {
+	SelectByToken(raw string) (models.Token, error)
+}
+
+// Authenticate rejects requests without a valid 'Authorization: Bearer'
+// token and stores the token on the request context
+func Authenticate(ts TokenStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := bearer(r)
+			if raw == "" {
+				unauthorized(w, r)
+				return
+			}
+
+			token, err := Check(ts, raw)
+			if err != nil {
+				unauthorized(w, r)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), TokenContextKey, token)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// AuthenticateOptional is like Authenticate, but lets requests without an
+// 'Authorization' header through unauthenticated, for the handlers reading
+// the token from a WebSocket, since browsers cannot set headers on those
+func AuthenticateOptional(ts TokenStore) func(http.Handler) http.Handler {
+	authenticate := Authenticate(ts)
+
+	return func(next http.Handler) http.Handler {
+		authenticated := authenticate(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			authenticated.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Check returns the token matching the raw token 'raw', failing with
+// ErrUnauthorized when there is none or it expired
+func Check(ts TokenStore, raw string) (models.Token, error) {
+	if raw == "" {
+		return models.Token{}, errors.ErrUnauthorized
+	}
+
+	token, err := ts.SelectByToken(raw)
+	if err != nil || token.Expired(time.Now()) {
+		return models.Token{}, errors.ErrUnauthorized
+	}
+
+	return token, nil
+}
+
+// RequireScope rejects requests whose token does not grant 'scope'
+func RequireScope(scope models.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := r.Context().Value(TokenContextKey).(models.Token)
+			if !ok {
+				unauthorized(w, r)
+				return
+			}
+
+			if !token.HasScope(scope) {
+				errors.Render(w, r, errors.ErrForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// OwnerID returns the user owning the tasks reachable by the authenticated
+// token, zero for tokens not tied to a user
+func OwnerID(ctx context.Context) int64 {
+	token, ok := ctx.Value(TokenContextKey).(models.Token)
+	if !ok || token.UserID == nil {
+		return 0
+	}
+
+	return *token.UserID
+}
+
+func bearer(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(header[7:])
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="todo"`)
+	errors.Render(w, r, errors.ErrUnauthorized)
+}
@@ -0,0 +1,101 @@
+package auth_test
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+type fakeTokenStore map[string]models.Token
+
+func (f fakeTokenStore) SelectByToken(raw string) (models.Token, error) {
+	token, ok := f[raw]
+	if !ok {
+		return token, sql.ErrNoRows
+	}
+
+	return token, nil
+}
+
+func TestRequireScope(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+	tokens := fakeTokenStore{
+		"reader":  {ID: 1, Scopes: "read"},
+		"writer":  {ID: 2, Scopes: "write"},
+		"admin":   {ID: 3, Scopes: "admin"},
+		"expired": {ID: 4, Scopes: "admin", ExpiresAt: &expired},
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		scope  models.Scope
+		want   int
+	}{
+		{name: "Missing header", header: "", scope: models.ScopeRead, want: http.StatusUnauthorized},
+		{name: "Wrong scheme", header: "Basic reader", scope: models.ScopeRead, want: http.StatusUnauthorized},
+		{name: "Unknown token", header: "Bearer nope", scope: models.ScopeRead, want: http.StatusUnauthorized},
+		{name: "Expired token", header: "Bearer expired", scope: models.ScopeRead, want: http.StatusUnauthorized},
+		{name: "Read with read scope", header: "Bearer reader", scope: models.ScopeRead, want: http.StatusOK},
+		{name: "Write with read scope", header: "Bearer reader", scope: models.ScopeWrite, want: http.StatusForbidden},
+		{name: "Read with write scope", header: "bearer writer", scope: models.ScopeRead, want: http.StatusOK},
+		{name: "Admin with write scope", header: "Bearer writer", scope: models.ScopeAdmin, want: http.StatusForbidden},
+		{name: "Write with admin scope", header: "Bearer admin", scope: models.ScopeWrite, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			handler := auth.Authenticate(tokens)(auth.RequireScope(tt.scope)(ok))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %+v, want %+v", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateOptional(t *testing.T) {
+	tokens := fakeTokenStore{"reader": {ID: 1, Scopes: "read"}}
+
+	tests := []struct {
+		name      string
+		header    string
+		want      int
+		wantToken bool
+	}{
+		{name: "Missing header", header: "", want: http.StatusOK, wantToken: false},
+		{name: "Valid token", header: "Bearer reader", want: http.StatusOK, wantToken: true},
+		{name: "Unknown token", header: "Bearer nope", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotToken bool
+			handler := auth.AuthenticateOptional(tokens)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, gotToken = r.Context().Value(auth.TokenContextKey).(models.Token)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.want || gotToken != tt.wantToken {
+				t.Errorf("status = %+v, token = %v, want %+v, %v", w.Code, gotToken, tt.want, tt.wantToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// ETag returns the entity tag of a version of a task
+func ETag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// listETag returns the entity tag of a list of tasks, changing whenever a
+// task of the list is added, changed or removed
+func listETag(tasks []models.Task) (string, error) {
+	data, err := json.Marshal(tasks)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// match reports whether a list of entity tags from an If-Match or
+// If-None-Match header holds 'etag'. Weak tags only match when 'weak' is
+// set, as If-Match requires a strong comparison.
+func match(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModified answers 304 when the request's If-None-Match holds 'etag',
+// reporting whether it did
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !match(header, etag, true) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// IfMatch rejects writes without an If-Match header holding the current
+// version of the task, so clients do not overwrite changes they have not
+// seen
+func (t TasksController) IfMatch(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("If-Match")
+		if header == "" {
+			errors.Render(w, r, errors.ErrPreconditionRequired)
+			return
+		}
+
+		task, _ := r.Context().Value(TaskContexKey).(models.Task)
+		if !match(header, ETag(task.Version), false) {
+			errors.Render(w, r, errors.ErrPreconditionFailed)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// heartbeatInterval is how often idle streams are pinged so proxies and
+// clients notice dead connections
+const heartbeatInterval = 30 * time.Second
+
+// authTimeout is how long WebSocket clients without an 'Authorization'
+// header have to send their token
+const authTimeout = 10 * time.Second
+
+// close codes of the WebSockets whose token is refused, like the ones of
+// the graphql-transport-ws protocol
+const (
+	closeUnauthorized = 4401
+	closeForbidden    = 4403
+)
+
+// Subscriber is implemented by the source of task events, satisfied by
+// 'events.Broker'
+type Subscriber interface {
+	Subscribe() (<-chan events.Event, func())
+}
+
+type EventsController struct {
+	Events Subscriber
+	Stores TaskStoreFor
+	// Tokens checks the tokens sent over WebSockets
+	Tokens auth.TokenStore
+}
+
+// ConnContextKey is the context key of the connection a request was read
+// from, set by ConnContext
+var ConnContextKey ContextKey = "conn"
+
+// ConnContext keeps the connection of the requests served with 'ctx', so
+// that streams may lift the write timeout of the server. It is meant as
+// the ConnContext of the 'http.Server'.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, ConnContextKey, c)
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// visible reports whether the user making the request may see the event
+func (e EventsController) visible(r *http.Request, event events.Event) bool {
+	ok, err := e.Stores(r.Context(), auth.OwnerID(r.Context())).CanRead(event.Task)
+	return err == nil && ok
+}
+
+// Stream sends task events as Server-Sent Events
+func (e EventsController) Stream(w http.ResponseWriter, r *http.Request) {
+	// subscribing first, events published once the client sees the
+	// response are never missed
+	ch, cancel := e.Events.Subscribe()
+	defer cancel()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errors.Render(w, r, fmt.Errorf("streaming is not supported by the connection"))
+		return
+	}
+
+	// the stream lasts longer than the write timeout of the server
+	if conn, ok := r.Context().Value(ConnContextKey).(net.Conn); ok {
+		conn.SetWriteDeadline(time.Time{})
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !e.visible(r, event) {
+				continue
+			}
+
+			data, marshalErr := json.Marshal(event)
+			if marshalErr != nil {
+				continue
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// WebSocket sends task events as JSON messages over a WebSocket. Clients
+// which cannot send an 'Authorization' header, such as browsers, send
+// '{"token": "<token>"}' as their first message instead.
+func (e EventsController) WebSocket(w http.ResponseWriter, r *http.Request) {
+	token, authenticated := r.Context().Value(auth.TokenContextKey).(models.Token)
+	if authenticated && !token.HasScope(models.ScopeRead) {
+		errors.Render(w, r, errors.ErrForbidden)
+		return
+	}
+
+	ch, cancel := e.Events.Subscribe()
+	defer cancel()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if !authenticated {
+		token, err := e.readToken(conn)
+		switch {
+		case err != nil:
+			closeWebSocket(conn, closeUnauthorized, "Unauthorized")
+			return
+		case !token.HasScope(models.ScopeRead):
+			closeWebSocket(conn, closeForbidden, "Forbidden")
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), auth.TokenContextKey, token))
+	}
+
+	// messages from the client are ignored, reading only detects closing
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			deadline := time.Now().Add(heartbeatInterval)
+			if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		case event, ok := <-ch:
+			if !ok {
+				closeWebSocket(conn, websocket.CloseGoingAway, "server shutting down")
+				return
+			}
+			if !e.visible(r, event) {
+				continue
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(heartbeatInterval))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readToken reads the token sent as the first message of a WebSocket
+func (e EventsController) readToken(conn *websocket.Conn) (models.Token, error) {
+	var msg struct {
+		Token string `json:"token"`
+	}
+
+	conn.SetReadDeadline(time.Now().Add(authTimeout))
+	if err := conn.ReadJSON(&msg); err != nil {
+		return models.Token{}, err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	return auth.Check(e.Tokens, msg.Token)
+}
+
+func closeWebSocket(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
@@ -0,0 +1,155 @@
+package controllers_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// eventsServer serves 'handler' as a user with the read scope, publishing
+// to the returned broker, with a short write timeout streams must outlast
+func eventsServer(t *testing.T, handler func(controllers.EventsController) http.HandlerFunc) (*httptest.Server, *events.Broker) {
+	t.Helper()
+
+	broker := events.NewBroker()
+	tasks := newFakeTaskStore(models.Task{ID: 1, Description: "Visible"})
+	ec := controllers.EventsController{Events: broker, Stores: tasks.For}
+
+	token := models.Token{Scopes: "read"}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), auth.TokenContextKey, token)
+		handler(ec)(w, r.WithContext(ctx))
+	}))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Config.ConnContext = controllers.ConnContext
+	server.Start()
+	t.Cleanup(func() {
+		broker.Close()
+		server.Close()
+	})
+
+	return server, broker
+}
+
+func TestEventsController_Stream(t *testing.T) {
+	server, broker := eventsServer(t, func(ec controllers.EventsController) http.HandlerFunc { return ec.Stream })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	broker.Publish(events.Event{Type: events.TaskCreated, Task: models.Task{ID: 2, Description: "Hidden"}})
+	broker.Publish(events.Event{Type: events.TaskUpdated, Task: models.Task{ID: 1, Description: "Visible"}})
+
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || lines.Text() != "event: updated" {
+		t.Fatalf("first line = %q, want the event of the visible task", lines.Text())
+	}
+	if !lines.Scan() || !strings.Contains(lines.Text(), `"description":"Visible"`) {
+		t.Errorf("data = %q, want the visible task", lines.Text())
+	}
+}
+
+func TestEventsController_WebSocket(t *testing.T) {
+	server, broker := eventsServer(t, func(ec controllers.EventsController) http.HandlerFunc { return ec.WebSocket })
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	broker.Publish(events.Event{Type: events.TaskCreated, Task: models.Task{ID: 2, Description: "Hidden"}})
+	broker.Publish(events.Event{Type: events.TaskUpdated, Task: models.Task{ID: 1, Description: "Visible"}})
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var event events.Event
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != events.TaskUpdated || event.Task.ID != 1 {
+		t.Errorf("event = %+v, want the event of the visible task", event)
+	}
+
+	broker.Close()
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("ReadMessage() after Close error = %+v, want going away", err)
+	}
+}
+
+func TestEventsController_WebSocketToken(t *testing.T) {
+	broker := events.NewBroker()
+	tasks := newFakeTaskStore(models.Task{ID: 1, Description: "Visible"})
+	tokens := fakeTokens{"reader": {Scopes: "read"}, "unscoped": {}}
+	ec := controllers.EventsController{Events: broker, Stores: tasks.For, Tokens: tokens}
+	server := httptest.NewServer(http.HandlerFunc(ec.WebSocket))
+	t.Cleanup(func() {
+		broker.Close()
+		server.Close()
+	})
+
+	tests := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{name: "Unknown token", token: "nope", code: 4401},
+		{name: "Without read scope", token: "unscoped", code: 4403},
+		{name: "Valid token", token: "reader"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if err := conn.WriteJSON(map[string]string{"token": tt.token}); err != nil {
+				t.Fatal(err)
+			}
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			if tt.code != 0 {
+				if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, tt.code) {
+					t.Errorf("ReadMessage() error = %v, want close %d", err, tt.code)
+				}
+				return
+			}
+
+			// the subscription starts before the token is read, so
+			// events published from now on are delivered
+			time.Sleep(100 * time.Millisecond)
+			broker.Publish(events.Event{Type: events.TaskUpdated, Task: models.Task{ID: 1, Description: "Visible"}})
+
+			var event events.Event
+			if err := conn.ReadJSON(&event); err != nil {
+				t.Fatal(err)
+			}
+			if event.Task.ID != 1 {
+				t.Errorf("event = %+v, want the event of the visible task", event)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package controllers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+)
+
+// fakeTaskStore keeps tasks in memory, failing every call with 'err' when set
+type fakeTaskStore struct {
+	tasks map[int64]models.Task
+	err   error
+}
+
+func newFakeTaskStore(tasks ...models.Task) *fakeTaskStore {
+	f := &fakeTaskStore{tasks: make(map[int64]models.Task)}
+	for _, task := range tasks {
+		if task.Version == 0 {
+			task.Version = 1
+		}
+		f.tasks[task.ID] = task
+	}
+
+	return f
+}
+
+// For serves every user from the same tasks
+func (f *fakeTaskStore) For(ctx context.Context, ownerID int64) controllers.TaskStore {
+	return f
+}
+
+func (f *fakeTaskStore) Insert(task models.Task) (models.Task, error) {
+	if f.err != nil {
+		return models.Task{}, f.err
+	}
+
+	task.ID = int64(len(f.tasks) + 1)
+	task.Version = 1
+	f.tasks[task.ID] = task
+	return task, nil
+}
+
+func (f *fakeTaskStore) Update(task models.Task) (models.Task, error) {
+	if f.err != nil {
+		return models.Task{}, f.err
+	}
+
+	current, ok := f.tasks[task.ID]
+	if !ok {
+		return models.Task{}, store.ErrNotFound
+	}
+	if task.Version != 0 && task.Version != current.Version {
+		return models.Task{}, store.ErrStale
+	}
+
+	task.Version = current.Version + 1
+	f.tasks[task.ID] = task
+	return task, nil
+}
+
+func (f *fakeTaskStore) Delete(taskID int64) error {
+	return f.DeleteVersion(taskID, 0)
+}
+
+func (f *fakeTaskStore) DeleteVersion(taskID int64, version int64) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	current, ok := f.tasks[taskID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	if version != 0 && version != current.Version {
+		return store.ErrStale
+	}
+
+	delete(f.tasks, taskID)
+	return nil
+}
+
+func (f *fakeTaskStore) Select(task models.Task) (models.Task, error) {
+	if f.err != nil {
+		return models.Task{}, f.err
+	}
+
+	received, ok := f.tasks[task.ID]
+	if !ok {
+		return models.Task{}, store.ErrNotFound
+	}
+
+	return received, nil
+}
+
+func (f *fakeTaskStore) selectWhere(page models.Page, keep func(models.Task) bool) ([]models.Task, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	var tasks []models.Task
+	for _, task := range f.tasks {
+		if task.ID > page.After && keep(task) {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	if page.Limit > 0 && len(tasks) > page.Limit {
+		tasks = tasks[:page.Limit]
+	}
+
+	return tasks, nil
+}
+
+func (f *fakeTaskStore) SelectAll(done bool, page models.Page) ([]models.Task, error) {
+	return f.selectWhere(page, func(task models.Task) bool { return done || !task.Done })
+}
+
+func (f *fakeTaskStore) SelectAssigned(done bool, page models.Page) ([]models.Task, error) {
+	return f.selectWhere(page, func(task models.Task) bool { return task.AssigneeID != nil && (done || !task.Done) })
+}
+
+func (f *fakeTaskStore) SelectShared(ownerID int64, done bool, page models.Page) ([]models.Task, error) {
+	return f.selectWhere(page, func(task models.Task) bool {
+		return task.OwnerID != nil && *task.OwnerID == ownerID && (done || !task.Done)
+	})
+}
+
+func (f *fakeTaskStore) Assign(taskID int64, assigneeID int64) (models.Task, error) {
+	task, err := f.Select(models.Task{ID: taskID})
+	if err != nil {
+		return task, err
+	}
+
+	task.AssigneeID = nil
+	if assigneeID != 0 {
+		task.AssigneeID = &assigneeID
+	}
+	task.Version++
+	f.tasks[taskID] = task
+
+	return task, nil
+}
+
+func (f *fakeTaskStore) CanRead(task models.Task) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+
+	_, ok := f.tasks[task.ID]
+	return ok, nil
+}
+
+// fakeUserStore keeps users in memory, all with the password 'secret'
+type fakeUserStore map[string]models.User
+
+func newFakeUserStore(names ...string) fakeUserStore {
+	f := make(fakeUserStore)
+	for _, name := range names {
+		f[name] = models.User{ID: int64(len(f) + 1), Name: name}
+	}
+
+	return f
+}
+
+func (f fakeUserStore) Insert(name, password string) (models.User, error) {
+	if _, ok := f[name]; ok {
+		return models.User{}, fmt.Errorf("%w: user.name", store.ErrConflict)
+	}
+
+	f[name] = models.User{ID: int64(len(f) + 1), Name: name}
+	return f[name], nil
+}
+
+func (f fakeUserStore) Authenticate(name, password string) (models.User, error) {
+	user, ok := f[name]
+	if !ok || password != "secret" {
+		return models.User{}, store.ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+func (f fakeUserStore) SelectByName(name string) (models.User, error) {
+	user, ok := f[name]
+	if !ok {
+		return models.User{}, store.ErrNotFound
+	}
+
+	return user, nil
+}
+
+// fakeTokenStore issues the same raw token every time, or fails with 'err'
+type fakeTokenStore struct {
+	err error
+}
+
+func (f fakeTokenStore) Create(token models.Token) (string, models.Token, error) {
+	if f.err != nil {
+		return "", models.Token{}, f.err
+	}
+
+	return "todo_session", token, nil
+}
+
+func (f fakeTokenStore) DeleteExpired(before time.Time) (int64, error) {
+	return 0, f.err
+}
+
+// fakeShareStore keeps shares in memory
+type fakeShareStore map[[2]int64]models.Share
+
+func (f fakeShareStore) Upsert(share models.Share) error {
+	if share.OwnerID == share.UserID {
+		return store.ValidationError{Field: "user", Message: "tasks cannot be shared with their owner"}
+	}
+
+	f[[2]int64{share.OwnerID, share.UserID}] = share
+	return nil
+}
+
+func (f fakeShareStore) Delete(ownerID, userID int64) error {
+	key := [2]int64{ownerID, userID}
+	if _, ok := f[key]; !ok {
+		return store.ErrNotFound
+	}
+
+	delete(f, key)
+	return nil
+}
+
+func (f fakeShareStore) SelectAll(ownerID int64) ([]models.Share, error) {
+	var shares []models.Share
+	for _, share := range f {
+		if share.OwnerID == ownerID {
+			shares = append(shares, share)
+		}
+	}
+
+	return shares, nil
+}
+
+// serve sends a request to 'handler' as if it was authenticated with
+// 'token', skipping authentication when the token has no scopes. 'header'
+// holds pairs of header names and values.
+func serve(handler http.Handler, token models.Token, method, path, body string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	if token.Scopes != "" {
+		r = r.WithContext(context.WithValue(r.Context(), auth.TokenContextKey, token))
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w
+}
+
+// fakeTokens looks tokens up by their raw value
+type fakeTokens map[string]models.Token
+
+func (f fakeTokens) SelectByToken(raw string) (models.Token, error) {
+	token, ok := f[raw]
+	if !ok {
+		return models.Token{}, store.ErrNotFound
+	}
+
+	return token, nil
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// MaxPageSize bounds the 'limit' query parameter of 'GET /tasks'
+const MaxPageSize = 100
+
+// readPage reads the page of tasks selected by the 'after' and 'limit'
+// query parameters of the request, every task when neither is set
+func readPage(r *http.Request) (models.Page, error) {
+	var page models.Page
+	query := r.URL.Query()
+
+	if after := query.Get("after"); after != "" {
+		id, err := strconv.ParseInt(after, 10, 64)
+		if err != nil || id < 0 {
+			return page, fmt.Errorf("after must be a task ID, got '%s'", after)
+		}
+		page.After = id
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxPageSize {
+			return page, fmt.Errorf("limit must be between 1 and %d, got '%s'", MaxPageSize, limit)
+		}
+		page.Limit = n
+	}
+
+	return page, nil
+}
+
+// setNextLink points the Link header of the response to the page
+// following 'tasks'
+func setNextLink(w http.ResponseWriter, r *http.Request, tasks []models.Task) {
+	next := *r.URL
+	query := next.Query()
+	query.Set("after", strconv.FormatInt(tasks[len(tasks)-1].ID, 10))
+	next.RawQuery = query.Encode()
+
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+}
@@ -2,104 +2,90 @@ package controllers
 
 import (
 	"context"
-	"log"
 	"net/http"
-	"os"
-	"os/user"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"github.com/imgabe/todo/pkg/api/web/auth"
 	"github.com/imgabe/todo/pkg/errors"
 	"github.com/imgabe/todo/pkg/models"
-	"github.com/imgabe/todo/pkg/store"
-	"github.com/jmoiron/sqlx"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 // ContextKey ...
 type ContextKey string
 
-var ctx context.Context
-
 var (
-	// TaskStoreContextKey ...
-	TaskStoreContextKey ContextKey = "taskstore"
-	// DBContextKey ...
-	DatabaseContextKey ContextKey = "db"
 	// TaskContexKey ...
 	TaskContexKey ContextKey = "task"
 )
 
-func init() {
-	path := dbPath()
-	db := OpenDatabase(path)
-	if err := db.Ping(); err != nil {
-		log.Fatal(err)
-	}
-
-	ctx = context.WithValue(context.Background(), DatabaseContextKey, db)
-	ts := store.TaskStore{DB: db}
-	ctx = context.WithValue(context.Background(), TaskStoreContextKey, ts)
-}
-
-func dbPath() string {
-	user, err := user.Current()
-	if err != nil {
-		panic(err)
-	}
-
-	return user.HomeDir + string(os.PathSeparator) + "database.todo"
+// TaskStore is the set of store operations the tasks controller relies on,
+// satisfied by 'store.TaskStore'
+type TaskStore interface {
+	Insert(task models.Task) (models.Task, error)
+	Update(task models.Task) (models.Task, error)
+	Delete(taskID int64) error
+	DeleteVersion(taskID int64, version int64) error
+	Select(task models.Task) (models.Task, error)
+	SelectAll(done bool, page models.Page) ([]models.Task, error)
+	SelectAssigned(done bool, page models.Page) ([]models.Task, error)
+	SelectShared(ownerID int64, done bool, page models.Page) ([]models.Task, error)
+	Assign(taskID int64, assigneeID int64) (models.Task, error)
+	CanRead(task models.Task) (bool, error)
 }
 
-func OpenDatabase(path string) *sqlx.DB {
-	db, err := sqlx.Open("sqlite3", path)
-	if err != nil {
-		log.Fatalf("error opening database: %s", err)
-	}
-
-	db.MustExec(store.CreateDatabaseStatement)
-
-	return db
-}
+// TaskStoreFor returns the task store limited to the tasks of a user,
+// serving the request of 'ctx'
+type TaskStoreFor func(ctx context.Context, ownerID int64) TaskStore
 
-func NewTasksController() *chi.Mux {
+func NewTasksController(stores TaskStoreFor, users UserStore) *chi.Mux {
 	r := chi.NewRouter()
-	tc := TasksController{}
+	tc := TasksController{Stores: stores, Users: users}
 
-	r.Get("/", tc.All)   // GET /tasks - read a list of tasks
-	r.Post("/", tc.Post) // POST /tasks - create a new task and persist it
+	read := auth.RequireScope(models.ScopeRead)
+	write := auth.RequireScope(models.ScopeWrite)
+
+	r.With(read).Get("/", tc.All)    // GET /tasks?assignee=me&owner=:name&limit=:n&after=:id - read a list of tasks
+	r.With(write).Post("/", tc.Post) // POST /tasks - create a new task and persist it
 
 	r.Route("/{taskID}", func(r chi.Router) {
-		r.Use(TaskCtx)
+		r.With(read, tc.TaskCtx).Get("/", tc.Get)                    // GET /tasks/{taskID} - read a single task by :taskID
+		r.With(write, tc.TaskCtx, tc.IfMatch).Put("/", tc.Put)       // PUT /tasks/{taskID} - update a single task by :taskID
+		r.With(write, tc.TaskCtx, tc.IfMatch).Patch("/", tc.Patch)   // PATCH /tasks/{taskID} - update some fields of a single task by :taskID
+		r.With(write, tc.TaskCtx, tc.IfMatch).Delete("/", tc.Delete) // DELETE /tasks/{taskID} - delete a single task by :taskID
 
-		r.Get("/", tc.Get)       // GET /tasks/{taskID} - read a single task by :taskID
-		r.Put("/", tc.Put)       // PUT /tasks/{taskID} - update a single task by :taskID
-		r.Delete("/", tc.Delete) // DELETE /tasks/{taskID} - delete a single task by :taskID
+		r.With(write, tc.TaskCtx).Put("/assignee", tc.Assign) // PUT /tasks/{taskID}/assignee - assign a single task by :taskID
 	})
 
 	return r
 }
 
-type TasksController struct{}
+type TasksController struct {
+	Stores TaskStoreFor
+	Users  UserStore
+}
+
+// store returns the task store of the user making the request
+func (t TasksController) store(r *http.Request) TaskStore {
+	return t.Stores(r.Context(), auth.OwnerID(r.Context()))
+}
 
-func TaskCtx(next http.Handler) http.Handler {
+func (t TasksController) TaskCtx(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var task models.Task
 
 		if strTaskID := chi.URLParam(r, "taskID"); strTaskID != "" {
 			taskID, err := strconv.ParseInt(strTaskID, 10, 64)
 			if err != nil {
-				log.Fatal("Fail convert to int64")
+				errors.Render(w, r, errors.ErrNotFound)
 				return
 			}
 
-			if ts, ok := ctx.Value(TaskStoreContextKey).(store.TaskStore); ok {
-				task, err = ts.Select(models.Task{ID: taskID})
-				if err != nil {
-					render.Render(w, r, errors.ErrNotFound)
-					return
-				}
+			task, err = t.store(r).Select(models.Task{ID: taskID})
+			if err != nil {
+				errors.Render(w, r, err)
+				return
 			}
 		}
 
@@ -109,10 +95,57 @@ func TaskCtx(next http.Handler) http.Handler {
 }
 
 func (t TasksController) All(w http.ResponseWriter, r *http.Request) {
-	ts := ctx.Value(TaskStoreContextKey).(store.TaskStore)
-	tasks, err := ts.SelectAll(true)
+	page, err := readPage(r)
+	if err != nil {
+		errors.Render(w, r, errors.ErrInvalidRequest(err))
+		return
+	}
+
+	// one more task than the page holds tells whether another one follows
+	if page.Limit > 0 {
+		page.Limit++
+	}
+
+	var tasks []models.Task
+
+	switch query := r.URL.Query(); {
+	case query.Get("assignee") == "me":
+		tasks, err = t.store(r).SelectAssigned(true, page)
+	case query.Get("owner") != "":
+		owner, ownerErr := t.Users.SelectByName(query.Get("owner"))
+		if ownerErr != nil {
+			errors.Render(w, r, ownerErr)
+			return
+		}
+
+		tasks, err = t.store(r).SelectShared(owner.ID, true, page)
+	default:
+		tasks, err = t.store(r).SelectAll(true, page)
+	}
+
 	if err != nil {
-		render.Render(w, r, errors.ErrNotFound)
+		errors.Render(w, r, err)
+		return
+	}
+
+	more := page.Limit > 0 && len(tasks) == page.Limit
+	if more {
+		tasks = tasks[:len(tasks)-1]
+	}
+	if tasks == nil {
+		tasks = []models.Task{}
+	}
+	if more {
+		setNextLink(w, r, tasks)
+	}
+
+	etag, err := listETag(tasks)
+	if err != nil {
+		errors.Render(w, r, err)
+		return
+	}
+	if notModified(w, r, etag) {
+		return
 	}
 
 	render.JSON(w, r, tasks)
@@ -120,59 +153,112 @@ func (t TasksController) All(w http.ResponseWriter, r *http.Request) {
 
 func (t TasksController) Post(w http.ResponseWriter, r *http.Request) {
 	data := &models.Task{}
-	ts := ctx.Value(TaskStoreContextKey).(store.TaskStore)
 
 	if err := render.Bind(r, data); err != nil {
-		render.Render(w, r, errors.ErrInvalidRequest(err))
+		errors.Render(w, r, errors.ErrInvalidRequest(err))
 		return
 	}
 
-	_, err := ts.Insert(*data)
+	task, err := t.store(r).Insert(*data)
 	if err != nil {
-		render.Render(w, r, errors.ErrNotFound)
+		errors.Render(w, r, err)
+		return
 	}
 
+	w.Header().Set("ETag", ETag(task.Version))
 	render.Status(r, http.StatusCreated)
-	render.Render(w, r, data)
+	render.Render(w, r, &task)
 }
 
 func (t TasksController) Get(w http.ResponseWriter, r *http.Request) {
 	if task, ok := r.Context().Value(TaskContexKey).(models.Task); ok {
+		if notModified(w, r, ETag(task.Version)) {
+			return
+		}
+
 		render.JSON(w, r, task)
 	}
 }
 
 func (t TasksController) Put(w http.ResponseWriter, r *http.Request) {
 	if task, ok := r.Context().Value(TaskContexKey).(models.Task); ok {
-		ts := ctx.Value(TaskStoreContextKey).(store.TaskStore)
 		data := &models.Task{}
 
 		if err := render.Bind(r, data); err != nil {
-			render.Render(w, r, errors.ErrInvalidRequest(err))
+			errors.Render(w, r, errors.ErrInvalidRequest(err))
 			return
 		}
 
-		newTask := &models.Task{ID: task.ID, Description: data.Description, Done: data.Done}
-		updateTask, err := ts.Update(*newTask)
+		newTask := &models.Task{ID: task.ID, Description: data.Description, Done: data.Done, Version: task.Version}
+		updateTask, err := t.store(r).Update(*newTask)
 		if err != nil {
-			render.Render(w, r, &updateTask)
+			errors.Render(w, r, err)
+			return
 		}
 
+		w.Header().Set("ETag", ETag(updateTask.Version))
+		render.Render(w, r, &updateTask)
+	}
+}
+
+func (t TasksController) Patch(w http.ResponseWriter, r *http.Request) {
+	if task, ok := r.Context().Value(TaskContexKey).(models.Task); ok {
+		data := &models.TaskPatch{}
+
+		if err := render.Bind(r, data); err != nil {
+			errors.Render(w, r, errors.ErrInvalidRequest(err))
+			return
+		}
+
+		updateTask, err := t.store(r).Update(data.Apply(task))
+		if err != nil {
+			errors.Render(w, r, err)
+			return
+		}
+
+		w.Header().Set("ETag", ETag(updateTask.Version))
 		render.Render(w, r, &updateTask)
 	}
 }
 
 func (t TasksController) Delete(w http.ResponseWriter, r *http.Request) {
-	if task, ok := r.Context().Value(TaskContexKey).(*models.Task); ok {
-		ts := ctx.Value(TaskStoreContextKey).(store.TaskStore)
-		taskID := int64(task.ID)
+	if task, ok := r.Context().Value(TaskContexKey).(models.Task); ok {
+		err := t.store(r).DeleteVersion(task.ID, task.Version)
+		if err != nil {
+			errors.Render(w, r, err)
+			return
+		}
+
+		render.Render(w, r, &task)
+	}
+}
+
+func (t TasksController) Assign(w http.ResponseWriter, r *http.Request) {
+	if task, ok := r.Context().Value(TaskContexKey).(models.Task); ok {
+		data := &models.Assignment{}
+
+		if err := render.Bind(r, data); err != nil {
+			errors.Render(w, r, errors.ErrInvalidRequest(err))
+			return
+		}
+
+		var assigneeID int64
+		if data.Assignee != "" {
+			assignee, err := t.Users.SelectByName(data.Assignee)
+			if err != nil {
+				errors.Render(w, r, err)
+				return
+			}
+			assigneeID = assignee.ID
+		}
 
-		err := ts.Delete(taskID)
+		assigned, err := t.store(r).Assign(task.ID, assigneeID)
 		if err != nil {
-			render.Render(w, r, errors.ErrInvalidRequest(err))
+			errors.Render(w, r, err)
 			return
 		}
 
-		render.Render(w, r, task)
+		w.Header().Set("ETag", ETag(assigned.Version))
+		render.Render(w, r, &assigned)
 	}
 }
@@ -0,0 +1,168 @@
+package controllers_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+func TestTasksController(t *testing.T) {
+	alice, bob := int64(1), int64(2)
+	reader := models.Token{Scopes: "read", UserID: &alice}
+	writer := models.Token{Scopes: "read,write", UserID: &alice}
+	failure := errors.New("database is locked")
+
+	tests := []struct {
+		name     string
+		token    models.Token
+		method   string
+		path     string
+		body     string
+		header   []string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "List without token", method: "GET", path: "/", want: http.StatusUnauthorized},
+		{name: "List", token: reader, method: "GET", path: "/", want: http.StatusOK, wantBody: `"description":"Task 2"`},
+		{name: "List assigned", token: reader, method: "GET", path: "/?assignee=me", want: http.StatusOK, wantBody: `[{"id":2,`},
+		{name: "List of owner", token: reader, method: "GET", path: "/?owner=alice", want: http.StatusOK, wantBody: `[{"id":1,`},
+		{name: "List of unknown owner", token: reader, method: "GET", path: "/?owner=nobody", want: http.StatusNotFound},
+		{name: "List failing", token: reader, method: "GET", path: "/", err: failure, want: http.StatusInternalServerError},
+		{name: "List first page", token: reader, method: "GET", path: "/?limit=1", want: http.StatusOK, wantBody: `[{"id":1,`},
+		{name: "List next page", token: reader, method: "GET", path: "/?limit=1&after=1", want: http.StatusOK, wantBody: `[{"id":2,`},
+		{name: "List past the last page", token: reader, method: "GET", path: "/?after=2", want: http.StatusOK, wantBody: `[]`},
+		{name: "List with limit too large", token: reader, method: "GET", path: "/?limit=1000", want: http.StatusBadRequest},
+		{name: "List with invalid after", token: reader, method: "GET", path: "/?after=abc", want: http.StatusBadRequest},
+		{name: "Create", token: writer, method: "POST", path: "/", body: `{"description":"Task 3"}`, want: http.StatusCreated, wantBody: `{"id":3,"description":"Task 3"`},
+		{name: "Create with read scope", token: reader, method: "POST", path: "/", body: `{"description":"Task 3"}`, want: http.StatusForbidden},
+		{name: "Create without description", token: writer, method: "POST", path: "/", body: `{}`, want: http.StatusBadRequest},
+		{name: "Create with invalid JSON", token: writer, method: "POST", path: "/", body: `{`, want: http.StatusBadRequest},
+		{name: "Create failing", token: writer, method: "POST", path: "/", body: `{"description":"Task 3"}`, err: failure, want: http.StatusInternalServerError},
+		{name: "Read", token: reader, method: "GET", path: "/1", want: http.StatusOK, wantBody: `{"id":1,"description":"Task 1"`},
+		{name: "Read non-existent", token: reader, method: "GET", path: "/99", want: http.StatusNotFound},
+		{name: "Read non-numeric", token: reader, method: "GET", path: "/abc", want: http.StatusNotFound},
+		{name: "Read unchanged", token: reader, method: "GET", path: "/1", header: []string{"If-None-Match", `W/"1"`}, want: http.StatusNotModified},
+		{name: "Read changed", token: reader, method: "GET", path: "/1", header: []string{"If-None-Match", `"0"`}, want: http.StatusOK, wantBody: `"version":1`},
+		{name: "Read failing", token: reader, method: "GET", path: "/1", err: failure, want: http.StatusInternalServerError},
+		{name: "Update", token: writer, method: "PUT", path: "/1", body: `{"description":"Edited","done":true}`, header: []string{"If-Match", `"1"`}, want: http.StatusOK, wantBody: `{"id":1,"description":"Edited","done":true,"version":2}`},
+		{name: "Update any version", token: writer, method: "PUT", path: "/1", body: `{"description":"Edited"}`, header: []string{"If-Match", "*"}, want: http.StatusOK, wantBody: `"version":2`},
+		{name: "Update stale version", token: writer, method: "PUT", path: "/1", body: `{"description":"Edited"}`, header: []string{"If-Match", `"0", W/"1"`}, want: http.StatusPreconditionFailed},
+		{name: "Update without If-Match", token: writer, method: "PUT", path: "/1", body: `{"description":"Edited"}`, want: http.StatusPreconditionRequired},
+		{name: "Update with read scope", token: reader, method: "PUT", path: "/1", body: `{"description":"Edited"}`, want: http.StatusForbidden},
+		{name: "Update without description", token: writer, method: "PUT", path: "/1", body: `{"done":true}`, header: []string{"If-Match", `"1"`}, want: http.StatusBadRequest},
+		{name: "Update non-existent", token: writer, method: "PUT", path: "/99", body: `{"description":"Edited"}`, header: []string{"If-Match", `"1"`}, want: http.StatusNotFound},
+		{name: "Patch", token: writer, method: "PATCH", path: "/1", body: `{"done":true}`, header: []string{"If-Match", `"1"`}, want: http.StatusOK, wantBody: `"description":"Task 1","done":true,"owner_id":1,"version":2}`},
+		{name: "Patch with empty description", token: writer, method: "PATCH", path: "/1", body: `{"description":""}`, header: []string{"If-Match", `"1"`}, want: http.StatusBadRequest},
+		{name: "Patch stale version", token: writer, method: "PATCH", path: "/1", body: `{"done":true}`, header: []string{"If-Match", `"2"`}, want: http.StatusPreconditionFailed},
+		{name: "Patch without If-Match", token: writer, method: "PATCH", path: "/1", body: `{"done":true}`, want: http.StatusPreconditionRequired},
+		{name: "Patch with read scope", token: reader, method: "PATCH", path: "/1", body: `{"done":true}`, header: []string{"If-Match", `"1"`}, want: http.StatusForbidden},
+		{name: "Delete", token: writer, method: "DELETE", path: "/1", header: []string{"If-Match", `"1"`}, want: http.StatusOK, wantBody: `{"id":1,"description":"Task 1"`},
+		{name: "Delete with read scope", token: reader, method: "DELETE", path: "/1", want: http.StatusForbidden},
+		{name: "Delete stale version", token: writer, method: "DELETE", path: "/1", header: []string{"If-Match", `"2"`}, want: http.StatusPreconditionFailed},
+		{name: "Delete without If-Match", token: writer, method: "DELETE", path: "/1", want: http.StatusPreconditionRequired},
+		{name: "Delete non-existent", token: writer, method: "DELETE", path: "/99", want: http.StatusNotFound},
+		{name: "Delete non-numeric", token: writer, method: "DELETE", path: "/abc", want: http.StatusNotFound},
+		{name: "Assign", token: writer, method: "PUT", path: "/1/assignee", body: `{"assignee":"bob"}`, want: http.StatusOK, wantBody: `"assignee_id":2`},
+		{name: "Unassign", token: writer, method: "PUT", path: "/2/assignee", body: `{"assignee":""}`, want: http.StatusOK, wantBody: `{"id":2,"description":"Task 2","done":true,"version":2}`},
+		{name: "Assign to unknown user", token: writer, method: "PUT", path: "/1/assignee", body: `{"assignee":"nobody"}`, want: http.StatusNotFound},
+		{name: "Assign with read scope", token: reader, method: "PUT", path: "/1/assignee", body: `{"assignee":"bob"}`, want: http.StatusForbidden},
+		{name: "Assign non-existent", token: writer, method: "PUT", path: "/99/assignee", body: `{"assignee":"bob"}`, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks := newFakeTaskStore(
+				models.Task{ID: 1, Description: "Task 1", OwnerID: &alice},
+				models.Task{ID: 2, Description: "Task 2", Done: true, AssigneeID: &bob},
+			)
+			tasks.err = tt.err
+			handler := controllers.NewTasksController(tasks.For, newFakeUserStore("alice", "bob"))
+
+			w := serve(handler, tt.token, tt.method, tt.path, tt.body, tt.header...)
+
+			if w.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d: %s", tt.method, tt.path, w.Code, tt.want, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("%s %s = %s, want it to contain %s", tt.method, tt.path, w.Body, tt.wantBody)
+			}
+			if w.Code < 300 && tt.path != "/" && tt.method != "DELETE" && w.Header().Get("ETag") == "" {
+				t.Errorf("%s %s has no ETag", tt.method, tt.path)
+			}
+			if w.Code >= 400 && w.Header().Get("Content-Type") != "application/problem+json" {
+				t.Errorf("%s %s error Content-Type = %q", tt.method, tt.path, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestTasksController_DeleteRemoves(t *testing.T) {
+	writer := models.Token{Scopes: "read,write"}
+	tasks := newFakeTaskStore(models.Task{ID: 1, Description: "Task 1"})
+	handler := controllers.NewTasksController(tasks.For, newFakeUserStore())
+
+	if w := serve(handler, writer, "DELETE", "/1", "", "If-Match", `"1"`); w.Code != http.StatusOK {
+		t.Fatalf("DELETE /1 = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if w := serve(handler, writer, "GET", "/1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /1 after DELETE = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestTasksController_ListETag(t *testing.T) {
+	reader := models.Token{Scopes: "read"}
+	writer := models.Token{Scopes: "read,write"}
+	tasks := newFakeTaskStore(models.Task{ID: 1, Description: "Task 1"})
+	handler := controllers.NewTasksController(tasks.For, newFakeUserStore())
+
+	first := serve(handler, reader, "GET", "/", "")
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("GET / has no ETag")
+	}
+
+	if w := serve(handler, reader, "GET", "/", "", "If-None-Match", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("GET / unchanged = %d %s, want %d without body", w.Code, w.Body, http.StatusNotModified)
+	}
+
+	serve(handler, writer, "PATCH", "/1", `{"done":true}`, "If-Match", `"1"`)
+
+	w := serve(handler, reader, "GET", "/", "", "If-None-Match", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("GET / changed = %d with ETag %s, want %d with a new ETag", w.Code, w.Header().Get("ETag"), http.StatusOK)
+	}
+}
+
+func TestTasksController_ListPages(t *testing.T) {
+	reader := models.Token{Scopes: "read"}
+	tasks := newFakeTaskStore(
+		models.Task{ID: 1, Description: "Task 1"},
+		models.Task{ID: 2, Description: "Task 2"},
+		models.Task{ID: 3, Description: "Task 3"},
+	)
+	handler := controllers.NewTasksController(tasks.For, newFakeUserStore())
+
+	tests := []struct {
+		path     string
+		wantBody string
+		wantLink string
+	}{
+		{path: "/?limit=2", wantBody: `[{"id":1,`, wantLink: `</?after=2&limit=2>; rel="next"`},
+		{path: "/?after=2&limit=2", wantBody: `[{"id":3,`, wantLink: ""},
+		{path: "/?limit=3", wantBody: `"id":3`, wantLink: ""},
+		{path: "/", wantBody: `"id":3`, wantLink: ""},
+	}
+	for _, tt := range tests {
+		w := serve(handler, reader, "GET", tt.path, "")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("GET %s = %d %s, want %d with %s", tt.path, w.Code, w.Body, http.StatusOK, tt.wantBody)
+		}
+		if link := w.Header().Get("Link"); link != tt.wantLink {
+			t.Errorf("GET %s Link = %q, want %q", tt.path, link, tt.wantLink)
+		}
+	}
+}
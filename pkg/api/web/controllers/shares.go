@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	stderrors "errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// ShareStore is the set of store operations the shares controller relies
+// on, satisfied by 'store.ShareStore'
+type ShareStore interface {
+	Upsert(share models.Share) error
+	Delete(ownerID, userID int64) error
+	SelectAll(ownerID int64) ([]models.Share, error)
+}
+
+func NewSharesController(shares ShareStore, users UserStore) *chi.Mux {
+	r := chi.NewRouter()
+	sc := SharesController{Shares: shares, Users: users}
+
+	// sharing hands the tasks over to other users, so it is kept to
+	// administrators
+	r.Use(auth.RequireScope(models.ScopeAdmin))
+	r.Use(sc.OwnerCtx)
+
+	r.Get("/", sc.All)                 // GET /shares - read the users the tasks are shared with
+	r.Put("/{userName}", sc.Put)       // PUT /shares/{userName} - share the tasks with :userName
+	r.Delete("/{userName}", sc.Delete) // DELETE /shares/{userName} - stop sharing the tasks with :userName
+
+	return r
+}
+
+type SharesController struct {
+	Shares ShareStore
+	Users  UserStore
+}
+
+// OwnerCtx rejects tokens not tied to a user, as there is nobody to share from
+func (s SharesController) OwnerCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.OwnerID(r.Context()) == 0 {
+			errors.Render(w, r, errors.ErrInvalidRequest(stderrors.New("sharing requires a token tied to a user")))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s SharesController) All(w http.ResponseWriter, r *http.Request) {
+	shares, err := s.Shares.SelectAll(auth.OwnerID(r.Context()))
+	if err != nil {
+		errors.Render(w, r, err)
+		return
+	}
+	if shares == nil {
+		shares = []models.Share{}
+	}
+
+	render.JSON(w, r, shares)
+}
+
+func (s SharesController) Put(w http.ResponseWriter, r *http.Request) {
+	data := &models.Share{}
+
+	if err := render.Bind(r, data); err != nil {
+		errors.Render(w, r, errors.ErrInvalidRequest(err))
+		return
+	}
+
+	user, err := s.Users.SelectByName(chi.URLParam(r, "userName"))
+	if err != nil {
+		errors.Render(w, r, err)
+		return
+	}
+
+	share := models.Share{OwnerID: auth.OwnerID(r.Context()), UserID: user.ID, Permission: data.Permission}
+	if err := s.Shares.Upsert(share); err != nil {
+		errors.Render(w, r, err)
+		return
+	}
+
+	render.Render(w, r, &share)
+}
+
+func (s SharesController) Delete(w http.ResponseWriter, r *http.Request) {
+	user, err := s.Users.SelectByName(chi.URLParam(r, "userName"))
+	if err != nil {
+		errors.Render(w, r, err)
+		return
+	}
+
+	err = s.Shares.Delete(auth.OwnerID(r.Context()), user.ID)
+	if err != nil {
+		errors.Render(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,53 @@
+package controllers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+func TestSharesController(t *testing.T) {
+	alice := int64(1)
+	writer := models.Token{Scopes: "read,write", UserID: &alice}
+	admin := models.Token{Scopes: "admin", UserID: &alice}
+	unowned := models.Token{Scopes: "admin"}
+
+	tests := []struct {
+		name     string
+		token    models.Token
+		method   string
+		path     string
+		body     string
+		want     int
+		wantBody string
+	}{
+		{name: "List", token: admin, method: "GET", path: "/", want: http.StatusOK, wantBody: `[{"owner_id":1,"user_id":2,"permission":"read"}]`},
+		{name: "List with write scope", token: writer, method: "GET", path: "/", want: http.StatusForbidden},
+		{name: "List without user", token: unowned, method: "GET", path: "/", want: http.StatusBadRequest},
+		{name: "Share", token: admin, method: "PUT", path: "/bob", body: `{"permission":"write"}`, want: http.StatusOK, wantBody: `"permission":"write"`},
+		{name: "Share with invalid permission", token: admin, method: "PUT", path: "/bob", body: `{"permission":"all"}`, want: http.StatusBadRequest},
+		{name: "Share with unknown user", token: admin, method: "PUT", path: "/nobody", body: `{"permission":"read"}`, want: http.StatusNotFound},
+		{name: "Share with owner", token: admin, method: "PUT", path: "/alice", body: `{"permission":"read"}`, want: http.StatusUnprocessableEntity},
+		{name: "Unshare", token: admin, method: "DELETE", path: "/bob", want: http.StatusNoContent},
+		{name: "Unshare not shared", token: admin, method: "DELETE", path: "/carol", want: http.StatusNotFound},
+		{name: "Unshare unknown user", token: admin, method: "DELETE", path: "/nobody", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares := fakeShareStore{{1, 2}: {OwnerID: 1, UserID: 2, Permission: models.PermissionRead}}
+			handler := controllers.NewSharesController(shares, newFakeUserStore("alice", "bob", "carol"))
+
+			w := serve(handler, tt.token, tt.method, tt.path, tt.body)
+
+			if w.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d: %s", tt.method, tt.path, w.Code, tt.want, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("%s %s = %s, want it to contain %s", tt.method, tt.path, w.Body, tt.wantBody)
+			}
+		})
+	}
+}
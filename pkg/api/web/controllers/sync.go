@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// SyncStore is the set of store operations the sync controller relies on,
+// satisfied by 'store.SyncStore'
+type SyncStore interface {
+	Merge(changes []models.TaskChange, since int64, strategy models.MergeStrategy) (models.MergeResult, error)
+	Changes(since int64, limit int) ([]models.TaskChange, int64, error)
+}
+
+// SyncStoreFor returns the sync store limited to the tasks of a user,
+// serving the request of 'ctx'
+type SyncStoreFor func(ctx context.Context, ownerID int64) SyncStore
+
+func NewSyncController(stores SyncStoreFor) *chi.Mux {
+	r := chi.NewRouter()
+	sc := SyncController{Stores: stores}
+
+	r.Use(auth.RequireScope(models.ScopeWrite))
+
+	r.Post("/", sc.Sync) // POST /sync - exchange the changes made to tasks since the last sync
+
+	return r
+}
+
+type SyncController struct {
+	Stores SyncStoreFor
+}
+
+// Sync merges the changes sent by a client, then answers with every change
+// it does not have yet, its own ones being merged included
+func (s SyncController) Sync(w http.ResponseWriter, r *http.Request) {
+	data := &models.SyncRequest{}
+
+	if err := render.Bind(r, data); err != nil {
+		errors.Render(w, r, errors.ErrInvalidRequest(err))
+		return
+	}
+
+	ss := s.Stores(r.Context(), auth.OwnerID(r.Context()))
+
+	result, err := ss.Merge(data.Changes, data.Since, data.Strategy)
+	if err != nil {
+		errors.Render(w, r, err)
+		return
+	}
+
+	changes, cursor, err := ss.Changes(data.Since, 0)
+	if err != nil {
+		errors.Render(w, r, err)
+		return
+	}
+
+	conflicts := result.Conflicts
+	if conflicts == nil {
+		conflicts = []models.SyncConflict{}
+	}
+
+	render.Render(w, r, &models.SyncResponse{Cursor: cursor, Changes: changes, Conflicts: conflicts})
+}
@@ -0,0 +1,89 @@
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// fakeSyncStore records the merged changes and answers with 'changes'
+type fakeSyncStore struct {
+	merged   []models.TaskChange
+	since    int64
+	strategy models.MergeStrategy
+	changes  []models.TaskChange
+	err      error
+}
+
+func (f *fakeSyncStore) For(ctx context.Context, ownerID int64) controllers.SyncStore {
+	return f
+}
+
+func (f *fakeSyncStore) Merge(changes []models.TaskChange, since int64, strategy models.MergeStrategy) (models.MergeResult, error) {
+	if f.err != nil {
+		return models.MergeResult{}, f.err
+	}
+
+	f.merged, f.since, f.strategy = changes, since, strategy
+	return models.MergeResult{Conflicts: []models.SyncConflict{{UUID: "a", Field: "done", Ours: "true", Theirs: "false", Kept: "ours"}}}, nil
+}
+
+func (f *fakeSyncStore) Changes(since int64, limit int) ([]models.TaskChange, int64, error) {
+	return f.changes, 7, nil
+}
+
+func TestSyncController(t *testing.T) {
+	alice := int64(1)
+	reader := models.Token{Scopes: "read", UserID: &alice}
+	writer := models.Token{Scopes: "write", UserID: &alice}
+
+	tests := []struct {
+		name     string
+		token    models.Token
+		body     string
+		err      error
+		want     int
+		wantBody string
+		strategy models.MergeStrategy
+	}{
+		{
+			name:     "Sync",
+			token:    writer,
+			body:     `{"since":3,"strategy":"field","changes":[{"uuid":"a","description":"Task","done_changed":true}]}`,
+			want:     http.StatusOK,
+			wantBody: `{"cursor":7,"changes":[{"uuid":"b","description":"Server task","done":false,"description_updated_at":0,"done_updated_at":0}],"conflicts":[{"uuid":"a","description":"","field":"done","ours":"true","theirs":"false","kept":"ours"}]}`,
+			strategy: models.MergeFields,
+		},
+		{name: "Sync with default strategy", token: writer, body: `{"changes":[]}`, want: http.StatusOK, strategy: models.MergeLastWriter},
+		{name: "Sync with read scope", token: reader, body: `{}`, want: http.StatusForbidden},
+		{name: "Sync with unknown strategy", token: writer, body: `{"strategy":"newest"}`, want: http.StatusBadRequest},
+		{name: "Sync with negative cursor", token: writer, body: `{"since":-1}`, want: http.StatusBadRequest},
+		{name: "Sync change without uuid", token: writer, body: `{"changes":[{"description":"Task"}]}`, want: http.StatusBadRequest},
+		{name: "Sync change without description", token: writer, body: `{"changes":[{"uuid":"a"}]}`, want: http.StatusBadRequest},
+		{name: "Sync deletion", token: writer, body: `{"changes":[{"uuid":"a","deleted":true,"deleted_at":5}]}`, want: http.StatusOK, strategy: models.MergeLastWriter},
+		{name: "Sync failure", token: writer, body: `{}`, err: errors.New("disk full"), want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := &fakeSyncStore{changes: []models.TaskChange{{UUID: "b", Description: "Server task"}}, err: tt.err}
+			handler := controllers.NewSyncController(ss.For)
+
+			w := serve(handler, tt.token, "POST", "/", tt.body)
+
+			if w.Code != tt.want {
+				t.Fatalf("POST / = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("POST / = %s, want it to contain %s", w.Body, tt.wantBody)
+			}
+			if ss.strategy != tt.strategy {
+				t.Errorf("merged with strategy %q, want %q", ss.strategy, tt.strategy)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// SessionDuration is how long a token issued on log in stays valid
+const SessionDuration = 30 * 24 * time.Hour
+
+// UserStore is the set of store operations the users controller relies on,
+// satisfied by 'store.UserStore'
+type UserStore interface {
+	Insert(name, password string) (models.User, error)
+	Authenticate(name, password string) (models.User, error)
+	SelectByName(name string) (models.User, error)
+}
+
+// TokenStore is the set of store operations used to issue session tokens,
+// satisfied by 'store.TokenStore'
+type TokenStore interface {
+	Create(token models.Token) (string, models.Token, error)
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+func NewUsersController(users UserStore, tokens TokenStore, allowRegistration bool) *chi.Mux {
+	r := chi.NewRouter()
+	uc := UsersController{Users: users, Tokens: tokens}
+
+	if allowRegistration {
+		r.Post("/", uc.Register) // POST /users - register a new user
+	}
+	r.Post("/login", uc.Login) // POST /users/login - issue a session token
+
+	return r
+}
+
+type UsersController struct {
+	Users  UserStore
+	Tokens TokenStore
+}
+
+func (u UsersController) Register(w http.ResponseWriter, r *http.Request) {
+	data := &models.Credentials{}
+
+	if err := render.Bind(r, data); err != nil {
+		errors.Render(w, r, errors.ErrInvalidRequest(err))
+		return
+	}
+
+	user, err := u.Users.Insert(data.Name, data.Password)
+	if err != nil {
+		errors.Render(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, &user)
+}
+
+func (u UsersController) Login(w http.ResponseWriter, r *http.Request) {
+	data := &models.Credentials{}
+
+	if err := render.Bind(r, data); err != nil {
+		errors.Render(w, r, errors.ErrInvalidRequest(err))
+		return
+	}
+
+	session, err := u.Session(data.Name, data.Password)
+	if err != nil {
+		errors.Render(w, r, err)
+		return
+	}
+
+	render.Render(w, r, &session)
+}
+
+// Session checks the credentials of a user and issues a token valid for
+// 'SessionDuration', removing the tokens that expired meanwhile
+func (u UsersController) Session(name, password string) (models.Session, error) {
+	user, err := u.Users.Authenticate(name, password)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	now := time.Now()
+	if _, err := u.Tokens.DeleteExpired(now); err != nil {
+		return models.Session{}, err
+	}
+
+	expiresAt := now.Add(SessionDuration).UTC()
+	token := models.Token{
+		Name:      "session",
+		Scopes:    string(models.ScopeRead) + "," + string(models.ScopeWrite),
+		ExpiresAt: &expiresAt,
+		UserID:    &user.ID,
+	}
+
+	raw, _, err := u.Tokens.Create(token)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	return models.Session{Token: raw, ExpiresAt: expiresAt}, nil
+}
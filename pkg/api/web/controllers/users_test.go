@@ -0,0 +1,47 @@
+package controllers_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+func TestUsersController(t *testing.T) {
+	tests := []struct {
+		name         string
+		registration bool
+		tokens       fakeTokenStore
+		path         string
+		body         string
+		want         int
+		wantBody     string
+	}{
+		{name: "Register", registration: true, path: "/", body: `{"name":"carol","password":"secret"}`, want: http.StatusCreated, wantBody: `"name":"carol"`},
+		{name: "Register taken name", registration: true, path: "/", body: `{"name":"alice","password":"secret"}`, want: http.StatusConflict},
+		{name: "Register without password", registration: true, path: "/", body: `{"name":"carol"}`, want: http.StatusBadRequest},
+		{name: "Register when disabled", path: "/", body: `{"name":"carol","password":"secret"}`, want: http.StatusNotFound},
+		{name: "Log in", path: "/login", body: `{"name":"alice","password":"secret"}`, want: http.StatusOK, wantBody: `"token":"todo_session"`},
+		{name: "Log in with wrong password", path: "/login", body: `{"name":"alice","password":"nope"}`, want: http.StatusUnauthorized},
+		{name: "Log in as unknown user", path: "/login", body: `{"name":"nobody","password":"secret"}`, want: http.StatusUnauthorized},
+		{name: "Log in without name", path: "/login", body: `{"password":"secret"}`, want: http.StatusBadRequest},
+		{name: "Log in failing", tokens: fakeTokenStore{err: errors.New("disk full")}, path: "/login", body: `{"name":"alice","password":"secret"}`, want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := controllers.NewUsersController(newFakeUserStore("alice"), tt.tokens, tt.registration)
+
+			w := serve(handler, models.Token{}, "POST", tt.path, tt.body)
+
+			if w.Code != tt.want {
+				t.Fatalf("POST %s = %d, want %d: %s", tt.path, w.Code, tt.want, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("POST %s = %s, want it to contain %s", tt.path, w.Body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imgabe/todo/pkg/errors"
+)
+
+// Options lists what browsers on other origins may do with the API
+type Options struct {
+	// AllowedOrigins are the origins allowed to call the API, '*' allowing
+	// any of them
+	AllowedOrigins []string
+	// AllowedMethods are the methods cross-origin requests may use
+	AllowedMethods []string
+	// AllowedHeaders are the request headers cross-origin requests may set
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and authorization headers
+	// from the origins listed by name, never from any origin matched by '*'
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache the answer to a preflight request
+	MaxAge time.Duration
+}
+
+// allows reports whether 'value' is one of 'allowed', ignoring case when
+// 'fold' is set
+func allows(allowed []string, value string, fold bool) bool {
+	for _, candidate := range allowed {
+		if candidate == "*" || candidate == value || fold && strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listed reports whether 'origin' is one of 'allowed' by name rather than
+// through '*'
+func listed(allowed []string, origin string) bool {
+	for _, candidate := range allowed {
+		if candidate == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Handler answers preflight requests and adds the CORS headers to the
+// responses for allowed origins. Requests from other origins are served
+// without them, so browsers keep their responses from scripts, while their
+// preflight requests are rejected with 403.
+func Handler(opts Options) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			w.Header().Add("Vary", "Origin")
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !allows(opts.AllowedOrigins, origin, false) {
+				if preflight {
+					errors.Render(w, r, errors.ErrOriginNotAllowed)
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// the origin is echoed rather than '*', which browsers refuse
+			// along with credentials. These are not allowed through '*',
+			// which would let any site act on behalf of signed-in users.
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if opts.AllowCredentials && listed(opts.AllowedOrigins, origin) {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if len(opts.ExposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ", "))
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !allows(opts.AllowedMethods, r.Header.Get("Access-Control-Request-Method"), false) {
+				errors.Render(w, r, errors.ErrOriginNotAllowed)
+				return
+			}
+
+			var headers []string
+			for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+				if header = strings.TrimSpace(header); header == "" {
+					continue
+				}
+				if !allows(opts.AllowedHeaders, header, true) {
+					errors.Render(w, r, errors.ErrOriginNotAllowed)
+					return
+				}
+				headers = append(headers, header)
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(opts.AllowedMethods, ", "))
+			if len(headers) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+			}
+			if opts.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package cors_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/imgabe/todo/pkg/api/web/cors"
+)
+
+var options = cors.Options{
+	AllowedOrigins: []string{"https://app.example.com"},
+	AllowedMethods: []string{"GET", "POST", "DELETE"},
+	AllowedHeaders: []string{"Authorization", "Content-Type"},
+	ExposedHeaders: []string{"ETag"},
+	MaxAge:         time.Minute,
+}
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        cors.Options
+		method      string
+		header      []string
+		want        int
+		wantOrigin  string
+		wantHeaders map[string]string
+	}{
+		{
+			name: "Same origin", opts: options, method: "GET",
+			want: http.StatusOK,
+		},
+		{
+			name: "Allowed origin", opts: options, method: "GET",
+			header: []string{"Origin", "https://app.example.com"},
+			want:   http.StatusOK, wantOrigin: "https://app.example.com",
+			wantHeaders: map[string]string{"Access-Control-Expose-Headers": "ETag"},
+		},
+		{
+			name: "Rejected origin", opts: options, method: "GET",
+			header: []string{"Origin", "https://evil.example.com"},
+			want:   http.StatusOK,
+		},
+		{
+			name: "Any origin", opts: cors.Options{AllowedOrigins: []string{"*"}}, method: "GET",
+			header: []string{"Origin", "https://evil.example.com"},
+			want:   http.StatusOK, wantOrigin: "https://evil.example.com",
+		},
+		{
+			name: "Credentials", opts: cors.Options{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true}, method: "GET",
+			header: []string{"Origin", "https://app.example.com"},
+			want:   http.StatusOK, wantOrigin: "https://app.example.com",
+			wantHeaders: map[string]string{"Access-Control-Allow-Credentials": "true"},
+		},
+		{
+			name: "Credentials from any origin", opts: cors.Options{AllowedOrigins: []string{"*"}, AllowCredentials: true}, method: "GET",
+			header: []string{"Origin", "https://evil.example.com"},
+			want:   http.StatusOK, wantOrigin: "https://evil.example.com",
+			wantHeaders: map[string]string{"Access-Control-Allow-Credentials": ""},
+		},
+		{
+			name: "Preflight", opts: options, method: "OPTIONS",
+			header: []string{
+				"Origin", "https://app.example.com",
+				"Access-Control-Request-Method", "DELETE",
+				"Access-Control-Request-Headers", "authorization, content-type",
+			},
+			want: http.StatusNoContent, wantOrigin: "https://app.example.com",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Methods": "GET, POST, DELETE",
+				"Access-Control-Allow-Headers": "authorization, content-type",
+				"Access-Control-Max-Age":       "60",
+			},
+		},
+		{
+			name: "Preflight from rejected origin", opts: options, method: "OPTIONS",
+			header: []string{"Origin", "https://evil.example.com", "Access-Control-Request-Method", "GET"},
+			want:   http.StatusForbidden,
+		},
+		{
+			name: "Preflight for rejected method", opts: options, method: "OPTIONS",
+			header: []string{"Origin", "https://app.example.com", "Access-Control-Request-Method", "PUT"},
+			want:   http.StatusForbidden, wantOrigin: "https://app.example.com",
+		},
+		{
+			name: "Preflight for rejected header", opts: options, method: "OPTIONS",
+			header: []string{
+				"Origin", "https://app.example.com",
+				"Access-Control-Request-Method", "GET",
+				"Access-Control-Request-Headers", "X-Custom",
+			},
+			want: http.StatusForbidden, wantOrigin: "https://app.example.com",
+		},
+		{
+			name: "Options without preflight", opts: options, method: "OPTIONS",
+			header: []string{"Origin", "https://app.example.com"},
+			want:   http.StatusOK, wantOrigin: "https://app.example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/tasks", nil)
+			for i := 0; i+1 < len(tt.header); i += 2 {
+				r.Header.Set(tt.header[i], tt.header[i+1])
+			}
+
+			w := httptest.NewRecorder()
+			cors.Handler(tt.opts)(ok).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			for name, want := range tt.wantHeaders {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if w.Header().Get("Vary") != "Origin" {
+				t.Errorf("Vary = %q, want it to start with Origin", w.Header().Get("Vary"))
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/imgabe/todo/pkg/logging"
+)
+
+// OpenAPI is the OpenAPI 3 document describing the routes of NewRouter
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+//go:embed docs.html
+var docsHTML string
+
+// docsTemplate shows the operations of the document followed by the
+// document itself, so that the docs load no script from other origins
+var docsTemplate = template.Must(template.New("docs").Parse(docsHTML))
+
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(OpenAPI)
+}
+
+func serveDocs(w http.ResponseWriter, r *http.Request) {
+	page, err := renderDocs(OpenAPI)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("rendering the docs page", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+// docsOperation is an operation of the document, as listed by the docs page
+type docsOperation struct {
+	Method, Path, Summary string
+}
+
+// renderDocs renders the docs page of the OpenAPI document 'document'
+func renderDocs(document []byte) ([]byte, error) {
+	var spec struct {
+		Info struct {
+			Title   string `json:"title"`
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(document, &spec); err != nil {
+		return nil, err
+	}
+
+	var operations []docsOperation
+	for path, item := range spec.Paths {
+		for method, raw := range item {
+			if method == "parameters" {
+				continue
+			}
+
+			var op struct {
+				Summary string `json:"summary"`
+			}
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, err
+			}
+			operations = append(operations, docsOperation{Method: strings.ToUpper(method), Path: path, Summary: op.Summary})
+		}
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		if operations[i].Path != operations[j].Path {
+			return operations[i].Path < operations[j].Path
+		}
+		return operations[i].Method < operations[j].Method
+	})
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, document, "", "  "); err != nil {
+		return nil, err
+	}
+
+	var page bytes.Buffer
+	err := docsTemplate.Execute(&page, map[string]interface{}{
+		"Title":      spec.Info.Title,
+		"Version":    spec.Info.Version,
+		"Operations": operations,
+		"Document":   indented.String(),
+	})
+
+	return page.Bytes(), err
+}
@@ -0,0 +1,111 @@
+package graph
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+
+	"github.com/go-chi/render"
+	graphql "github.com/graph-gophers/graphql-go"
+	qerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/logging"
+)
+
+// Schema is the GraphQL schema served at /graphql
+//
+//go:embed schema.graphql
+var Schema string
+
+// maxDepth bounds how deeply queries may nest selections
+const maxDepth = 10
+
+// NewController returns the controller of the GraphQL API. Query expects
+// requests authenticated with a bearer token, while Subscribe also accepts
+// the token in the 'connection_init' message, as browsers cannot send
+// headers with WebSockets.
+func NewController(stores controllers.TaskStoreFor, users controllers.UserStore, subscriber controllers.Subscriber, tokens auth.TokenStore) Controller {
+	return Controller{
+		schema: graphql.MustParseSchema(Schema,
+			&Resolver{Stores: stores, Users: users, Events: subscriber},
+			graphql.UseStringDescriptions(),
+			graphql.MaxDepth(maxDepth),
+			graphql.Logger(panicLogger{}),
+		),
+		tokens: tokens,
+	}
+}
+
+// Controller serves the GraphQL API
+type Controller struct {
+	schema *graphql.Schema
+	tokens auth.TokenStore
+}
+
+// request is the body of a GraphQL request, and the payload of the
+// 'subscribe' WebSocket messages
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func (req request) Bind(r *http.Request) error {
+	if req.Query == "" {
+		return stderrors.New("missing required query")
+	}
+
+	return nil
+}
+
+// Query runs a query or a mutation. Errors raised while resolving fields
+// are part of the GraphQL response, sent with 200 like any other.
+func (c Controller) Query(w http.ResponseWriter, r *http.Request) {
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.Render(w, r, errors.ErrInvalidRequest(err))
+		return
+	}
+	if err := req.Bind(r); err != nil {
+		errors.Render(w, r, errors.ErrInvalidRequest(err))
+		return
+	}
+
+	response := c.schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+	problems(r.Context(), response.Errors)
+
+	render.JSON(w, r, response)
+}
+
+// problems describes the errors returned by resolvers like the problem
+// documents of the REST API, adding their status and title as extensions.
+// Unexpected errors are logged and reported without details.
+func problems(ctx context.Context, errs []*qerrors.QueryError) {
+	for _, err := range errs {
+		if err.ResolverError == nil {
+			continue
+		}
+
+		problem := errors.FromError(err.ResolverError)
+		if problem == errors.ErrInternal && err.ResolverError != errors.ErrInternal {
+			logging.FromContext(ctx).Error("internal error", "error", err.ResolverError, "path", err.Path)
+		}
+
+		err.Message = problem.Error()
+		err.Extensions = map[string]interface{}{
+			"status": problem.HTTPStatusCode,
+			"title":  problem.StatusText,
+		}
+	}
+}
+
+// panicLogger logs the panics recovered while resolving fields
+type panicLogger struct{}
+
+func (panicLogger) LogPanic(ctx context.Context, value interface{}) {
+	logging.FromContext(ctx).Error("graphql resolver panicked", "panic", value)
+}
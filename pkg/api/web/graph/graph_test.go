@@ -0,0 +1,256 @@
+package graph_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/api/web/graph"
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/imgabe/todo/pkg/store/storetest"
+)
+
+// testServer serves the GraphQL API from a storetest.Fixture, and returns
+// the task store of alice along with her tokens with every scope and with
+// only the read scope
+func testServer(t *testing.T) (*httptest.Server, store.TaskStore, string, string) {
+	t.Helper()
+
+	f := storetest.New(t)
+	broker := events.NewBroker()
+	t.Cleanup(broker.Close)
+
+	ts := store.TaskStore{DB: f.DB, Events: broker}
+	us := store.UserStore{DB: f.DB}
+	tks := store.TokenStore{DB: f.DB}
+
+	stores := func(ctx context.Context, ownerID int64) controllers.TaskStore { return ts.ForOwner(ownerID) }
+	gc := graph.NewController(stores, us, broker, tks)
+	r := chi.NewRouter()
+	r.With(auth.Authenticate(tks)).Post("/", gc.Query)
+	r.With(auth.AuthenticateOptional(tks)).Get("/", gc.Subscribe)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	return srv, ts.ForOwner(f.Alice.ID), f.Admin, f.Reader
+}
+
+func post(t *testing.T, srv *httptest.Server, token, query string) (int, string) {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]string{"query": query})
+	req, _ := http.NewRequest("POST", srv.URL+"/", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	data, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(data)
+}
+
+func TestController_Query(t *testing.T) {
+	srv, _, admin, reader := testServer(t)
+
+	tests := []struct {
+		name  string
+		token string
+		query string
+		want  int
+		body  string
+	}{
+		{name: "Add", token: admin, query: `mutation { addTask(description: "Buy milk") { id description done version } }`, want: 200, body: `"addTask":{"id":"1","description":"Buy milk","done":false,"version":1}`},
+		{name: "Add another", token: admin, query: `mutation { addTask(description: "Walk the dog") { id } }`, want: 200, body: `"addTask":{"id":"2"}`},
+		{name: "Add a third", token: admin, query: `mutation { addTask(description: "Buy bread") { id } }`, want: 200, body: `"addTask":{"id":"3"}`},
+		{name: "Add with read scope", token: reader, query: `mutation { addTask(description: "Nope") { id } }`, want: 200, body: `"extensions":{"status":403`},
+		{name: "Add without description", token: admin, query: `mutation { addTask(description: "") { id } }`, want: 200, body: `"extensions":{"status":400`},
+		{name: "Search", token: reader, query: `{ tasks(filter: {search: "BUY"}) { totalCount edges { node { id } } } }`, want: 200, body: `{"totalCount":2,"edges":[{"node":{"id":"1"}},{"node":{"id":"3"}}]}`},
+		{name: "First page", token: reader, query: `{ tasks(first: 1) { edges { cursor } pageInfo { hasNextPage endCursor } } }`, want: 200, body: `"pageInfo":{"hasNextPage":true,"endCursor":"dGFzazox"}`},
+		{name: "Next page", token: reader, query: `{ tasks(first: 1, after: "dGFzazox") { edges { node { id } } } }`, want: 200, body: `"edges":[{"node":{"id":"2"}}]`},
+		{name: "Last page", token: reader, query: `{ tasks(after: "dGFzazoy") { edges { node { id } } pageInfo { hasNextPage } } }`, want: 200, body: `{"edges":[{"node":{"id":"3"}}],"pageInfo":{"hasNextPage":false}}`},
+		{name: "Invalid cursor", token: reader, query: `{ tasks(after: "nope") { totalCount } }`, want: 200, body: `"extensions":{"status":400`},
+		{name: "Page too large", token: reader, query: `{ tasks(first: 500) { totalCount } }`, want: 200, body: `"extensions":{"status":400`},
+		{name: "Check", token: admin, query: `mutation { checkTask(id: 1, version: 1) { done version } }`, want: 200, body: `"checkTask":{"done":true,"version":2}`},
+		{name: "Check stale version", token: admin, query: `mutation { checkTask(id: 1, version: 1) { done } }`, want: 200, body: `"extensions":{"status":412`},
+		{name: "Done tasks", token: reader, query: `{ tasks(filter: {done: true}) { totalCount } }`, want: 200, body: `"totalCount":1`},
+		{name: "Open tasks", token: reader, query: `{ tasks(filter: {done: false}) { totalCount } }`, want: 200, body: `"totalCount":2`},
+		{name: "Update", token: admin, query: `mutation { updateTask(id: 1, version: 2, description: "Buy oat milk", done: false) { description done version } }`, want: 200, body: `"updateTask":{"description":"Buy oat milk","done":false,"version":3}`},
+		{name: "Read", token: reader, query: `{ task(id: 1) { description } }`, want: 200, body: `"task":{"description":"Buy oat milk"}`},
+		{name: "Read non-existent", token: reader, query: `{ task(id: 99) { description } }`, want: 200, body: `{"data":{"task":null}}`},
+		{name: "Delete stale version", token: admin, query: `mutation { deleteTask(id: 2, version: 7) { id } }`, want: 200, body: `"extensions":{"status":412`},
+		{name: "Delete", token: admin, query: `mutation { deleteTask(id: 2, version: 1) { description } }`, want: 200, body: `"deleteTask":{"description":"Walk the dog"}`},
+		{name: "Delete again", token: admin, query: `mutation { deleteTask(id: 2, version: 1) { id } }`, want: 200, body: `"extensions":{"status":404`},
+		{name: "Unknown owner", token: reader, query: `{ tasks(filter: {owner: "nobody"}) { totalCount } }`, want: 200, body: `"extensions":{"status":404`},
+		{name: "Unknown field", token: reader, query: `{ tasks { nope } }`, want: 200, body: `"errors":[{"message":"Cannot query field \"nope\"`},
+		{name: "Without token", token: "", query: `{ tasks { totalCount } }`, want: 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := post(t, srv, tt.token, tt.query)
+			if status != tt.want {
+				t.Fatalf("status = %d, want %d: %s", status, tt.want, body)
+			}
+			if !strings.Contains(body, tt.body) {
+				t.Errorf("body = %s, want it to contain %s", body, tt.body)
+			}
+		})
+	}
+}
+
+// dial opens a graphql-transport-ws connection, authenticated with 'token'
+// unless it is empty
+func dial(t *testing.T, srv *httptest.Server, token string) *websocket.Conn {
+	t.Helper()
+
+	dialer := websocket.Dialer{Subprotocols: []string{graph.Subprotocol}}
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	return conn
+}
+
+type message struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func send(t *testing.T, conn *websocket.Conn, msg message) {
+	t.Helper()
+
+	if err := conn.WriteJSON(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receive(t *testing.T, conn *websocket.Conn) message {
+	t.Helper()
+
+	var msg message
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+
+	return msg
+}
+
+func TestController_Subscribe(t *testing.T) {
+	srv, ts, _, reader := testServer(t)
+	conn := dial(t, srv, reader)
+
+	send(t, conn, message{Type: "connection_init"})
+	if msg := receive(t, conn); msg.Type != "connection_ack" {
+		t.Fatalf("got %+v, want connection_ack", msg)
+	}
+
+	send(t, conn, message{ID: "1", Type: "subscribe", Payload: json.RawMessage(`{"query":"subscription { taskChanged(types: [CREATED]) { type task { description } } }"}`)})
+
+	// the subscription starts in the background, so tasks are added until
+	// one of them is seen
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				task, err := ts.Insert(models.Task{Description: "Task"})
+				if err == nil {
+					ts.Update(task)
+				}
+			}
+		}
+	}()
+
+	msg := receive(t, conn)
+	if msg.Type != "next" || msg.ID != "1" {
+		t.Fatalf("got %+v, want next for 1", msg)
+	}
+	if want := `{"data":{"taskChanged":{"type":"CREATED","task":{"description":"Task"}}}}`; string(msg.Payload) != want {
+		t.Errorf("payload = %s, want %s", msg.Payload, want)
+	}
+
+	send(t, conn, message{ID: "1", Type: "complete"})
+	send(t, conn, message{ID: "2", Type: "subscribe", Payload: json.RawMessage(`{"query":"subscription { nope }"}`)})
+
+	// events of the completed subscription sent in the meantime are skipped
+	for {
+		msg = receive(t, conn)
+		if msg.ID != "1" {
+			break
+		}
+	}
+	if msg.Type != "error" || msg.ID != "2" || !strings.Contains(string(msg.Payload), "nope") {
+		t.Errorf("got %+v, want error for 2", msg)
+	}
+}
+
+func TestController_SubscribeBeforeInit(t *testing.T) {
+	srv, _, _, reader := testServer(t)
+	conn := dial(t, srv, reader)
+
+	send(t, conn, message{ID: "1", Type: "subscribe", Payload: json.RawMessage(`{"query":"subscription { taskChanged { type } }"}`)})
+
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, 4401) {
+		t.Errorf("got %v, want close 4401", err)
+	}
+}
+
+func TestController_SubscribeInitToken(t *testing.T) {
+	srv, _, _, reader := testServer(t)
+
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{name: "Valid token", payload: `{"token":"` + reader + `"}`, want: "connection_ack"},
+		{name: "Unknown token", payload: `{"token":"nope"}`, want: "4401"},
+		{name: "Without token", payload: ``, want: "4401"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dial(t, srv, "")
+
+			msg := message{Type: "connection_init"}
+			if tt.payload != "" {
+				msg.Payload = json.RawMessage(tt.payload)
+			}
+			send(t, conn, msg)
+
+			var got message
+			err := conn.ReadJSON(&got)
+			switch {
+			case tt.want == "connection_ack" && (err != nil || got.Type != tt.want):
+				t.Errorf("got %+v, %v, want %s", got, err, tt.want)
+			case tt.want == "4401" && !websocket.IsCloseError(err, 4401):
+				t.Errorf("got %+v, %v, want close 4401", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+const (
+	// pageSize is how many tasks a page holds unless asked otherwise
+	pageSize = 50
+	// maxPageSize bounds how many tasks a single page holds
+	maxPageSize = 100
+)
+
+// Resolver resolves the root fields of the schema through the same stores
+// as 'controllers.TasksController', on behalf of the user of the token
+type Resolver struct {
+	Stores controllers.TaskStoreFor
+	Users  controllers.UserStore
+	Events controllers.Subscriber
+}
+
+// store returns the task store of the user making the request, once its
+// token is known to grant 'scope'
+func (r *Resolver) store(ctx context.Context, scope models.Scope) (controllers.TaskStore, error) {
+	token, ok := ctx.Value(auth.TokenContextKey).(models.Token)
+	if !ok {
+		return nil, errors.ErrUnauthorized
+	}
+	if !token.HasScope(scope) {
+		return nil, errors.ErrForbidden
+	}
+
+	return r.Stores(ctx, auth.OwnerID(ctx)), nil
+}
+
+// taskID reads the ID of a task, unknown IDs being reported as missing
+func taskID(id graphql.ID) (int64, error) {
+	taskID, err := strconv.ParseInt(string(id), 10, 64)
+	if err != nil {
+		return 0, errors.ErrNotFound
+	}
+
+	return taskID, nil
+}
+
+// cursor returns the opaque position of a task within a connection
+func cursor(task models.Task) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("task:" + strconv.FormatInt(task.ID, 10)))
+}
+
+// afterCursor returns the ID of the task a cursor points to
+func afterCursor(cursor string) (int64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil && strings.HasPrefix(string(data), "task:") {
+		return strconv.ParseInt(strings.TrimPrefix(string(data), "task:"), 10, 64)
+	}
+
+	return 0, fmt.Errorf("invalid cursor '%s'", cursor)
+}
+
+type taskFilter struct {
+	Done         *bool
+	AssignedToMe *bool
+	Owner        *string
+	Search       *string
+}
+
+// match reports whether a task passes the filters applied after reading
+func (f taskFilter) match(task models.Task) bool {
+	if f.Done != nil && task.Done != *f.Done {
+		return false
+	}
+	if f.Search != nil && !strings.Contains(strings.ToLower(task.Description), strings.ToLower(*f.Search)) {
+		return false
+	}
+
+	return true
+}
+
+// Tasks reads the tasks like 'GET /tasks', then filters and pages them
+func (r *Resolver) Tasks(ctx context.Context, args struct {
+	Filter *taskFilter
+	First  *int32
+	After  *string
+}) (*connectionResolver, error) {
+	ts, err := r.store(ctx, models.ScopeRead)
+	if err != nil {
+		return nil, err
+	}
+
+	var filter taskFilter
+	if args.Filter != nil {
+		filter = *args.Filter
+	}
+
+	var tasks []models.Task
+	switch {
+	case filter.AssignedToMe != nil && *filter.AssignedToMe:
+		tasks, err = ts.SelectAssigned(true, models.Page{})
+	case filter.Owner != nil:
+		owner, ownerErr := r.Users.SelectByName(*filter.Owner)
+		if ownerErr != nil {
+			return nil, ownerErr
+		}
+
+		tasks, err = ts.SelectShared(owner.ID, true, models.Page{})
+	default:
+		tasks, err = ts.SelectAll(true, models.Page{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	first := pageSize
+	if args.First != nil {
+		if *args.First < 0 || *args.First > maxPageSize {
+			return nil, errors.ErrInvalidRequest(fmt.Errorf("first must be between 0 and %d", maxPageSize))
+		}
+		first = int(*args.First)
+	}
+
+	var after int64
+	if args.After != nil {
+		if after, err = afterCursor(*args.After); err != nil {
+			return nil, errors.ErrInvalidRequest(err)
+		}
+	}
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+
+	conn := &connectionResolver{}
+	for _, task := range tasks {
+		if !filter.match(task) {
+			continue
+		}
+
+		conn.total++
+		if task.ID <= after {
+			continue
+		}
+		if len(conn.tasks) == first {
+			conn.hasNext = true
+			continue
+		}
+		conn.tasks = append(conn.tasks, task)
+	}
+
+	return conn, nil
+}
+
+// Task reads a single task like 'GET /tasks/{taskID}', resolving to null
+// when it cannot be found
+func (r *Resolver) Task(ctx context.Context, args struct{ ID graphql.ID }) (*taskResolver, error) {
+	ts, err := r.store(ctx, models.ScopeRead)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := taskID(args.ID)
+	if err != nil {
+		return nil, nil
+	}
+
+	task, err := ts.Select(models.Task{ID: id})
+	if err != nil {
+		if errors.FromError(err) == errors.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &taskResolver{task}, nil
+}
+
+func (r *Resolver) AddTask(ctx context.Context, args struct{ Description string }) (*taskResolver, error) {
+	ts, err := r.store(ctx, models.ScopeWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	task := models.Task{Description: args.Description}
+	if err := task.Bind(nil); err != nil {
+		return nil, errors.ErrInvalidRequest(err)
+	}
+
+	task, err = ts.Insert(task)
+	if err != nil {
+		return nil, err
+	}
+
+	return &taskResolver{task}, nil
+}
+
+// update applies 'patch' to the task 'id', failing when the task is no
+// longer at 'version'
+func (r *Resolver) update(ctx context.Context, id graphql.ID, version int32, patch models.TaskPatch) (*taskResolver, error) {
+	ts, err := r.store(ctx, models.ScopeWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := patch.Bind(nil); err != nil {
+		return nil, errors.ErrInvalidRequest(err)
+	}
+
+	taskID, err := taskID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := ts.Select(models.Task{ID: taskID})
+	if err != nil {
+		return nil, err
+	}
+	task.Version = int64(version)
+
+	task, err = ts.Update(patch.Apply(task))
+	if err != nil {
+		return nil, err
+	}
+
+	return &taskResolver{task}, nil
+}
+
+func (r *Resolver) UpdateTask(ctx context.Context, args struct {
+	ID          graphql.ID
+	Version     int32
+	Description *string
+	Done        *bool
+}) (*taskResolver, error) {
+	return r.update(ctx, args.ID, args.Version, models.TaskPatch{Description: args.Description, Done: args.Done})
+}
+
+func (r *Resolver) CheckTask(ctx context.Context, args struct {
+	ID      graphql.ID
+	Version int32
+	Done    *bool
+}) (*taskResolver, error) {
+	done := args.Done == nil || *args.Done
+	return r.update(ctx, args.ID, args.Version, models.TaskPatch{Done: &done})
+}
+
+func (r *Resolver) DeleteTask(ctx context.Context, args struct {
+	ID      graphql.ID
+	Version int32
+}) (*taskResolver, error) {
+	ts, err := r.store(ctx, models.ScopeWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	taskID, err := taskID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := ts.Select(models.Task{ID: taskID})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ts.DeleteVersion(taskID, int64(args.Version)); err != nil {
+		return nil, err
+	}
+
+	return &taskResolver{task}, nil
+}
+
+// TaskChanged sends the events of the tasks the user may read until the
+// subscription ends or the server shuts down
+func (r *Resolver) TaskChanged(ctx context.Context, args struct{ Types *[]string }) (<-chan *eventResolver, error) {
+	ts, err := r.store(ctx, models.ScopeRead)
+	if err != nil {
+		return nil, err
+	}
+
+	types := make(map[events.Type]bool)
+	if args.Types != nil {
+		for _, t := range *args.Types {
+			types[events.Type(strings.ToLower(t))] = true
+		}
+	}
+
+	ch, cancel := r.Events.Subscribe()
+	out := make(chan *eventResolver)
+
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-ch:
+				if !ok {
+					return
+				}
+				if len(types) > 0 && !types[event.Type] {
+					continue
+				}
+				if visible, err := ts.CanRead(event.Task); err != nil || !visible {
+					continue
+				}
+
+				select {
+				case out <- &eventResolver{event}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+type taskResolver struct {
+	task models.Task
+}
+
+// userID returns the ID of a user column, null for the local user
+func userID(id *int64) *graphql.ID {
+	if id == nil {
+		return nil
+	}
+
+	gid := graphql.ID(strconv.FormatInt(*id, 10))
+	return &gid
+}
+
+func (t *taskResolver) ID() graphql.ID {
+	return graphql.ID(strconv.FormatInt(t.task.ID, 10))
+}
+
+func (t *taskResolver) Description() string {
+	return t.task.Description
+}
+
+func (t *taskResolver) Done() bool {
+	return t.task.Done
+}
+
+func (t *taskResolver) OwnerId() *graphql.ID {
+	return userID(t.task.OwnerID)
+}
+
+func (t *taskResolver) AssigneeId() *graphql.ID {
+	return userID(t.task.AssigneeID)
+}
+
+func (t *taskResolver) Version() int32 {
+	return int32(t.task.Version)
+}
+
+type connectionResolver struct {
+	tasks   []models.Task
+	total   int
+	hasNext bool
+}
+
+func (c *connectionResolver) Edges() []*edgeResolver {
+	edges := make([]*edgeResolver, len(c.tasks))
+	for i, task := range c.tasks {
+		edges[i] = &edgeResolver{task}
+	}
+
+	return edges
+}
+
+func (c *connectionResolver) PageInfo() *pageInfoResolver {
+	info := &pageInfoResolver{hasNext: c.hasNext}
+	if len(c.tasks) > 0 {
+		end := cursor(c.tasks[len(c.tasks)-1])
+		info.end = &end
+	}
+
+	return info
+}
+
+func (c *connectionResolver) TotalCount() int32 {
+	return int32(c.total)
+}
+
+type edgeResolver struct {
+	task models.Task
+}
+
+func (e *edgeResolver) Cursor() string {
+	return cursor(e.task)
+}
+
+func (e *edgeResolver) Node() *taskResolver {
+	return &taskResolver{e.task}
+}
+
+type pageInfoResolver struct {
+	hasNext bool
+	end     *string
+}
+
+func (p *pageInfoResolver) HasNextPage() bool {
+	return p.hasNext
+}
+
+func (p *pageInfoResolver) EndCursor() *string {
+	return p.end
+}
+
+type eventResolver struct {
+	event events.Event
+}
+
+func (e *eventResolver) Type() string {
+	return strings.ToUpper(string(e.event.Type))
+}
+
+func (e *eventResolver) Task() *taskResolver {
+	return &taskResolver{e.event.Task}
+}
+
+func (e *eventResolver) Time() string {
+	return e.event.Time.Format(time.RFC3339Nano)
+}
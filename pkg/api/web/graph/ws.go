@@ -0,0 +1,303 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// Subprotocol is the WebSocket subprotocol subscriptions are run with
+const Subprotocol = "graphql-transport-ws"
+
+const (
+	// initTimeout is how long clients have to send 'connection_init'
+	initTimeout = 10 * time.Second
+	// heartbeatInterval is how often idle connections are pinged
+	heartbeatInterval = 30 * time.Second
+)
+
+// close codes of the graphql-transport-ws protocol
+const (
+	closeBadRequest     = 4400
+	closeUnauthorized   = 4401
+	closeInitTimeout    = 4408
+	closeDuplicateID    = 4409
+	closeTooManyInits   = 4429
+	closeMessageTimeout = time.Second
+)
+
+// message types of the graphql-transport-ws protocol
+const (
+	messageConnectionInit = "connection_init"
+	messageConnectionAck  = "connection_ack"
+	messagePing           = "ping"
+	messagePong           = "pong"
+	messageSubscribe      = "subscribe"
+	messageNext           = "next"
+	messageError          = "error"
+	messageComplete       = "complete"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	Subprotocols:    []string{Subprotocol},
+}
+
+type message struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// operation is a subscription run over a WebSocket
+type operation struct {
+	id   string
+	stop context.CancelFunc
+}
+
+// conn serializes the writes of the operations sharing a WebSocket
+type conn struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *conn) send(id, typ string, payload interface{}) error {
+	msg := message{ID: id, Type: typ}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		msg.Payload = data
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ws.SetWriteDeadline(time.Now().Add(heartbeatInterval))
+	return c.ws.WriteJSON(msg)
+}
+
+func (c *conn) close(code int, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	msg := websocket.FormatCloseMessage(code, reason)
+	c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeMessageTimeout))
+}
+
+func (c *conn) ping() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(heartbeatInterval))
+}
+
+// initPayload is the payload of 'connection_init', holding the token of
+// clients that could not authenticate the request upgraded to a WebSocket
+type initPayload struct {
+	Token string `json:"token"`
+}
+
+// Subscribe runs the operations sent over a WebSocket with the
+// graphql-transport-ws protocol, sending the results of each one until it
+// completes or the client stops it. Unless the request was authenticated,
+// the token is read from the 'connection_init' payload.
+func (c Controller) Subscribe(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	if ws.Subprotocol() != Subprotocol {
+		msg := websocket.FormatCloseMessage(websocket.CloseProtocolError, "unsupported subprotocol, expected "+Subprotocol)
+		ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeMessageTimeout))
+		return
+	}
+
+	// cancelling the context stops every operation of the connection
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(r.Context())
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	// operations run with the token of the connection, once known
+	opsCtx := ctx
+	_, authenticated := ctx.Value(auth.TokenContextKey).(models.Token)
+
+	conn := &conn{ws: ws}
+	messages := make(chan message)
+	go func() {
+		defer close(messages)
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			// messages that cannot be read have no type, closing the
+			// connection as invalid
+			var msg message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				msg = message{}
+			}
+
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	initialized := false
+	initTimer := time.NewTimer(initTimeout)
+	defer initTimer.Stop()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	operations := make(map[string]*operation)
+	done := make(chan *operation)
+
+	for {
+		select {
+		case <-initTimer.C:
+			if !initialized {
+				conn.close(closeInitTimeout, "Connection initialisation timeout")
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.ping(); err != nil {
+				return
+			}
+		case op := <-done:
+			// the ID may have been reused once the operation was stopped
+			if operations[op.id] == op {
+				delete(operations, op.id)
+			}
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			switch msg.Type {
+			case messageConnectionInit:
+				if initialized {
+					conn.close(closeTooManyInits, "Too many initialisation requests")
+					return
+				}
+				if !authenticated {
+					var payload initPayload
+					json.Unmarshal(msg.Payload, &payload)
+
+					token, err := auth.Check(c.tokens, payload.Token)
+					if err != nil {
+						conn.close(closeUnauthorized, "Unauthorized")
+						return
+					}
+					opsCtx = context.WithValue(ctx, auth.TokenContextKey, token)
+				}
+				initialized = true
+				conn.send("", messageConnectionAck, nil)
+			case messagePing:
+				conn.send("", messagePong, nil)
+			case messagePong:
+			case messageSubscribe:
+				if !initialized {
+					conn.close(closeUnauthorized, "Unauthorized")
+					return
+				}
+
+				var req request
+				if msg.ID == "" || json.Unmarshal(msg.Payload, &req) != nil || req.Bind(r) != nil {
+					conn.close(closeBadRequest, "Invalid subscribe message")
+					return
+				}
+				if _, ok := operations[msg.ID]; ok {
+					conn.close(closeDuplicateID, "Subscriber for "+msg.ID+" already exists")
+					return
+				}
+
+				opCtx, stop := context.WithCancel(opsCtx)
+				op := &operation{id: msg.ID, stop: stop}
+				operations[op.id] = op
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					c.run(opCtx, conn, op, req)
+
+					select {
+					case done <- op:
+					case <-ctx.Done():
+					}
+				}()
+			case messageComplete:
+				if op, ok := operations[msg.ID]; ok {
+					op.stop()
+					delete(operations, msg.ID)
+				}
+			default:
+				conn.close(closeBadRequest, "Invalid message type")
+				return
+			}
+		}
+	}
+}
+
+// run sends the results of an operation to the client, followed by
+// 'complete' unless the client stopped it
+func (c Controller) run(ctx context.Context, conn *conn, op *operation, req request) {
+	id := op.id
+
+	responses, err := c.schema.Subscribe(ctx, req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		conn.send(id, messageError, []map[string]string{{"message": err.Error()}})
+		return
+	}
+
+	// the schema stops resolving once the operation is stopped, but its
+	// goroutines only end once the remaining results are read
+	defer func() {
+		for range responses {
+		}
+	}()
+	defer op.stop()
+
+	first := true
+	for response := range responses {
+		response, ok := response.(*graphql.Response)
+		if !ok {
+			continue
+		}
+		problems(ctx, response.Errors)
+
+		// errors found before running the operation, such as validation
+		// errors, end it without results
+		if first && response.Data == nil && len(response.Errors) > 0 {
+			conn.send(id, messageError, response.Errors)
+			return
+		}
+		first = false
+
+		if err := conn.send(id, messageNext, response); err != nil {
+			return
+		}
+	}
+
+	if ctx.Err() == nil {
+		conn.send(id, messageComplete, nil)
+	}
+}
@@ -0,0 +1,211 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/logging"
+	"github.com/imgabe/todo/pkg/metrics"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// readyTimeout bounds how long /readyz waits for the database
+const readyTimeout = 2 * time.Second
+
+// Database is the connection pool checked by /readyz and reported by
+// /metrics, satisfied by '*sqlx.DB'
+type Database interface {
+	PingContext(ctx context.Context) error
+	Stats() sql.DBStats
+}
+
+// TaskCounter counts the tasks of every user for /metrics, satisfied by
+// 'store.TaskStore'
+type TaskCounter interface {
+	CountAll() (open int64, done int64, err error)
+}
+
+// serveHealth answers as long as the process is up
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// serveReady answers once the database can be reached
+func serveReady(db Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db != nil {
+			ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+			defer cancel()
+
+			if err := db.PingContext(ctx); err != nil {
+				logging.FromContext(r.Context()).Error("readiness check failed", "error", err)
+				errors.Render(w, r, errors.ErrUnavailable)
+				return
+			}
+		}
+
+		serveHealth(w, r)
+	}
+}
+
+// newMetrics registers the metrics of the database and of the tasks, read
+// on every scrape
+func newMetrics(db Database, tasks TaskCounter) *metrics.Registry {
+	reg := metrics.NewRegistry()
+
+	if tasks != nil {
+		count := reg.NewGauge("todo_tasks", "Tasks of every user by state.", "state")
+		reg.OnCollect(func() {
+			open, done, err := tasks.CountAll()
+			if err != nil {
+				logging.Default().Error("counting tasks for metrics", "error", err)
+				return
+			}
+
+			count.Set(float64(open), "open")
+			count.Set(float64(done), "done")
+		})
+	}
+
+	if db != nil {
+		maxOpen := reg.NewGauge("todo_db_max_open_connections", "Maximum number of open connections to the database.")
+		open := reg.NewGauge("todo_db_open_connections", "Established connections to the database.")
+		inUse := reg.NewGauge("todo_db_in_use_connections", "Connections to the database currently in use.")
+		idle := reg.NewGauge("todo_db_idle_connections", "Idle connections to the database.")
+		waits := reg.NewCounter("todo_db_wait_count_total", "Connections waited for.")
+		waited := reg.NewCounter("todo_db_wait_duration_seconds_total", "Time spent waiting for connections.")
+		reg.OnCollect(func() {
+			stats := db.Stats()
+
+			maxOpen.Set(float64(stats.MaxOpenConnections))
+			open.Set(float64(stats.OpenConnections))
+			inUse.Set(float64(stats.InUse))
+			idle.Set(float64(stats.Idle))
+			waits.Set(float64(stats.WaitCount))
+			waited.Set(stats.WaitDuration.Seconds())
+		})
+	}
+
+	return reg
+}
+
+// instrument counts requests and measures their latency by route pattern,
+// so '/tasks/1' and '/tasks/2' share a series
+func instrument(reg *metrics.Registry) func(http.Handler) http.Handler {
+	requests := reg.NewCounter("todo_http_requests_total", "HTTP requests by route and status.", "method", "route", "status")
+	durations := reg.NewHistogram("todo_http_request_duration_seconds", "Latency of HTTP requests by route.", metrics.DefaultBuckets, "method", "route")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r)
+
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			method := methodLabel(r.Method)
+			requests.Inc(method, route, strconv.Itoa(status))
+			durations.Observe(time.Since(start).Seconds(), method, route)
+		})
+	}
+}
+
+// methodLabel returns 'method' if it is a standard HTTP method, and "OTHER"
+// otherwise, so that clients can't create series at will
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+
+	return "OTHER"
+}
+
+// instrumentTasks measures the latency of every task store operation
+func instrumentTasks(stores controllers.TaskStoreFor, reg *metrics.Registry) controllers.TaskStoreFor {
+	durations := reg.NewHistogram("todo_store_operation_duration_seconds", "Latency of store operations.", metrics.DefaultBuckets, "store", "operation")
+
+	return func(ctx context.Context, ownerID int64) controllers.TaskStore {
+		return instrumentedTaskStore{
+			TaskStore: stores(ctx, ownerID),
+			durations: durations,
+		}
+	}
+}
+
+// instrumentedTaskStore times the calls to the task store it wraps
+type instrumentedTaskStore struct {
+	controllers.TaskStore
+	durations *metrics.Histogram
+}
+
+func (s instrumentedTaskStore) observe(operation string, start time.Time) {
+	s.durations.Observe(time.Since(start).Seconds(), "task", operation)
+}
+
+func (s instrumentedTaskStore) Insert(task models.Task) (models.Task, error) {
+	defer s.observe("insert", time.Now())
+	return s.TaskStore.Insert(task)
+}
+
+func (s instrumentedTaskStore) Update(task models.Task) (models.Task, error) {
+	defer s.observe("update", time.Now())
+	return s.TaskStore.Update(task)
+}
+
+func (s instrumentedTaskStore) Delete(taskID int64) error {
+	defer s.observe("delete", time.Now())
+	return s.TaskStore.Delete(taskID)
+}
+
+func (s instrumentedTaskStore) DeleteVersion(taskID int64, version int64) error {
+	defer s.observe("delete", time.Now())
+	return s.TaskStore.DeleteVersion(taskID, version)
+}
+
+func (s instrumentedTaskStore) Select(task models.Task) (models.Task, error) {
+	defer s.observe("select", time.Now())
+	return s.TaskStore.Select(task)
+}
+
+func (s instrumentedTaskStore) SelectAll(done bool, page models.Page) ([]models.Task, error) {
+	defer s.observe("select_all", time.Now())
+	return s.TaskStore.SelectAll(done, page)
+}
+
+func (s instrumentedTaskStore) SelectAssigned(done bool, page models.Page) ([]models.Task, error) {
+	defer s.observe("select_assigned", time.Now())
+	return s.TaskStore.SelectAssigned(done, page)
+}
+
+func (s instrumentedTaskStore) SelectShared(ownerID int64, done bool, page models.Page) ([]models.Task, error) {
+	defer s.observe("select_shared", time.Now())
+	return s.TaskStore.SelectShared(ownerID, done, page)
+}
+
+func (s instrumentedTaskStore) Assign(taskID int64, assigneeID int64) (models.Task, error) {
+	defer s.observe("assign", time.Now())
+	return s.TaskStore.Assign(taskID, assigneeID)
+}
+
+func (s instrumentedTaskStore) CanRead(task models.Task) (bool, error) {
+	defer s.observe("can_read", time.Now())
+	return s.TaskStore.CanRead(task)
+}
@@ -0,0 +1,84 @@
+package web_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/imgabe/todo/pkg/api/web"
+	"github.com/imgabe/todo/pkg/config"
+)
+
+// downDatabase fails every ping
+type downDatabase struct{}
+
+func (downDatabase) PingContext(ctx context.Context) error { return errors.New("database is down") }
+func (downDatabase) Stats() sql.DBStats                    { return sql.DBStats{} }
+
+func TestNewRouter_Ready(t *testing.T) {
+	tests := []struct {
+		name string
+		db   web.Database
+		want int
+	}{
+		{name: "Without database", want: http.StatusOK},
+		{name: "Database down", db: downDatabase{}, want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := web.NewRouter(web.Stores{Database: tt.db}, config.Default().Web)
+
+			for _, path := range []string{"/healthz", "/readyz"} {
+				want := http.StatusOK
+				if path == "/readyz" {
+					want = tt.want
+				}
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+				if w.Code != want {
+					t.Errorf("GET %s = %d, want %d", path, w.Code, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRouter_Metrics(t *testing.T) {
+	router, admin, _ := testServer(t)
+
+	send := func(method, path, body string) {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+admin)
+		r.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	send("POST", "/tasks", `{"description":"Task"}`)
+	send("GET", "/tasks/1", "")
+	send("GET", "/tasks/2", "")
+	send("BREW", "/tasks/1", "")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	for _, want := range []string{
+		`todo_http_requests_total{method="POST",route="/tasks/",status="201"} 1`,
+		`todo_http_requests_total{method="GET",route="/tasks/{taskID}/",status="200"} 1`,
+		`todo_http_requests_total{method="GET",route="/tasks/{taskID}/",status="404"} 1`,
+		`todo_http_request_duration_seconds_count{method="GET",route="/tasks/{taskID}/"} 2`,
+		`todo_http_request_duration_seconds_count{method="OTHER",route="unmatched"} 1`,
+		`todo_store_operation_duration_seconds_count{store="task",operation="insert"} 1`,
+		`todo_tasks{state="open"} 1`,
+		`todo_tasks{state="done"} 0`,
+		`todo_db_max_open_connections 1`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, w.Body)
+		}
+	}
+}
@@ -1,38 +1,207 @@
 package web
 
 import (
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
+	"github.com/imgabe/todo/pkg/api/web/auth"
 	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/api/web/cors"
+	"github.com/imgabe/todo/pkg/api/web/graph"
+	"github.com/imgabe/todo/pkg/api/web/idempotency"
+	"github.com/imgabe/todo/pkg/api/web/limit"
+	"github.com/imgabe/todo/pkg/api/web/ui"
+	"github.com/imgabe/todo/pkg/config"
+	"github.com/imgabe/todo/pkg/logging"
+	"github.com/imgabe/todo/pkg/models"
 )
 
-func NewRouter() *chi.Mux {
+// TokenStore is the set of token operations the router relies on
+type TokenStore interface {
+	auth.TokenStore
+	controllers.TokenStore
+	ui.TokenStore
+}
+
+// Stores holds the stores requests are served from
+type Stores struct {
+	Tasks  controllers.TaskStoreFor
+	Tokens TokenStore
+	Users  controllers.UserStore
+	Shares controllers.ShareStore
+	Sync   controllers.SyncStoreFor
+	Events controllers.Subscriber
+	// Idempotency records the responses to requests sent with an
+	// 'Idempotency-Key' header
+	Idempotency idempotency.Store
+	// Database is checked by /readyz, and along with TaskCounts reported
+	// by /metrics
+	Database   Database
+	TaskCounts TaskCounter
+}
+
+func NewRouter(stores Stores, cfg config.Web) *chi.Mux {
 	r := chi.NewRouter()
+	reg := newMetrics(stores.Database, stores.TaskCounts)
+	stores.Tasks = instrumentTasks(stores.Tasks, reg)
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(limit.RealIP(cfg.TrustedProxies))
+	r.Use(logRequests(logging.Default()))
 	r.Use(middleware.Recoverer)
+	r.Use(instrument(reg))
+	// preflight requests carry no token, so they are answered before
+	// authentication and rate limiting
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.CORS.ExposedHeaders,
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           cfg.CORS.MaxAge.Duration,
+	}))
+	if cfg.MaxBodySize > 0 {
+		r.Use(limit.MaxBodySize(cfg.MaxBodySize))
+	}
+
+	// clients are limited by address until they authenticate, then by token,
+	// so users sharing an address do not share a quota. Failed
+	// authentications are charged to the address, before the token is
+	// looked up.
+	rateLimit := func(key func(*http.Request) string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	rateLimitFailures := rateLimit
+	if cfg.RateLimit > 0 {
+		limiter := limit.NewLimiter(cfg.RateLimit, cfg.RateBurst)
+		rateLimit = func(key func(*http.Request) string) func(http.Handler) http.Handler {
+			return limit.RateLimit(limiter, key)
+		}
+		rateLimitFailures = func(key func(*http.Request) string) func(http.Handler) http.Handler {
+			return limit.RateLimitFailures(limiter, key, http.StatusUnauthorized)
+		}
+	}
+
+	// supervisors poll these, so they are not rate limited
+	r.Get("/healthz", serveHealth)                // GET /healthz - check the process is up
+	r.Get("/readyz", serveReady(stores.Database)) // GET /readyz - check the database can be reached
+	r.Method("GET", "/metrics", reg)              // GET /metrics - read metrics in the Prometheus text format
+
+	gc := graph.NewController(stores.Tasks, stores.Users, stores.Events, stores.Tokens)
+	ec := controllers.EventsController{Events: stores.Events, Stores: stores.Tasks, Tokens: stores.Tokens}
+
+	r.Group(func(r chi.Router) {
+		r.Use(rateLimit(limit.ByIP))
+
+		r.Get("/openapi.json", serveOpenAPI) // GET /openapi.json - read the OpenAPI document
+		r.Get("/docs", serveDocs)            // GET /docs - browse the OpenAPI document
+
+		r.Mount("/users", controllers.NewUsersController(stores.Users, stores.Tokens, cfg.AllowRegistration))
+
+		// the HTML interface authenticates with a session cookie instead
+		// of a bearer token
+		r.Mount("/", ui.NewController(stores.Tasks, stores.Users, stores.Tokens))
+
+		// browsers cannot send an Authorization header with WebSockets,
+		// so their token may come in the first message instead
+		r.Group(func(r chi.Router) {
+			r.Use(auth.AuthenticateOptional(stores.Tokens))
+
+			r.Get("/graphql", gc.Subscribe) // GET /graphql - run subscriptions over a WebSocket (graphql-transport-ws)
+			r.Get("/ws", ec.WebSocket)      // GET /ws - stream task events (WebSocket)
+		})
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(rateLimitFailures(limit.ByIP))
+		r.Use(auth.Authenticate(stores.Tokens))
+		r.Use(rateLimit(limit.ByToken))
 
-	r.Mount("/tasks", controllers.NewTasksController())
+		r.With(idempotency.Middleware(stores.Idempotency, cfg.IdempotencyWindow.Duration)).
+			Mount("/tasks", controllers.NewTasksController(stores.Tasks, stores.Users))
+		r.Mount("/shares", controllers.NewSharesController(stores.Shares, stores.Users))
+		r.Mount("/sync", controllers.NewSyncController(stores.Sync))
+		r.Post("/graphql", gc.Query) // POST /graphql - run a query or a mutation
+
+		r.With(auth.RequireScope(models.ScopeRead)).Get("/events", ec.Stream) // GET /events - stream task events (SSE)
+	})
+
+	return r
+}
+
+// Reloader serves requests with the router of the latest configuration it
+// was given, so a new configuration applies without dropping connections.
+// Rate limits and metrics start over with each router.
+type Reloader struct {
+	stores Stores
+	router atomic.Value
+}
+
+// NewReloader returns a reloader serving the router of 'cfg'
+func NewReloader(stores Stores, cfg config.Web) *Reloader {
+	r := &Reloader{stores: stores}
+	r.Reload(cfg)
 
 	return r
 }
 
-func NewServer(port string, handler http.Handler) *http.Server {
-	if port == "" {
-		port = "8080"
+// Reload builds the router of 'cfg' and serves the requests that follow
+// with it, requests in flight finishing with the previous one
+func (r *Reloader) Reload(cfg config.Web) {
+	r.router.Store(NewRouter(r.stores, cfg))
+}
+
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.router.Load().(*chi.Mux).ServeHTTP(w, req)
+}
+
+func NewServer(addr string, handler http.Handler) *http.Server {
+	if addr == "" {
+		addr = "127.0.0.1:8080"
 	}
 
 	srv := &http.Server{
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		Handler:      handler,
-		Addr:         "0.0.0.0:" + port,
+		Addr:         addr,
+		ConnContext:  controllers.ConnContext,
 	}
 
 	return srv
 }
+
+// Listen opens a listener for 'addr', which is either 'host:port' or
+// 'unix:/path/to.sock'. A socket file left by a previous run is removed,
+// but not a socket a server still accepts connections on, nor any other
+// kind of file.
+func Listen(addr string) (net.Listener, error) {
+	if path := strings.TrimPrefix(addr, "unix:"); path != addr {
+		info, err := os.Lstat(path)
+		switch {
+		case err == nil && info.Mode()&os.ModeSocket == 0:
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		case err == nil:
+			if conn, err := net.Dial("unix", path); err == nil {
+				conn.Close()
+				return nil, fmt.Errorf("%s is in use by another server", path)
+			}
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+		case !os.IsNotExist(err):
+			return nil, err
+		}
+
+		return net.Listen("unix", path)
+	}
+
+	return net.Listen("tcp", addr)
+}
@@ -0,0 +1,172 @@
+package web_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/imgabe/todo/pkg/api/web"
+)
+
+func TestNewRouter_Preflight(t *testing.T) {
+	router, _, _ := testServer(t)
+
+	walk := func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if !strings.HasPrefix(route, "/tasks") {
+			return nil
+		}
+		path := strings.TrimSuffix(strings.ReplaceAll(route, "{taskID}", "1"), "/")
+
+		for _, origin := range []string{"https://app.example.com", "https://evil.example.com"} {
+			r := httptest.NewRequest("OPTIONS", path, nil)
+			r.Header.Set("Origin", origin)
+			r.Header.Set("Access-Control-Request-Method", method)
+			r.Header.Set("Access-Control-Request-Headers", "Authorization, Content-Type, If-Match")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			want := http.StatusNoContent
+			if origin != "https://app.example.com" {
+				want = http.StatusForbidden
+			}
+			if w.Code != want {
+				t.Errorf("preflight of %s %s from %s = %d, want %d", method, path, origin, w.Code, want)
+			}
+			if want == http.StatusNoContent && !strings.Contains(w.Header().Get("Access-Control-Allow-Methods"), method) {
+				t.Errorf("preflight of %s %s allows %q", method, path, w.Header().Get("Access-Control-Allow-Methods"))
+			}
+		}
+
+		return nil
+	}
+
+	if err := chi.Walk(router.(chi.Routes), walk); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewRouter_CORSHeaders(t *testing.T) {
+	router, admin, _ := testServer(t)
+
+	r := httptest.NewRequest("GET", "/tasks", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Authorization", "Bearer "+admin)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the origin", got)
+	}
+	if got := w.Header().Get("Access-Control-Expose-Headers"); !strings.Contains(got, "ETag") {
+		t.Errorf("Access-Control-Expose-Headers = %q, want ETag exposed", got)
+	}
+}
+
+func TestNewRouter_RateLimitFailedAuthentication(t *testing.T) {
+	router, admin, _ := testServer(t)
+
+	send := func(addr, token string, forwarded string) int {
+		r := httptest.NewRequest("GET", "/tasks", nil)
+		r.RemoteAddr = addr
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		if forwarded != "" {
+			r.Header.Set("X-Forwarded-For", forwarded)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		return w.Code
+	}
+
+	// the test server allows bursts of 100 requests
+	var got int
+	for i := 0; i < 150 && got != http.StatusTooManyRequests; i++ {
+		got = send("10.0.0.1:1000", "", "")
+	}
+	if got != http.StatusTooManyRequests {
+		t.Fatalf("flooding /tasks without a token = %d, want %d", got, http.StatusTooManyRequests)
+	}
+
+	if got := send("10.0.0.1:1001", "nope", "10.0.0.9"); got != http.StatusTooManyRequests {
+		t.Errorf("guessing a token with a forged X-Forwarded-For = %d, want %d", got, http.StatusTooManyRequests)
+	}
+	if got := send("10.0.0.2:1000", admin, ""); got != http.StatusOK {
+		t.Errorf("request from another address = %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestListen(t *testing.T) {
+	dir := t.TempDir()
+
+	// stale leaves a socket file behind, as a server that crashed would
+	stale := filepath.Join(dir, "stale.sock")
+	l, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	live := filepath.Join(dir, "live.sock")
+	l, err = net.Listen("unix", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		addr        string
+		wantNetwork string
+		wantErr     bool
+	}{
+		{name: "TCP", addr: "127.0.0.1:0", wantNetwork: "tcp"},
+		{name: "Unix", addr: "unix:" + filepath.Join(dir, "new.sock"), wantNetwork: "unix"},
+		{name: "Stale socket", addr: "unix:" + stale, wantNetwork: "unix"},
+		{name: "Socket in use", addr: "unix:" + live, wantErr: true},
+		{name: "Regular file", addr: "unix:" + file, wantErr: true},
+		{name: "Missing directory", addr: "unix:" + filepath.Join(dir, "missing", "web.sock"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := web.Listen(tt.addr)
+			if tt.wantErr {
+				if err == nil {
+					l.Close()
+					t.Fatalf("Listen(%q) error = nil, want one", tt.addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Listen(%q) error = %v", tt.addr, err)
+			}
+			defer l.Close()
+
+			if got := l.Addr().Network(); got != tt.wantNetwork {
+				t.Errorf("Listen(%q) network = %q, want %q", tt.addr, got, tt.wantNetwork)
+			}
+		})
+	}
+
+	if data, err := os.ReadFile(file); err != nil || string(data) != "data" {
+		t.Errorf("regular file = %q, %v, want it left alone", data, err)
+	}
+}
@@ -0,0 +1,196 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/logging"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+const (
+	// Header is the request header holding the idempotency key
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses replayed from an earlier request
+	ReplayedHeader = "Idempotent-Replayed"
+	// maxKeyLength bounds the keys accepted from clients
+	maxKeyLength = 255
+	// Lease is how long a request may hold its key without completing,
+	// after which it is taken as abandoned and the key can be reserved
+	// again. It outlasts the write timeout of the server.
+	Lease = time.Minute
+)
+
+// perRequestHeaders describe the request being answered rather than the
+// one recorded, so they are never replayed
+var perRequestHeaders = []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"}
+
+// Store is the set of store operations idempotency relies on, satisfied by
+// 'store.IdempotencyStore'
+type Store interface {
+	Reserve(request models.IdempotentRequest, since, leaseSince time.Time) (models.IdempotentRequest, bool, error)
+	Complete(request models.IdempotentRequest) error
+	Release(ownerID int64, key string) error
+}
+
+// Cleaner is implemented by stores able to forget expired keys, satisfied
+// by 'store.IdempotencyStore'
+type Cleaner interface {
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+// Middleware makes POST requests sent with an 'Idempotency-Key' header safe
+// to retry: the first response is recorded and replayed for every request
+// reusing the key within 'window'. Keys belong to the user of the token, so
+// users cannot see each other's responses.
+func Middleware(store Store, window time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxKeyLength {
+				errors.Render(w, r, errors.ErrInvalidRequest(fmt.Errorf("%s must be at most %d characters", Header, maxKeyLength)))
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				errors.Render(w, r, errors.ErrInvalidRequest(err))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			request := models.IdempotentRequest{
+				OwnerID:     auth.OwnerID(r.Context()),
+				Key:         key,
+				RequestHash: hash(r, body),
+			}
+
+			now := time.Now()
+			existing, reserved, err := store.Reserve(request, now.Add(-window), now.Add(-Lease))
+			if err != nil {
+				errors.Render(w, r, err)
+				return
+			}
+			if !reserved {
+				replay(w, r, request, existing)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w}
+			completed := false
+			defer func() {
+				if !completed {
+					// the handler panicked, let the client retry
+					store.Release(request.OwnerID, request.Key)
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+			completed = true
+
+			if recorder.status == 0 || recorder.status >= 500 {
+				// failures may be transient, so they are not replayed
+				store.Release(request.OwnerID, request.Key)
+				return
+			}
+
+			header, _ := json.Marshal(recorder.Header())
+			request.StatusCode = recorder.status
+			request.Header = string(header)
+			request.Body = recorder.body.Bytes()
+			if err := store.Complete(request); err != nil {
+				logging.FromContext(r.Context()).Error("recording response for idempotency key", "error", err)
+			}
+		})
+	}
+}
+
+// Cleanup removes the keys older than 'window' every 'interval' until
+// 'ctx' is done
+func Cleanup(ctx context.Context, store Cleaner, window, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := store.DeleteExpired(time.Now().Add(-window)); err != nil {
+				logging.FromContext(ctx).Error("removing expired idempotency keys", "error", err)
+			}
+		}
+	}
+}
+
+// hash identifies a request by its method, path and body, so a key cannot
+// be reused for a different request
+func hash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replay answers with the response recorded for 'existing', unless it
+// holds a different request or is still being handled
+func replay(w http.ResponseWriter, r *http.Request, request, existing models.IdempotentRequest) {
+	switch {
+	case existing.RequestHash != request.RequestHash:
+		errors.Render(w, r, errors.ErrIdempotencyKeyReused)
+		return
+	case existing.Pending():
+		errors.Render(w, r, errors.ErrIdempotencyKeyInUse)
+		return
+	}
+
+	var header http.Header
+	json.Unmarshal([]byte(existing.Header), &header)
+	for _, name := range perRequestHeaders {
+		header.Del(name)
+	}
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(ReplayedHeader, "true")
+
+	w.WriteHeader(existing.StatusCode)
+	w.Write(existing.Body)
+}
+
+// responseRecorder passes a response through while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.WriteHeader(http.StatusOK)
+	}
+	rr.body.Write(b)
+
+	return rr.ResponseWriter.Write(b)
+}
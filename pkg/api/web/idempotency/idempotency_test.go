@@ -0,0 +1,207 @@
+package idempotency_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/api/web/idempotency"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+type fakeStore struct {
+	mu       sync.Mutex
+	requests map[string]models.IdempotentRequest
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{requests: make(map[string]models.IdempotentRequest)}
+}
+
+func (f *fakeStore) id(ownerID int64, key string) string {
+	return fmt.Sprintf("%d/%s", ownerID, key)
+}
+
+func (f *fakeStore) Reserve(request models.IdempotentRequest, since, leaseSince time.Time) (models.IdempotentRequest, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := f.id(request.OwnerID, request.Key)
+	if existing, ok := f.requests[id]; ok && !existing.CreatedAt.Before(since) && !(existing.Pending() && existing.CreatedAt.Before(leaseSince)) {
+		return existing, false, nil
+	}
+
+	request.CreatedAt = time.Now()
+	f.requests[id] = request
+	return request, true, nil
+}
+
+func (f *fakeStore) Complete(request models.IdempotentRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := f.id(request.OwnerID, request.Key)
+	request.CreatedAt = f.requests[id].CreatedAt
+	f.requests[id] = request
+	return nil
+}
+
+func (f *fakeStore) Release(ownerID int64, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.requests, f.id(ownerID, key))
+	return nil
+}
+
+// creator answers every request with a new ID, failing with 500 when the
+// body asks for it
+type creator struct {
+	created int
+}
+
+func (c *creator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if body, _ := io.ReadAll(r.Body); string(body) == "fail" {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.created++
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-RateLimit-Remaining", fmt.Sprint(10-c.created))
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, `{"id":%d}`, c.created)
+}
+
+func send(handler http.Handler, userID int64, method, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/tasks", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(idempotency.Header, key)
+	}
+	token := models.Token{Scopes: "write", UserID: &userID}
+	r = r.WithContext(context.WithValue(r.Context(), auth.TokenContextKey, token))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	type request struct {
+		user   int64
+		method string
+		key    string
+		body   string
+	}
+
+	tests := []struct {
+		name         string
+		first        request
+		retry        request
+		window       time.Duration
+		want         int
+		wantBody     string
+		wantReplayed bool
+	}{
+		{
+			name:  "Retry",
+			first: request{user: 1, method: "POST", key: "a", body: "task"}, retry: request{user: 1, method: "POST", key: "a", body: "task"},
+			window: time.Hour, want: http.StatusCreated, wantBody: `{"id":1}`, wantReplayed: true,
+		},
+		{
+			name:  "Another key",
+			first: request{user: 1, method: "POST", key: "a", body: "task"}, retry: request{user: 1, method: "POST", key: "b", body: "task"},
+			window: time.Hour, want: http.StatusCreated, wantBody: `{"id":2}`,
+		},
+		{
+			name:  "Without key",
+			first: request{user: 1, method: "POST", body: "task"}, retry: request{user: 1, method: "POST", body: "task"},
+			window: time.Hour, want: http.StatusCreated, wantBody: `{"id":2}`,
+		},
+		{
+			name:  "Key of another user",
+			first: request{user: 1, method: "POST", key: "a", body: "task"}, retry: request{user: 2, method: "POST", key: "a", body: "task"},
+			window: time.Hour, want: http.StatusCreated, wantBody: `{"id":2}`,
+		},
+		{
+			name:  "Key reused for another body",
+			first: request{user: 1, method: "POST", key: "a", body: "task"}, retry: request{user: 1, method: "POST", key: "a", body: "other"},
+			window: time.Hour, want: http.StatusUnprocessableEntity,
+		},
+		{
+			name:  "Expired key",
+			first: request{user: 1, method: "POST", key: "a", body: "task"}, retry: request{user: 1, method: "POST", key: "a", body: "task"},
+			window: -time.Hour, want: http.StatusCreated, wantBody: `{"id":2}`,
+		},
+		{
+			name:  "Retry after failure",
+			first: request{user: 1, method: "POST", key: "a", body: "fail"}, retry: request{user: 1, method: "POST", key: "a", body: "fail"},
+			window: time.Hour, want: http.StatusInternalServerError,
+		},
+		{
+			name:  "Other methods",
+			first: request{user: 1, method: "PUT", key: "a", body: "task"}, retry: request{user: 1, method: "PUT", key: "a", body: "task"},
+			window: time.Hour, want: http.StatusCreated, wantBody: `{"id":2}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := idempotency.Middleware(newFakeStore(), tt.window)(&creator{})
+
+			send(handler, tt.first.user, tt.first.method, tt.first.key, tt.first.body)
+			w := send(handler, tt.retry.user, tt.retry.method, tt.retry.key, tt.retry.body)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body, tt.wantBody)
+			}
+			if replayed := w.Header().Get(idempotency.ReplayedHeader) == "true"; replayed != tt.wantReplayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+			if tt.wantReplayed && w.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("replayed Content-Type = %q, want the original one", w.Header().Get("Content-Type"))
+			}
+			if tt.wantReplayed && w.Header().Get("X-RateLimit-Remaining") != "" {
+				t.Errorf("replayed X-RateLimit-Remaining = %q, want none", w.Header().Get("X-RateLimit-Remaining"))
+			}
+		})
+	}
+}
+
+func TestMiddleware_Pending(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	})
+	handler := idempotency.Middleware(newFakeStore(), time.Hour)(slow)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- send(handler, 1, "POST", "a", "task")
+	}()
+	<-started
+
+	if w := send(handler, 1, "POST", "a", "task"); w.Code != http.StatusConflict {
+		t.Errorf("status while pending = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	close(release)
+	if w := <-done; w.Code != http.StatusCreated {
+		t.Errorf("status of the first request = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if w := send(handler, 1, "POST", "a", "task"); w.Code != http.StatusCreated || w.Header().Get(idempotency.ReplayedHeader) != "true" {
+		t.Errorf("status after completion = %d, want a replayed %d", w.Code, http.StatusCreated)
+	}
+}
@@ -0,0 +1,349 @@
+package limit
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// idleBuckets is how often buckets left full are forgotten
+const idleBuckets = time.Minute
+
+// bucket holds the tokens left to a client and when it was last refilled
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a token bucket rate limiter keeping one bucket per client:
+// each request takes a token and buckets refill at 'rate' tokens per
+// second up to 'burst'
+type Limiter struct {
+	rate  float64
+	burst int
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// NewLimiter returns a limiter allowing 'rate' requests per second on
+// average and 'burst' at once
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Limiter{rate: rate, burst: burst, now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// Allow takes a token from the bucket of 'key', reporting whether there was
+// one, how many are left and how long until the next one
+func (l *Limiter) Allow(key string) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = l.refill(b, now)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, 0, l.wait(b.tokens)
+	}
+
+	b.tokens--
+	return true, int(b.tokens), 0
+}
+
+// Peek reports whether the bucket of 'key' has a token left without taking
+// it, and how long until the next one when it has none
+func (l *Limiter) Peek(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return true, 0
+	}
+
+	if tokens := l.refill(b, l.now()); tokens < 1 {
+		return false, l.wait(tokens)
+	}
+
+	return true, 0
+}
+
+// refill returns the tokens of a bucket at 'now'
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	return math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+}
+
+// wait returns how long a bucket holding 'tokens' takes to hold one
+func (l *Limiter) wait(tokens float64) time.Duration {
+	return time.Duration((1 - tokens) / l.rate * float64(time.Second))
+}
+
+// Reset returns how long the bucket of 'key' takes to be full again
+func (l *Limiter) Reset(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return 0
+	}
+
+	return time.Duration((float64(l.burst) - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep forgets the buckets that would be full by now, so the map does not
+// grow with every client ever seen
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < idleBuckets {
+		return
+	}
+	l.swept = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// AddrKey is the key of the bucket of the client at 'addr', with or
+// without a port
+func AddrKey(addr string) string {
+	return "ip:" + host(addr)
+}
+
+// TokenKey is the key of the bucket of the token 'id'
+func TokenKey(id int64) string {
+	return "token:" + strconv.FormatInt(id, 10)
+}
+
+// ByIP identifies clients by their address, set by the RealIP middleware
+func ByIP(r *http.Request) string {
+	return AddrKey(r.RemoteAddr)
+}
+
+// ByToken identifies clients by their authenticated token, or by their
+// address without one
+func ByToken(r *http.Request) string {
+	if token, ok := r.Context().Value(auth.TokenContextKey).(models.Token); ok {
+		return TokenKey(token.ID)
+	}
+
+	return ByIP(r)
+}
+
+// host strips the port of an address, if any
+func host(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
+
+// ParseNetworks parses addresses and CIDR ranges, such as '10.0.0.1' or
+// '10.0.0.0/8'
+func ParseNetworks(list []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("'%s' is not an address or a CIDR range", s)
+			}
+
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not an address or a CIDR range", s)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// RealIP replaces the address of requests sent through one of the
+// 'trusted' proxies with the one of the client they forwarded, read from
+// the 'X-Forwarded-For' or 'X-Real-IP' headers. Those headers are set by
+// clients as they please, so they are ignored on any other connection.
+// Invalid entries of 'trusted' are ignored too, as they are rejected when
+// the configuration is loaded.
+func RealIP(trusted []string) func(http.Handler) http.Handler {
+	networks := make([]*net.IPNet, 0, len(trusted))
+	for _, s := range trusted {
+		if parsed, err := ParseNetworks([]string{s}); err == nil {
+			networks = append(networks, parsed...)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(networks) > 0 && contains(networks, host(r.RemoteAddr)) {
+				if client := forwarded(r, networks); client != "" {
+					r.RemoteAddr = client
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwarded returns the address of the client a proxy forwarded a request
+// of. Proxies append the address they were connected from to
+// 'X-Forwarded-For', so the last one not of a trusted proxy is the client.
+func forwarded(r *http.Request, networks []*net.IPNet) string {
+	if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		addrs := strings.Split(strings.Join(values, ","), ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(addrs[i])
+			if net.ParseIP(addr) == nil {
+				return ""
+			}
+			if !contains(networks, addr) {
+				return addr
+			}
+		}
+
+		return ""
+	}
+
+	if addr := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(addr) != nil {
+		return addr
+	}
+
+	return ""
+}
+
+// contains reports whether the address 'addr' is in one of 'networks'
+func contains(networks []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RateLimit rejects requests with 429 once the client identified by 'key'
+// ran out of tokens, telling every client its quota through the
+// 'X-RateLimit-*' headers
+func RateLimit(l *Limiter, key func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := key(r)
+			allowed, remaining, wait := l.Allow(client)
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.burst))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(seconds(l.Reset(client))))
+
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(seconds(wait)))
+				errors.Render(w, r, errors.ErrTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimitFailures rejects requests with 429 once the client identified by
+// 'key' ran out of tokens, only taking one for the requests answered with
+// 'status'. Put in front of authentication with 401, it limits how often
+// tokens can be guessed before they are looked up, without charging
+// authenticated requests.
+func RateLimitFailures(l *Limiter, key func(*http.Request) string, status int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := key(r)
+			if allowed, wait := l.Peek(client); !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(seconds(wait)))
+				errors.Render(w, r, errors.ErrTooManyRequests)
+				return
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			if ww.Status() == status {
+				l.Allow(client)
+			}
+		})
+	}
+}
+
+// MaxBodySize rejects request bodies larger than 'n' bytes with 413
+func MaxBodySize(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				errors.Render(w, r, errors.ErrTooLarge)
+				return
+			}
+
+			r.Body = maxBytesReader{http.MaxBytesReader(w, r.Body, n)}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// maxBytesReader reports bodies going over the limit of MaxBodySize as
+// ErrTooLarge, so the handlers reading them answer with 413
+type maxBytesReader struct {
+	io.ReadCloser
+}
+
+func (r maxBytesReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		return n, errors.ErrTooLarge
+	}
+	return n, err
+}
+
+// seconds rounds a duration up to whole seconds, as used by the headers
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
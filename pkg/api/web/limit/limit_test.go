@@ -0,0 +1,255 @@
+package limit_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/render"
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/api/web/limit"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func send(handler http.Handler, addr string, tokenID int64) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/tasks", nil)
+	r.RemoteAddr = addr
+	if tokenID != 0 {
+		r = r.WithContext(context.WithValue(r.Context(), auth.TokenContextKey, models.Token{ID: tokenID}))
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestRateLimit(t *testing.T) {
+	type request struct {
+		addr  string
+		token int64
+	}
+
+	tests := []struct {
+		name          string
+		key           func(*http.Request) string
+		requests      []request
+		want          int
+		wantRemaining string
+	}{
+		{
+			name:     "Within burst",
+			key:      limit.ByIP,
+			requests: []request{{addr: "10.0.0.1:1000"}, {addr: "10.0.0.1:1001"}},
+			want:     http.StatusOK, wantRemaining: "0",
+		},
+		{
+			name:     "Over burst",
+			key:      limit.ByIP,
+			requests: []request{{addr: "10.0.0.1:1000"}, {addr: "10.0.0.1:1001"}, {addr: "10.0.0.1:1002"}},
+			want:     http.StatusTooManyRequests, wantRemaining: "0",
+		},
+		{
+			name:     "Other address",
+			key:      limit.ByIP,
+			requests: []request{{addr: "10.0.0.1:1000"}, {addr: "10.0.0.1:1001"}, {addr: "10.0.0.2:1000"}},
+			want:     http.StatusOK, wantRemaining: "1",
+		},
+		{
+			name:     "Tokens on the same address",
+			key:      limit.ByToken,
+			requests: []request{{addr: "10.0.0.1:1000", token: 1}, {addr: "10.0.0.1:1000", token: 1}, {addr: "10.0.0.1:1000", token: 2}},
+			want:     http.StatusOK, wantRemaining: "1",
+		},
+		{
+			name:     "Same token on other addresses",
+			key:      limit.ByToken,
+			requests: []request{{addr: "10.0.0.1:1000", token: 1}, {addr: "10.0.0.2:1000", token: 1}, {addr: "10.0.0.3:1000", token: 1}},
+			want:     http.StatusTooManyRequests, wantRemaining: "0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := limit.RateLimit(limit.NewLimiter(0.5, 2), tt.key)(ok)
+
+			var w *httptest.ResponseRecorder
+			for _, request := range tt.requests {
+				w = send(handler, request.addr, request.token)
+			}
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+				t.Errorf("X-RateLimit-Limit = %q, want %q", got, "2")
+			}
+			if got := w.Header().Get("X-RateLimit-Remaining"); got != tt.wantRemaining {
+				t.Errorf("X-RateLimit-Remaining = %q, want %q", got, tt.wantRemaining)
+			}
+			if got := w.Header().Get("X-RateLimit-Reset"); got == "" || got == "0" {
+				t.Errorf("X-RateLimit-Reset = %q, want the seconds until the bucket is full", got)
+			}
+
+			retryAfter := w.Header().Get("Retry-After")
+			if tt.want == http.StatusTooManyRequests && retryAfter != "2" {
+				t.Errorf("Retry-After = %q, want %q", retryAfter, "2")
+			}
+			if tt.want != http.StatusTooManyRequests && retryAfter != "" {
+				t.Errorf("Retry-After = %q, want none", retryAfter)
+			}
+		})
+	}
+}
+
+// binder decodes the body as a task, the way controllers do
+var binder = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	task := &models.Task{}
+	if err := render.Bind(r, task); err != nil {
+		errors.Render(w, r, errors.ErrInvalidRequest(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestMaxBodySize(t *testing.T) {
+	body := `{"description":"` + strings.Repeat("a", 64) + `"}`
+
+	tests := []struct {
+		name    string
+		size    int64
+		chunked bool
+		want    int
+	}{
+		{name: "Within limit", size: 1024, want: http.StatusOK},
+		{name: "Over limit", size: 16, want: http.StatusRequestEntityTooLarge},
+		{name: "Over limit without length", size: 16, chunked: true, want: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reader io.Reader = strings.NewReader(body)
+			if tt.chunked {
+				// hides the length of the body from the request
+				reader = io.MultiReader(reader)
+			}
+
+			r := httptest.NewRequest("POST", "/tasks", reader)
+			r.Header.Set("Content-Type", "application/json")
+			if tt.chunked {
+				r.ContentLength = -1
+			}
+
+			w := httptest.NewRecorder()
+			limit.MaxBodySize(tt.size)(binder).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestRateLimitFailures(t *testing.T) {
+	// answers 401 to requests without a token, like authentication
+	authenticate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(auth.TokenContextKey).(models.Token); !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		tokens []int64
+		want   []int
+	}{
+		{
+			name:   "Failures",
+			tokens: []int64{0, 0, 0, 1},
+			want:   []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusTooManyRequests},
+		},
+		{
+			name:   "Successes are not charged",
+			tokens: []int64{1, 1, 1, 0, 0, 1},
+			want:   []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := limit.RateLimitFailures(limit.NewLimiter(0.5, 2), limit.ByIP, http.StatusUnauthorized)(authenticate)
+
+			for i, token := range tt.tokens {
+				w := send(handler, "10.0.0.1:1000", token)
+				if w.Code != tt.want[i] {
+					t.Errorf("request %d = %d, want %d", i+1, w.Code, tt.want[i])
+				}
+				if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "2" {
+					t.Errorf("Retry-After = %q, want %q", w.Header().Get("Retry-After"), "2")
+				}
+			}
+		})
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		trusted   []string
+		addr      string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{name: "No proxy", addr: "10.0.0.1:1000", forwarded: "192.0.2.1", want: "10.0.0.1:1000"},
+		{name: "Untrusted proxy", trusted: []string{"10.0.0.2"}, addr: "10.0.0.1:1000", forwarded: "192.0.2.1", want: "10.0.0.1:1000"},
+		{name: "Trusted proxy", trusted: []string{"10.0.0.1"}, addr: "10.0.0.1:1000", forwarded: "192.0.2.1", want: "192.0.2.1"},
+		{name: "Trusted range", trusted: []string{"10.0.0.0/8"}, addr: "10.0.0.1:1000", forwarded: "192.0.2.1", want: "192.0.2.1"},
+		{name: "Forged by the client", trusted: []string{"10.0.0.0/8"}, addr: "10.0.0.1:1000", forwarded: "198.51.100.1, 192.0.2.1", want: "192.0.2.1"},
+		{name: "Chain of proxies", trusted: []string{"10.0.0.0/8"}, addr: "10.0.0.1:1000", forwarded: "192.0.2.1, 10.0.0.2", want: "192.0.2.1"},
+		{name: "Invalid address", trusted: []string{"10.0.0.0/8"}, addr: "10.0.0.1:1000", forwarded: "nope", want: "10.0.0.1:1000"},
+		{name: "X-Real-IP", trusted: []string{"10.0.0.1"}, addr: "10.0.0.1:1000", realIP: "192.0.2.1", want: "192.0.2.1"},
+		{name: "Untrusted X-Real-IP", addr: "10.0.0.1:1000", realIP: "192.0.2.1", want: "10.0.0.1:1000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/tasks", nil)
+			r.RemoteAddr = tt.addr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			var got string
+			limit.RealIP(tt.trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			})).ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	if _, err := limit.ParseNetworks([]string{"10.0.0.1", "10.0.0.0/8", "::1", "fd00::/8"}); err != nil {
+		t.Errorf("ParseNetworks() error = %v", err)
+	}
+	for _, s := range []string{"nope", "10.0.0.0/33", "10.0.0.1:80"} {
+		if _, err := limit.ParseNetworks([]string{s}); err == nil {
+			t.Errorf("ParseNetworks(%q) error = nil, want one", s)
+		}
+	}
+}
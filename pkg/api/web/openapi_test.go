@@ -0,0 +1,347 @@
+package web_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/imgabe/todo/pkg/api/web"
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/api/web/ui"
+	"github.com/imgabe/todo/pkg/config"
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/logging"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/imgabe/todo/pkg/store/storetest"
+)
+
+type schema = map[string]interface{}
+
+// testServer serves NewRouter from a storetest.Fixture, and returns the
+// tokens of alice with every scope and with only the read scope
+func testServer(t *testing.T) (http.Handler, string, string) {
+	t.Helper()
+
+	f := storetest.New(t)
+	db := f.DB
+	ts := store.TaskStore{DB: db}
+	tks := store.TokenStore{DB: db}
+	us := store.UserStore{DB: db}
+
+	stores := web.Stores{
+		Tasks: func(ctx context.Context, ownerID int64) controllers.TaskStore {
+			return ts.ForOwner(ownerID).WithLogger(logging.FromContext(ctx))
+		},
+		Tokens: tks,
+		Users:  us,
+		Shares: store.ShareStore{DB: db},
+		Sync: func(ctx context.Context, ownerID int64) controllers.SyncStore {
+			return store.SyncStore{DB: db}.ForOwner(ownerID).WithLogger(logging.FromContext(ctx))
+		},
+		Events:      events.NewBroker(),
+		Idempotency: store.IdempotencyStore{DB: db},
+		Database:    db,
+		TaskCounts:  ts,
+	}
+	cfg := config.Default().Web
+	cfg.AllowRegistration = true
+	// every case is sent at once, without waiting for the limit to refill
+	cfg.RateBurst = 100
+	cfg.CORS.AllowedOrigins = []string{"https://app.example.com"}
+
+	return web.NewRouter(stores, cfg), f.Admin, f.Reader
+}
+
+func loadSpec(t *testing.T) schema {
+	t.Helper()
+
+	var spec schema
+	if err := json.Unmarshal(web.OpenAPI, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %+v", err)
+	}
+
+	return spec
+}
+
+func TestOpenAPI_RoutesDocumented(t *testing.T) {
+	router, _, _ := testServer(t)
+	paths := loadSpec(t)["paths"].(schema)
+
+	// the HTML interface is mounted at the root but is not part of the API
+	html := make(map[string]bool)
+	collect := func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		html[method+" "+route] = true
+		return nil
+	}
+	if err := chi.Walk(ui.NewController(nil, nil, nil), collect); err != nil {
+		t.Fatal(err)
+	}
+
+	walk := func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if html[method+" "+route] {
+			return nil
+		}
+		if route != "/" {
+			route = strings.TrimSuffix(route, "/")
+		}
+
+		item, ok := paths[route].(schema)
+		if !ok {
+			t.Errorf("route %s is not documented", route)
+			return nil
+		}
+		if _, ok := item[strings.ToLower(method)]; !ok {
+			t.Errorf("route %s %s is not documented", method, route)
+		}
+
+		return nil
+	}
+
+	if err := chi.Walk(router.(chi.Routes), walk); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenAPI_Responses(t *testing.T) {
+	router, admin, reader := testServer(t)
+	spec := loadSpec(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		template string
+		token    string
+		body     string
+		header   []string
+		want     int
+	}{
+		{name: "Read the document", method: "GET", path: "/openapi.json", template: "/openapi.json", want: 200},
+		{name: "Browse the document", method: "GET", path: "/docs", template: "/docs", want: 200},
+		{name: "Health", method: "GET", path: "/healthz", template: "/healthz", want: 200},
+		{name: "Readiness", method: "GET", path: "/readyz", template: "/readyz", want: 200},
+		{name: "Metrics", method: "GET", path: "/metrics", template: "/metrics", want: 200},
+		{name: "Register", method: "POST", path: "/users", template: "/users", body: `{"name":"carol","password":"secret"}`, want: 201},
+		{name: "Register taken name", method: "POST", path: "/users", template: "/users", body: `{"name":"carol","password":"secret"}`, want: 409},
+		{name: "Register without password", method: "POST", path: "/users", template: "/users", body: `{"name":"carol"}`, want: 400},
+		{name: "Log in", method: "POST", path: "/users/login", template: "/users/login", body: `{"name":"alice","password":"secret"}`, want: 200},
+		{name: "Log in with wrong password", method: "POST", path: "/users/login", template: "/users/login", body: `{"name":"alice","password":"nope"}`, want: 401},
+		{name: "List without token", method: "GET", path: "/tasks", template: "/tasks", want: 401},
+		{name: "Create", method: "POST", path: "/tasks", template: "/tasks", token: admin, body: `{"description":"Task 1"}`, want: 201},
+		{name: "Create with key", method: "POST", path: "/tasks", template: "/tasks", token: admin, body: `{"description":"Task 2"}`, header: []string{"Idempotency-Key", "k1"}, want: 201},
+		{name: "Create with key again", method: "POST", path: "/tasks", template: "/tasks", token: admin, body: `{"description":"Task 2"}`, header: []string{"Idempotency-Key", "k1"}, want: 201},
+		{name: "Create with reused key", method: "POST", path: "/tasks", template: "/tasks", token: admin, body: `{"description":"Task 3"}`, header: []string{"Idempotency-Key", "k1"}, want: 422},
+		{name: "Create without description", method: "POST", path: "/tasks", template: "/tasks", token: admin, body: `{}`, want: 400},
+		{name: "Create with read scope", method: "POST", path: "/tasks", template: "/tasks", token: reader, body: `{"description":"Task 2"}`, want: 403},
+		{name: "List", method: "GET", path: "/tasks", template: "/tasks", token: reader, want: 200},
+		{name: "Read", method: "GET", path: "/tasks/1", template: "/tasks/{taskID}", token: reader, want: 200},
+		{name: "Read non-existent", method: "GET", path: "/tasks/99", template: "/tasks/{taskID}", token: reader, want: 404},
+		{name: "Read unchanged", method: "GET", path: "/tasks/1", template: "/tasks/{taskID}", token: reader, header: []string{"If-None-Match", `"1"`}, want: 304},
+		{name: "Update without If-Match", method: "PUT", path: "/tasks/1", template: "/tasks/{taskID}", token: admin, body: `{"description":"Task 1","done":true}`, want: 428},
+		{name: "Update stale version", method: "PUT", path: "/tasks/1", template: "/tasks/{taskID}", token: admin, body: `{"description":"Task 1","done":true}`, header: []string{"If-Match", `"7"`}, want: 412},
+		{name: "Update", method: "PUT", path: "/tasks/1", template: "/tasks/{taskID}", token: admin, body: `{"description":"Task 1","done":true}`, header: []string{"If-Match", `"1"`}, want: 200},
+		{name: "Assign", method: "PUT", path: "/tasks/1/assignee", template: "/tasks/{taskID}/assignee", token: admin, body: `{"assignee":"bob"}`, want: 200},
+		{name: "Assign to unknown user", method: "PUT", path: "/tasks/1/assignee", template: "/tasks/{taskID}/assignee", token: admin, body: `{"assignee":"nobody"}`, want: 404},
+		{name: "Patch", method: "PATCH", path: "/tasks/1", template: "/tasks/{taskID}", token: admin, body: `{"done":false}`, header: []string{"If-Match", `"3"`}, want: 200},
+		{name: "List assigned", method: "GET", path: "/tasks?assignee=me", template: "/tasks", token: reader, want: 200},
+		{name: "List a page", method: "GET", path: "/tasks?limit=1", template: "/tasks", token: reader, want: 200},
+		{name: "List with invalid limit", method: "GET", path: "/tasks?limit=0", template: "/tasks", token: reader, want: 400},
+		{name: "Share", method: "PUT", path: "/shares/bob", template: "/shares/{userName}", token: admin, body: `{"permission":"read"}`, want: 200},
+		{name: "Share with invalid permission", method: "PUT", path: "/shares/bob", template: "/shares/{userName}", token: admin, body: `{"permission":"all"}`, want: 400},
+		{name: "Share with owner", method: "PUT", path: "/shares/alice", template: "/shares/{userName}", token: admin, body: `{"permission":"read"}`, want: 422},
+		{name: "List shares", method: "GET", path: "/shares", template: "/shares", token: admin, want: 200},
+		{name: "Unshare", method: "DELETE", path: "/shares/bob", template: "/shares/{userName}", token: admin, want: 204},
+		{name: "Sync", method: "POST", path: "/sync", template: "/sync", token: admin, body: `{"since":0,"strategy":"field","changes":[{"uuid":"0f8e","description":"Synced task","description_updated_at":1700000000000,"done_updated_at":1700000000000,"description_changed":true,"done_changed":true}]}`, want: 200},
+		{name: "Sync with unknown strategy", method: "POST", path: "/sync", template: "/sync", token: admin, body: `{"strategy":"newest"}`, want: 400},
+		{name: "Sync with read scope", method: "POST", path: "/sync", template: "/sync", token: reader, body: `{}`, want: 403},
+		{name: "Unshare again", method: "DELETE", path: "/shares/bob", template: "/shares/{userName}", token: admin, want: 404},
+		{name: "Read non-numeric", method: "GET", path: "/tasks/abc", template: "/tasks/{taskID}", token: reader, want: 404},
+		{name: "Delete with read scope", method: "DELETE", path: "/tasks/1", template: "/tasks/{taskID}", token: reader, want: 403},
+		{name: "Delete stale version", method: "DELETE", path: "/tasks/1", template: "/tasks/{taskID}", token: admin, header: []string{"If-Match", `"3"`}, want: 412},
+		{name: "Delete", method: "DELETE", path: "/tasks/1", template: "/tasks/{taskID}", token: admin, header: []string{"If-Match", `"4"`}, want: 200},
+		{name: "Delete again", method: "DELETE", path: "/tasks/1", template: "/tasks/{taskID}", token: admin, header: []string{"If-Match", "*"}, want: 404},
+		{name: "GraphQL query", method: "POST", path: "/graphql", template: "/graphql", token: reader, body: `{"query":"{ tasks { totalCount edges { cursor node { id description done version } } } }"}`, want: 200},
+		{name: "GraphQL mutation with read scope", method: "POST", path: "/graphql", template: "/graphql", token: reader, body: `{"query":"mutation { addTask(description: \"Task 3\") { id } }"}`, want: 200},
+		{name: "GraphQL without query", method: "POST", path: "/graphql", template: "/graphql", token: reader, body: `{}`, want: 400},
+		{name: "Create too large", method: "POST", path: "/tasks", template: "/tasks", token: admin, body: `{"description":"` + strings.Repeat("a", 1<<20) + `"}`, want: 413},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			for i := 0; i+1 < len(tt.header); i += 2 {
+				r.Header.Set(tt.header[i], tt.header[i+1])
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d: %s", tt.method, tt.path, w.Code, tt.want, w.Body)
+			}
+
+			operation, ok := lookup(spec, "paths", tt.template, strings.ToLower(tt.method)).(schema)
+			if !ok {
+				t.Fatalf("operation %s %s is not documented", tt.method, tt.template)
+			}
+
+			response, ok := resolve(spec, lookup(operation, "responses", strconv.Itoa(w.Code))).(schema)
+			if !ok {
+				t.Fatalf("status %d of %s %s is not documented", w.Code, tt.method, tt.template)
+			}
+
+			content, _ := response["content"].(schema)
+			if len(content) == 0 {
+				if w.Body.Len() != 0 {
+					t.Errorf("undocumented body %s", w.Body)
+				}
+				return
+			}
+
+			mediaType := strings.Split(w.Header().Get("Content-Type"), ";")[0]
+			body, ok := lookup(content, mediaType, "schema").(schema)
+			if !ok {
+				t.Fatalf("content type %q of status %d is not documented", mediaType, w.Code)
+			}
+			if mediaType != "application/json" && mediaType != "application/problem+json" {
+				return
+			}
+
+			var value interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &value); err != nil {
+				t.Fatalf("invalid JSON body %s: %+v", w.Body, err)
+			}
+			for _, problem := range validate(spec, body, value, "body") {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+// lookup follows 'keys' through nested objects
+func lookup(value interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		object, ok := value.(schema)
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+
+	return value
+}
+
+// resolve follows a local '$ref' to the component it points to
+func resolve(spec schema, value interface{}) interface{} {
+	object, ok := value.(schema)
+	if !ok {
+		return value
+	}
+
+	ref, ok := object["$ref"].(string)
+	if !ok {
+		return value
+	}
+
+	return resolve(spec, lookup(spec, strings.Split(strings.TrimPrefix(ref, "#/"), "/")...))
+}
+
+// validate checks 'value' against the subset of JSON Schema used by the
+// document: type, properties, required, items and enum
+func validate(spec schema, s schema, value interface{}, path string) []string {
+	s = resolve(spec, s).(schema)
+
+	var problems []string
+	switch s["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: %v is not an object", path, value)}
+		}
+
+		properties, _ := s["properties"].(schema)
+		if required, ok := s["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := object[name.(string)]; !ok {
+					problems = append(problems, fmt.Sprintf("%s: missing required property %s", path, name))
+				}
+			}
+		}
+		for name, property := range object {
+			propertySchema, ok := properties[name].(schema)
+			if !ok {
+				if properties != nil {
+					problems = append(problems, fmt.Sprintf("%s: undocumented property %s", path, name))
+				}
+				continue
+			}
+			problems = append(problems, validate(spec, propertySchema, property, path+"."+name)...)
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: %v is not an array", path, value)}
+		}
+
+		items, _ := s["items"].(schema)
+		for i, item := range array {
+			problems = append(problems, validate(spec, items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			problems = append(problems, fmt.Sprintf("%s: %v is not a string", path, value))
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != float64(int64(number)) {
+			problems = append(problems, fmt.Sprintf("%s: %v is not an integer", path, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: %v is not a boolean", path, value))
+		}
+	}
+
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if allowed == value {
+				found = true
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: %v is not one of %v", path, value, enum))
+		}
+	}
+
+	return problems
+}
+
+func TestDocs(t *testing.T) {
+	router, _, _ := testServer(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/docs", nil))
+	page := w.Body.String()
+
+	for _, want := range []string{
+		`<span class="method">GET</span> <code>/tasks/{taskID}</code>`,
+		`&#34;openapi&#34;: &#34;3.0.3&#34;`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("docs page is missing %s", want)
+		}
+	}
+	if strings.Contains(page, "<script") {
+		t.Error("docs page loads a script")
+	}
+}
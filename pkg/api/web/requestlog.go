@@ -0,0 +1,42 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/imgabe/todo/pkg/logging"
+)
+
+// logRequests gives every request a logger tagged with the ID set by
+// 'middleware.RequestID', so handlers and stores log along with the request
+// they serve, then logs the request once served
+func logRequests(l *logging.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rl := l.With("request_id", middleware.GetReqID(r.Context()))
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r.WithContext(logging.NewContext(r.Context(), rl)))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			level := logging.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = logging.LevelError
+			}
+			rl.Log(level, "request served",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", status,
+				"bytes", ww.BytesWritten(),
+				"duration", time.Since(start),
+				"remote", r.RemoteAddr,
+			)
+		})
+	}
+}
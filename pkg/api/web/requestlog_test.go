@@ -0,0 +1,41 @@
+package web_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/imgabe/todo/pkg/logging"
+)
+
+func TestNewRouter_LogsRequests(t *testing.T) {
+	var buf bytes.Buffer
+	previous := logging.Default()
+	logging.SetDefault(logging.New(&buf, logging.LevelDebug, logging.FormatText))
+	t.Cleanup(func() { logging.SetDefault(previous) })
+
+	router, admin, _ := testServer(t)
+
+	r := httptest.NewRequest("GET", "/tasks/1", nil)
+	r.Header.Set("Authorization", "Bearer "+admin)
+	r.Header.Set("X-Request-Id", "req-42")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	var served, store bool
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if !strings.Contains(line, "request_id=req-42") {
+			continue
+		}
+
+		served = served || strings.Contains(line, `msg="request served"`) && strings.Contains(line, "status=404")
+		store = store || strings.Contains(line, `msg="store operation"`) && strings.Contains(line, "operation=select")
+	}
+
+	if !served {
+		t.Errorf("request not logged with its ID:\n%s", buf.String())
+	}
+	if !store {
+		t.Errorf("store operation not logged with the request ID:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,86 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/imgabe/todo/pkg/config"
+)
+
+// TLSConfig returns the TLS configuration serving HTTPS with the certificate
+// and key files of 'cfg', or with a self-signed certificate for the host of
+// 'cfg.Listen' when requested. It returns nil to serve plain HTTP. The files
+// are read right away, so that a server does not start with unusable ones.
+func TLSConfig(cfg config.Web) (*tls.Config, error) {
+	switch {
+	case (cfg.TLSCert == "") != (cfg.TLSKey == ""):
+		return nil, errors.New("both a TLS certificate and key are required")
+	case cfg.TLSCert != "":
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+	case cfg.TLSSelfSigned:
+		host, _, _ := net.SplitHostPort(cfg.Listen)
+		cert, err := SelfSignedCertificate(host)
+		if err != nil {
+			return nil, err
+		}
+
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+	}
+
+	return nil, nil
+}
+
+// SelfSignedCertificate generates a short-lived certificate for local HTTPS,
+// valid for localhost and the loopback addresses plus the given hosts
+func SelfSignedCertificate(hosts ...string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"todo"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,71 @@
+package web_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/imgabe/todo/pkg/api/web"
+	"github.com/imgabe/todo/pkg/config"
+)
+
+// writeCertificate writes a self-signed certificate and its key to PEM
+// files in 'dir', returning their paths
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	cert, err := web.SelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir)
+
+	tests := []struct {
+		name    string
+		cfg     config.Web
+		wantTLS bool
+		wantErr bool
+	}{
+		{name: "Plain HTTP", cfg: config.Web{}},
+		{name: "Certificate and key", cfg: config.Web{TLSCert: certFile, TLSKey: keyFile}, wantTLS: true},
+		{name: "Self-signed", cfg: config.Web{Listen: "127.0.0.1:8443", TLSSelfSigned: true}, wantTLS: true},
+		{name: "Certificate without key", cfg: config.Web{TLSCert: certFile}, wantErr: true},
+		{name: "Key without certificate", cfg: config.Web{TLSKey: keyFile}, wantErr: true},
+		{name: "Missing files", cfg: config.Web{TLSCert: filepath.Join(dir, "missing.pem"), TLSKey: keyFile}, wantErr: true},
+		{name: "Key as certificate", cfg: config.Web{TLSCert: keyFile, TLSKey: keyFile}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := web.TLSConfig(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got != nil) != tt.wantTLS {
+				t.Fatalf("TLSConfig() = %v, want TLS %v", got, tt.wantTLS)
+			}
+			if got != nil && len(got.Certificates) != 1 {
+				t.Errorf("TLSConfig() certificates = %d, want 1", len(got.Certificates))
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package ui
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+const (
+	// SessionCookie holds the token of the session
+	SessionCookie = "todo_session"
+	// CSRFCookie holds the token forms must send back in 'CSRFField'
+	CSRFCookie = "todo_csrf"
+	// CSRFField is the form field holding the CSRF token
+	CSRFField = "csrf_token"
+)
+
+// csrfContextKey is the context key used to pass the CSRF token to pages
+var csrfContextKey auth.ContextKey = "csrf"
+
+// newCSRFToken returns a random token for the CSRF cookie
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CSRF gives every browser a random token in a cookie and rejects forms not
+// sending it back: other sites can make browsers send the cookie, but not
+// read it to fill in the form.
+func (c Controller) CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var token string
+		if cookie, err := r.Cookie(CSRFCookie); err == nil && len(cookie.Value) == 43 {
+			token = cookie.Value
+		} else {
+			var err error
+			if token, err = newCSRFToken(); err != nil {
+				c.fail(w, r, err)
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{
+				Name:     CSRFCookie,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), csrfContextKey, token))
+
+		if r.Method == http.MethodPost && subtle.ConstantTimeCompare([]byte(r.PostFormValue(CSRFField)), []byte(token)) != 1 {
+			c.fail(w, r, errors.ErrInvalidCSRFToken)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Session authenticates requests with the token of the session cookie,
+// sending browsers without a valid one to the log in form
+func (c Controller) Session(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(SessionCookie)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		token, err := c.Tokens.SelectByToken(cookie.Value)
+		if err != nil || token.Expired(time.Now()) {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		scope := models.ScopeRead
+		if r.Method != http.MethodGet {
+			scope = models.ScopeWrite
+		}
+		if !token.HasScope(scope) {
+			c.fail(w, r, errors.ErrForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), auth.TokenContextKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (c Controller) LoginForm(w http.ResponseWriter, r *http.Request) {
+	c.render(w, r, http.StatusOK, "login.html", page{Title: "Log in"})
+}
+
+func (c Controller) Login(w http.ResponseWriter, r *http.Request) {
+	name := r.PostFormValue("name")
+
+	session, err := c.Users.Session(name, r.PostFormValue("password"))
+	if err != nil {
+		problem := errors.FromRequest(r, err)
+		c.render(w, r, problem.HTTPStatusCode, "login.html", page{Title: "Log in", Error: problem.StatusText, Name: name})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    session.Token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (c Controller) Logout(w http.ResponseWriter, r *http.Request) {
+	if token, ok := r.Context().Value(auth.TokenContextKey).(models.Token); ok {
+		if err := c.Tokens.Revoke(token.ID); err != nil {
+			c.fail(w, r, err)
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Path: "/", MaxAge: -1, HttpOnly: true})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
@@ -0,0 +1,40 @@
+// The pages work without scripts. When scripts run, forms marked with
+// 'data-enhance' are sent in the background and only the content of the
+// page is replaced with the response, keeping the scroll position.
+document.addEventListener('submit', async (event) => {
+  const form = event.target;
+  if (!form.matches('form[data-enhance]')) {
+    return;
+  }
+  if (form.dataset.confirm && !window.confirm(form.dataset.confirm)) {
+    event.preventDefault();
+    return;
+  }
+  event.preventDefault();
+
+  let response;
+  try {
+    response = await fetch(form.action, {
+      method: 'POST',
+      body: new URLSearchParams(new FormData(form)),
+      credentials: 'same-origin',
+    });
+  } catch (error) {
+    form.submit();
+    return;
+  }
+
+  const page = new DOMParser().parseFromString(await response.text(), 'text/html');
+  const main = page.querySelector('main');
+  if (!main) {
+    window.location.assign(response.url);
+    return;
+  }
+
+  document.querySelector('main').replaceWith(main);
+  document.title = page.title;
+  if (response.url !== window.location.href) {
+    window.history.replaceState(null, '', response.url);
+  }
+  main.querySelector('[autofocus]')?.focus();
+});
@@ -0,0 +1,241 @@
+package ui
+
+import (
+	"context"
+	"embed"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/logging"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+//go:embed templates static
+var files embed.FS
+
+// TokenStore is the set of token operations sessions rely on, satisfied by
+// 'store.TokenStore'
+type TokenStore interface {
+	auth.TokenStore
+	controllers.TokenStore
+	Revoke(tokenID int64) error
+}
+
+// page holds what the templates show
+type page struct {
+	Title string
+	CSRF  string
+	Error string
+	Tasks []models.Task
+	Task  models.Task
+	Name  string
+}
+
+func NewController(stores controllers.TaskStoreFor, users controllers.UserStore, tokens TokenStore) *chi.Mux {
+	r := chi.NewRouter()
+	c := Controller{
+		Stores: stores,
+		Users:  controllers.UsersController{Users: users, Tokens: tokens},
+		Tokens: tokens,
+		pages:  parsePages("tasks.html", "edit.html", "login.html", "error.html"),
+	}
+
+	r.Use(c.CSRF)
+
+	r.Handle("/static/*", http.FileServer(http.FS(files))) // GET /static/* - stylesheet and scripts
+	r.Get("/login", c.LoginForm)                           // GET /login - show the log in form
+	r.Post("/login", c.Login)                              // POST /login - start a session
+
+	r.Group(func(r chi.Router) {
+		r.Use(c.Session)
+
+		r.Get("/", c.List)          // GET / - list the tasks
+		r.Post("/", c.Create)       // POST / - add a task
+		r.Post("/logout", c.Logout) // POST /logout - end the session
+
+		r.Route("/{taskID}", func(r chi.Router) {
+			r.Use(c.TaskCtx)
+
+			r.Get("/edit", c.Edit)      // GET /{taskID}/edit - show the form editing a task
+			r.Post("/edit", c.Update)   // POST /{taskID}/edit - save a task
+			r.Post("/check", c.Check)   // POST /{taskID}/check - mark a task done or not done
+			r.Post("/delete", c.Delete) // POST /{taskID}/delete - delete a task
+		})
+	})
+
+	return r
+}
+
+// Controller serves the HTML interface, calling the same stores as
+// 'controllers.TasksController' on behalf of the user of the session
+type Controller struct {
+	Stores controllers.TaskStoreFor
+	Users  controllers.UsersController
+	Tokens TokenStore
+
+	pages map[string]*template.Template
+}
+
+// parsePages reads each page along with the layout it is shown in
+func parsePages(names ...string) map[string]*template.Template {
+	pages := make(map[string]*template.Template)
+	for _, name := range names {
+		pages[name] = template.Must(template.ParseFS(files, "templates/layout.html", "templates/"+name))
+	}
+
+	return pages
+}
+
+// store returns the task store of the user of the session
+func (c Controller) store(r *http.Request) controllers.TaskStore {
+	return c.Stores(r.Context(), auth.OwnerID(r.Context()))
+}
+
+// render writes a page with 'status'. Scripts, styles and forms are
+// restricted to the server, and the pages cannot be framed.
+func (c Controller) render(w http.ResponseWriter, r *http.Request, status int, name string, data page) {
+	data.CSRF, _ = r.Context().Value(csrfContextKey).(string)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; form-action 'self'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+
+	if err := c.pages[name].ExecuteTemplate(w, "layout", data); err != nil {
+		logging.FromContext(r.Context()).Error("rendering page", "page", name, "error", err)
+	}
+}
+
+// fail shows the error page matching 'err'
+func (c Controller) fail(w http.ResponseWriter, r *http.Request, err error) {
+	problem := errors.FromRequest(r, err)
+	message := problem.ErrorText
+	if message == "" {
+		message = problem.StatusText
+	}
+
+	c.render(w, r, problem.HTTPStatusCode, "error.html", page{Title: problem.StatusText, Error: message})
+}
+
+// TaskCtx loads the task of the URL, like 'TasksController.TaskCtx'
+func (c Controller) TaskCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		taskID, err := strconv.ParseInt(chi.URLParam(r, "taskID"), 10, 64)
+		if err != nil {
+			c.fail(w, r, errors.ErrNotFound)
+			return
+		}
+
+		task, err := c.store(r).Select(models.Task{ID: taskID})
+		if err != nil {
+			c.fail(w, r, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), controllers.TaskContexKey, task)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// formTask returns the task of the context at the version sent with the
+// form, so the store rejects changes to a task changed in the meantime
+func formTask(r *http.Request) (models.Task, error) {
+	task, _ := r.Context().Value(controllers.TaskContexKey).(models.Task)
+
+	version, err := strconv.ParseInt(r.PostFormValue("version"), 10, 64)
+	if err != nil {
+		return task, errors.ErrInvalidRequest(err)
+	}
+	task.Version = version
+
+	return task, nil
+}
+
+func (c Controller) List(w http.ResponseWriter, r *http.Request) {
+	tasks, err := c.store(r).SelectAll(true, models.Page{})
+	if err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	c.render(w, r, http.StatusOK, "tasks.html", page{Title: "Tasks", Tasks: tasks})
+}
+
+func (c Controller) Create(w http.ResponseWriter, r *http.Request) {
+	task := models.Task{Description: strings.TrimSpace(r.PostFormValue("description"))}
+	if err := task.Bind(r); err != nil {
+		c.fail(w, r, errors.ErrInvalidRequest(err))
+		return
+	}
+
+	if _, err := c.store(r).Insert(task); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (c Controller) Edit(w http.ResponseWriter, r *http.Request) {
+	task, _ := r.Context().Value(controllers.TaskContexKey).(models.Task)
+
+	c.render(w, r, http.StatusOK, "edit.html", page{Title: "Edit task", Task: task})
+}
+
+func (c Controller) Update(w http.ResponseWriter, r *http.Request) {
+	task, err := formTask(r)
+	if err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	task.Description = strings.TrimSpace(r.PostFormValue("description"))
+	task.Done = r.PostFormValue("done") != ""
+	if err := task.Bind(r); err != nil {
+		c.fail(w, r, errors.ErrInvalidRequest(err))
+		return
+	}
+
+	if _, err := c.store(r).Update(task); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (c Controller) Check(w http.ResponseWriter, r *http.Request) {
+	task, err := formTask(r)
+	if err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	task.Done = !task.Done
+	if _, err := c.store(r).Update(task); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (c Controller) Delete(w http.ResponseWriter, r *http.Request) {
+	task, err := formTask(r)
+	if err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	if err := c.store(r).DeleteVersion(task.ID, task.Version); err != nil {
+		c.fail(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
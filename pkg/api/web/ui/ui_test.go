@@ -0,0 +1,169 @@
+package ui_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/api/web/ui"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/imgabe/todo/pkg/store/storetest"
+)
+
+// testServer serves the interface from a storetest.Fixture, where alice
+// signs in with the password 'secret'
+func testServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	db := storetest.New(t).DB
+	ts := store.TaskStore{DB: db}
+
+	stores := func(ctx context.Context, ownerID int64) controllers.TaskStore { return ts.ForOwner(ownerID) }
+	srv := httptest.NewServer(ui.NewController(stores, store.UserStore{DB: db}, store.TokenStore{DB: db}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// browser keeps cookies like a browser but does not follow redirects
+type browser struct {
+	*http.Client
+	base *url.URL
+}
+
+func newBrowser(t *testing.T, srv *httptest.Server) browser {
+	jar, _ := cookiejar.New(nil)
+	base, _ := url.Parse(srv.URL)
+
+	return browser{
+		Client: &http.Client{
+			Jar: jar,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		base: base,
+	}
+}
+
+func (b browser) cookie(name string) string {
+	for _, cookie := range b.Jar.Cookies(b.base) {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+
+	return ""
+}
+
+func TestController(t *testing.T) {
+	srv := testServer(t)
+	b := newBrowser(t, srv)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		form         url.Values
+		noCSRF       bool
+		want         int
+		wantLocation string
+		wantBody     string
+	}{
+		{name: "List without session", method: "GET", path: "/", want: 303, wantLocation: "/login"},
+		{name: "Log in form", method: "GET", path: "/login", want: 200, wantBody: `name="csrf_token"`},
+		{name: "Log in without CSRF token", method: "POST", path: "/login", form: url.Values{"name": {"alice"}, "password": {"secret"}}, noCSRF: true, want: 403},
+		{name: "Log in with wrong password", method: "POST", path: "/login", form: url.Values{"name": {"alice"}, "password": {"nope"}}, want: 401, wantBody: "Invalid name or password."},
+		{name: "Log in", method: "POST", path: "/login", form: url.Values{"name": {"alice"}, "password": {"secret"}}, want: 303, wantLocation: "/"},
+		{name: "Empty list", method: "GET", path: "/", want: 200, wantBody: "Nothing to do."},
+		{name: "Add", method: "POST", path: "/", form: url.Values{"description": {"Buy milk"}}, want: 303, wantLocation: "/"},
+		{name: "Add without CSRF token", method: "POST", path: "/", form: url.Values{"description": {"Buy milk"}}, noCSRF: true, want: 403},
+		{name: "Add without description", method: "POST", path: "/", form: url.Values{"description": {" "}}, want: 400},
+		{name: "List", method: "GET", path: "/", want: 200, wantBody: "Buy milk"},
+		{name: "Check", method: "POST", path: "/1/check", form: url.Values{"version": {"1"}}, want: 303, wantLocation: "/"},
+		{name: "Check stale version", method: "POST", path: "/1/check", form: url.Values{"version": {"1"}}, want: 412},
+		{name: "List checked", method: "GET", path: "/", want: 200, wantBody: `class="done"`},
+		{name: "Edit form", method: "GET", path: "/1/edit", want: 200, wantBody: `value="Buy milk"`},
+		{name: "Edit missing task", method: "GET", path: "/2/edit", want: 404},
+		{name: "Edit non-numeric", method: "GET", path: "/abc/edit", want: 404},
+		{name: "Save", method: "POST", path: "/1/edit", form: url.Values{"description": {"Buy <bread>"}, "version": {"2"}}, want: 303, wantLocation: "/"},
+		{name: "Save without version", method: "POST", path: "/1/edit", form: url.Values{"description": {"Buy bread"}}, want: 400},
+		{name: "List escaped", method: "GET", path: "/", want: 200, wantBody: "Buy &lt;bread&gt;"},
+		{name: "Delete stale version", method: "POST", path: "/1/delete", form: url.Values{"version": {"2"}}, want: 412},
+		{name: "Delete", method: "POST", path: "/1/delete", form: url.Values{"version": {"3"}}, want: 303, wantLocation: "/"},
+		{name: "List after delete", method: "GET", path: "/", want: 200, wantBody: "Nothing to do."},
+		{name: "Script", method: "GET", path: "/static/app.js", want: 200, wantBody: "data-enhance"},
+		{name: "Log out", method: "POST", path: "/logout", want: 303, wantLocation: "/login"},
+		{name: "List after log out", method: "GET", path: "/", want: 303, wantLocation: "/login"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			for key, values := range tt.form {
+				form[key] = values
+			}
+			if !tt.noCSRF {
+				form.Set(ui.CSRFField, b.cookie(ui.CSRFCookie))
+			}
+
+			var res *http.Response
+			var err error
+			if tt.method == "POST" {
+				res, err = b.PostForm(srv.URL+tt.path, form)
+			} else {
+				res, err = b.Get(srv.URL + tt.path)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+
+			if res.StatusCode != tt.want {
+				t.Fatalf("%s %s = %d, want %d: %s", tt.method, tt.path, res.StatusCode, tt.want, body)
+			}
+			if location := res.Header.Get("Location"); location != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", location, tt.wantLocation)
+			}
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("body does not contain %q: %s", tt.wantBody, body)
+			}
+			if res.StatusCode != http.StatusSeeOther && strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") && res.Header.Get("Content-Security-Policy") == "" {
+				t.Error("page served without a Content-Security-Policy")
+			}
+		})
+	}
+}
+
+func TestController_RevokesSessionOnLogOut(t *testing.T) {
+	srv := testServer(t)
+	b := newBrowser(t, srv)
+
+	b.Get(srv.URL + "/login")
+	csrf := b.cookie(ui.CSRFCookie)
+	b.PostForm(srv.URL+"/login", url.Values{"name": {"alice"}, "password": {"secret"}, ui.CSRFField: {csrf}})
+	session := b.cookie(ui.SessionCookie)
+	if session == "" {
+		t.Fatal("no session cookie after log in")
+	}
+
+	b.PostForm(srv.URL+"/logout", url.Values{ui.CSRFField: {csrf}})
+
+	r, _ := http.NewRequest("GET", srv.URL+"/", nil)
+	r.AddCookie(&http.Cookie{Name: ui.SessionCookie, Value: session})
+	res, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusSeeOther {
+		t.Errorf("status with the old session = %d, want %d", res.StatusCode, http.StatusSeeOther)
+	}
+}
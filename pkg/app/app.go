@@ -2,11 +2,14 @@ package app
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"os"
-	"os/user"
+	"path/filepath"
 
 	commandLine "github.com/imgabe/todo/pkg/cli"
+	"github.com/imgabe/todo/pkg/config"
+	"github.com/imgabe/todo/pkg/logging"
+	"github.com/imgabe/todo/pkg/models"
 	"github.com/imgabe/todo/pkg/store"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
@@ -14,27 +17,152 @@ import (
 	"github.com/urfave/cli/v2"
 )
 
-func DBPath() string {
-	user, err := user.Current()
-	if err != nil {
-		panic(err)
+// DBPath returns the default database file path
+func DBPath() (string, error) {
+	return store.DefaultPath()
+}
+
+// prepareDatabase makes sure the directory of the default database exists,
+// moving a database left by older versions into place if there is one.
+// Without a home directory, there is no such database to look for.
+func prepareDatabase(path string) error {
+	if legacy, err := store.LegacyPath(); err == nil {
+		migrated, err := store.MigrateLegacy(legacy, path)
+		if err != nil {
+			return err
+		}
+		if migrated {
+			logging.Default().Info("database moved", "from", legacy, "to", path, "backup", legacy+".bak")
+		}
 	}
 
-	return user.HomeDir + string(os.PathSeparator) + "database.todo"
+	return os.MkdirAll(filepath.Dir(path), 0700)
 }
 
-func OpenDatabase(path string) *sqlx.DB {
+// OpenDatabase opens the database at 'path' and applies the pending
+// migrations
+func OpenDatabase(path string) (*sqlx.DB, error) {
 	db, err := sqlx.Open("sqlite3", path)
 	if err != nil {
-		log.Fatalf("error opening database: %s", err)
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+
+	if err := store.Migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating database: %w", err)
+	}
+
+	return db, nil
+}
+
+// newLogger returns the logger configured by the --log-level and
+// --log-format flags, writing to stderr
+func newLogger(c *cli.Context) (*logging.Logger, error) {
+	level, err := logging.ParseLevel(c.String(string(commandLine.LogLevelFlagKey)))
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := logging.ParseFormat(c.String(string(commandLine.LogFormatFlagKey)))
+	if err != nil {
+		return nil, err
+	}
+
+	return logging.New(os.Stderr, level, format), nil
+}
+
+// openStores returns the function opening the database of --file before
+// a command runs, putting the stores it needs in the context. 'dbPathErr'
+// tells why there is no default database file, if there is none.
+func openStores(dbPathErr error) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		file := c.String(string(commandLine.FileFlagKey))
+		if !c.IsSet(string(commandLine.FileFlagKey)) {
+			if dbPathErr != nil {
+				return fmt.Errorf("no default database file, set one with --%s: %w", commandLine.FileFlagKey, dbPathErr)
+			}
+			if err := prepareDatabase(file); err != nil {
+				return err
+			}
+		}
+
+		db, err := OpenDatabase(file)
+		if err != nil {
+			return err
+		}
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return err
+		}
+		c.Context = context.WithValue(c.Context, commandLine.DatabaseContextKey, db)
+
+		us := store.UserStore{DB: db}
+		c.Context = context.WithValue(c.Context, commandLine.UserStoreContextKey, us)
+
+		ts := store.TaskStore{DB: db}
+		if name := c.String(string(commandLine.UserFlagKey)); name != "" {
+			user, err := us.SelectByName(name)
+			if err != nil {
+				return fmt.Errorf("unknown user '%s': %w", name, err)
+			}
+
+			ts = ts.ForOwner(user.ID)
+			c.Context = context.WithValue(c.Context, commandLine.UserContextKey, user)
+		}
+		c.Context = context.WithValue(c.Context, commandLine.TaskStoreContextKey, ts)
+
+		ss := store.ShareStore{DB: db}
+		c.Context = context.WithValue(c.Context, commandLine.ShareStoreContextKey, ss)
+
+		ws := store.WebhookStore{DB: db}
+		if user, ok := c.Context.Value(commandLine.UserContextKey).(models.User); ok {
+			ws = ws.ForOwner(user.ID)
+		}
+		c.Context = context.WithValue(c.Context, commandLine.WebhookStoreContextKey, ws)
+
+		tks := store.TokenStore{DB: db}
+		c.Context = context.WithValue(c.Context, commandLine.TokenStoreContextKey, tks)
+
+		is := store.IdempotencyStore{DB: db}
+		c.Context = context.WithValue(c.Context, commandLine.IdempotencyStoreContextKey, is)
+
+		c.Context = context.WithValue(c.Context, commandLine.SyncStoreContextKey, store.SyncStore{DB: db})
+
+		if _, ok := c.Context.Value(commandLine.TasksContextKey).(commandLine.Tasks); !ok {
+			var tasks commandLine.Tasks = ts
+			c.Context = context.WithValue(c.Context, commandLine.TasksContextKey, tasks)
+		}
+
+		return nil
 	}
+}
 
-	db.MustExec(store.CreateDatabaseStatement)
+// openTasks is like openStores for the task commands, which leave the
+// database alone when they act on a server with --remote
+func openTasks(dbPathErr error) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		if _, ok := c.Context.Value(commandLine.TasksContextKey).(commandLine.Tasks); ok {
+			return nil
+		}
 
-	return db
+		return openStores(dbPathErr)(c)
+	}
+}
+
+// closeDatabase closes the database opened before the command, if any
+func closeDatabase(c *cli.Context) error {
+	db, ok := c.Context.Value(commandLine.DatabaseContextKey).(*sqlx.DB)
+	if !ok {
+		return nil
+	}
+
+	return db.Close()
 }
 
 func openCliApp() *cli.App {
+	dbPath, dbPathErr := DBPath()
+	withStores, withTasks := openStores(dbPathErr), openTasks(dbPathErr)
+
 	return &cli.App{
 		Name:  "todo",
 		Usage: "keeps track of todos",
@@ -51,7 +179,7 @@ func openCliApp() *cli.App {
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:  string(commandLine.FileFlagKey),
-				Value: DBPath(),
+				Value: dbPath,
 				Usage: "database file",
 			},
 			&cli.BoolFlag{
@@ -59,67 +187,317 @@ func openCliApp() *cli.App {
 				Value: false,
 				Usage: "show done tasks",
 			},
+			&cli.StringFlag{
+				Name:  string(commandLine.UserFlagKey),
+				Usage: "act on the tasks of a web server user",
+			},
+			&cli.StringFlag{
+				Name:  string(commandLine.ConfigFlagKey),
+				Value: config.DefaultPath(),
+				Usage: "configuration file",
+			},
+			&cli.StringFlag{
+				Name:  string(commandLine.LogLevelFlagKey),
+				Value: logging.LevelInfo.String(),
+				Usage: "least important level logged: debug, info, warn or error",
+			},
+			&cli.StringFlag{
+				Name:  string(commandLine.LogFormatFlagKey),
+				Value: string(logging.FormatText),
+				Usage: "how logs are written to stderr: text (logfmt) or json",
+			},
+			&cli.StringFlag{
+				Name:    string(commandLine.RemoteFlagKey),
+				EnvVars: []string{"TODO_REMOTE"},
+				Usage:   "address of a 'todo web' server the task commands act on instead of the database",
+			},
+			&cli.StringFlag{
+				Name:    string(commandLine.TokenFlagKey),
+				EnvVars: []string{"TODO_TOKEN"},
+				Usage:   "API token sent to the server with --remote",
+			},
+			&cli.BoolFlag{
+				Name:    string(commandLine.OfflineFlagKey),
+				EnvVars: []string{"TODO_OFFLINE"},
+				Usage:   "keep the task commands on the database with --remote, syncing it with 'todo sync'",
+			},
 		},
 		Before: func(c *cli.Context) error {
-			file := c.String(string(commandLine.FileFlagKey))
-			db := OpenDatabase(file)
-			if err := db.Ping(); err != nil {
+			logger, err := newLogger(c)
+			if err != nil {
 				return err
 			}
-			c.Context = context.WithValue(c.Context, commandLine.DatabaseContextKey, db)
+			logging.SetDefault(logger)
+			c.Context = logging.NewContext(c.Context, logger)
+
+			remote, offline, err := commandLine.LoadRemote(c)
+			if err != nil {
+				return err
+			}
+			if remote != nil {
+				c.Context = context.WithValue(c.Context, commandLine.RemoteContextKey, remote)
+				if !offline {
+					var tasks commandLine.Tasks = commandLine.RemoteTasks{Context: c.Context, Client: remote}
+					c.Context = context.WithValue(c.Context, commandLine.TasksContextKey, tasks)
+				}
+			}
 
-			ts := store.TaskStore{DB: db}
-			c.Context = context.WithValue(c.Context, commandLine.TaskStoreContextKey, ts)
 			return nil
 		},
-		After: func(c *cli.Context) error {
-			db := c.Context.Value(commandLine.DatabaseContextKey).(*sqlx.DB)
-			err := db.Close()
-			return err
-		},
 		Commands: []*cli.Command{
 			{
 				Name:   "add",
 				Usage:  "adds a new task",
+				Before: withTasks,
+				After:  closeDatabase,
 				Action: commandLine.AddTask,
 			},
 			{
 				Name:   "check",
 				Usage:  "check a task by ID",
+				Before: withTasks,
+				After:  closeDatabase,
 				Action: commandLine.CheckTask,
 			},
 			{
 				Name:   "list",
 				Usage:  "lists all tasks",
+				Before: withTasks,
+				After:  closeDatabase,
 				Action: commandLine.ListTasks,
 			},
 			{
 				Name:   "edit",
 				Usage:  "edit a task",
+				Before: withTasks,
+				After:  closeDatabase,
 				Action: commandLine.EditTask,
 			},
 			{
 				Name:   "remove",
 				Usage:  "remove a task by ID",
+				Before: withTasks,
+				After:  closeDatabase,
 				Action: commandLine.RemoveTask,
 			},
 			{
 				Name:   "show",
 				Usage:  "show a task by ID",
+				Before: withTasks,
+				After:  closeDatabase,
 				Action: commandLine.ShowTask,
 			},
 			{
-				Name:   "web",
-				Usage:  "starts a web server",
-				Action: commandLine.Webserver,
+				Name:   "sync",
+				Usage:  "sync the database with the server set with --remote, or another database with --peer",
+				Before: withStores,
+				After:  closeDatabase,
+				Action: commandLine.SyncTasks,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  string(commandLine.StrategyFlagKey),
+						Value: string(models.MergeLastWriter),
+						Usage: "how tasks changed on both sides are merged: lww keeps the task changed last, field each field changed last",
+					},
+					&cli.StringFlag{
+						Name:  string(commandLine.PeerFlagKey),
+						Usage: "sync with the database at this file:// URL instead of the server",
+					},
+				},
+			},
+			{
+				Name:      "assign",
+				Usage:     "assign a task by ID to a user, or unassign it without user",
+				Before:    withStores,
+				After:     closeDatabase,
+				ArgsUsage: "<id> [user]",
+				Action:    commandLine.AssignTask,
+			},
+			{
+				Name:      "share",
+				Usage:     "share the tasks of --user with another user, or list shares without arguments",
+				Before:    withStores,
+				After:     closeDatabase,
+				ArgsUsage: "[user] [read|write]",
+				Action:    commandLine.ShareTasks,
+			},
+			{
+				Name:      "unshare",
+				Usage:     "stop sharing the tasks of --user with another user",
+				Before:    withStores,
+				After:     closeDatabase,
+				ArgsUsage: "<user>",
+				Action:    commandLine.UnshareTasks,
+			},
+			{
+				Name:   "user",
+				Usage:  "manages web server users",
+				Before: withStores,
+				After:  closeDatabase,
+				Subcommands: []*cli.Command{
+					{
+						Name:      "add",
+						Usage:     "adds a new user, reading the password from stdin",
+						ArgsUsage: "<name>",
+						Action:    commandLine.AddUser,
+					},
+					{
+						Name:   "list",
+						Usage:  "lists all users",
+						Action: commandLine.ListUsers,
+					},
+				},
+			},
+			{
+				Name:   "token",
+				Usage:  "manages API tokens for the web server",
+				Before: withStores,
+				After:  closeDatabase,
+				Subcommands: []*cli.Command{
+					{
+						Name:      "create",
+						Usage:     "creates a new token",
+						ArgsUsage: "<name>",
+						Action:    commandLine.CreateToken,
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:  string(commandLine.ScopesFlagKey),
+								Value: cli.NewStringSlice(string(models.ScopeRead), string(models.ScopeWrite)),
+								Usage: "scopes granted to the token (read, write, admin)",
+							},
+							&cli.DurationFlag{
+								Name:  string(commandLine.ExpiresFlagKey),
+								Usage: "time until the token expires, never if unset",
+							},
+						},
+					},
+					{
+						Name:   "list",
+						Usage:  "lists all tokens",
+						Action: commandLine.ListTokens,
+					},
+					{
+						Name:      "revoke",
+						Usage:     "revokes a token by ID",
+						ArgsUsage: "<id>",
+						Action:    commandLine.RevokeToken,
+					},
+				},
+			},
+			{
+				Name:   "webhook",
+				Usage:  "manages webhooks notified by the web server of the events on the tasks of --user, or without owner",
+				Before: withStores,
+				After:  closeDatabase,
+				Subcommands: []*cli.Command{
+					{
+						Name:      "add",
+						Usage:     "adds a new webhook",
+						ArgsUsage: "<url>",
+						Action:    commandLine.AddWebhook,
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:  string(commandLine.EventsFlagKey),
+								Value: cli.NewStringSlice(commandLine.WebhookEvents...),
+								Usage: "events delivered to the webhook",
+							},
+						},
+					},
+					{
+						Name:   "list",
+						Usage:  "lists all webhooks",
+						Action: commandLine.ListWebhooks,
+					},
+					{
+						Name:      "remove",
+						Usage:     "removes a webhook by ID",
+						ArgsUsage: "<id>",
+						Action:    commandLine.RemoveWebhook,
+					},
+					{
+						Name:   "deliveries",
+						Usage:  "lists the latest delivery attempts",
+						Action: commandLine.ListDeliveries,
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:  string(commandLine.LimitFlagKey),
+								Value: 20,
+								Usage: "number of attempts shown",
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:      "web",
+				Usage:     "starts a web server",
+				Before:    withStores,
+				After:     closeDatabase,
+				ArgsUsage: "[port]",
+				Action:    commandLine.Webserver,
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  string(commandLine.ShutdownTimeoutFlagKey),
+						Value: config.Default().Web.ShutdownTimeout.Duration,
+						Usage: "time to wait for in-flight requests on shutdown",
+					},
+					&cli.StringFlag{
+						Name:  string(commandLine.ListenFlagKey),
+						Value: config.Default().Web.Listen,
+						Usage: "address to listen on, 'host:port' or 'unix:/path/to.sock'",
+					},
+					&cli.StringFlag{
+						Name:  string(commandLine.TLSCertFlagKey),
+						Usage: "TLS certificate file",
+					},
+					&cli.StringFlag{
+						Name:  string(commandLine.TLSKeyFlagKey),
+						Usage: "TLS key file",
+					},
+					&cli.BoolFlag{
+						Name:  string(commandLine.TLSSelfSignedFlagKey),
+						Usage: "serve HTTPS with a generated self-signed certificate",
+					},
+					&cli.BoolFlag{
+						Name:  string(commandLine.GRPCFlagKey),
+						Usage: "serve gRPC alongside HTTP",
+					},
+					&cli.StringFlag{
+						Name:  string(commandLine.GRPCListenFlagKey),
+						Value: config.Default().GRPC.Listen,
+						Usage: "address the gRPC server listens on with --grpc",
+					},
+				},
+			},
+			{
+				Name:   "grpc",
+				Usage:  "starts a gRPC server",
+				Before: withStores,
+				After:  closeDatabase,
+				Action: commandLine.GRPCServer,
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  string(commandLine.ShutdownTimeoutFlagKey),
+						Value: config.Default().GRPC.ShutdownTimeout.Duration,
+						Usage: "time to wait for in-flight calls on shutdown",
+					},
+					&cli.StringFlag{
+						Name:  string(commandLine.ListenFlagKey),
+						Value: config.Default().GRPC.Listen,
+						Usage: "address to listen on, 'host:port' or 'unix:/path/to.sock'",
+					},
+				},
 			},
 		},
 	}
 }
 
+// Run runs the CLI, exiting with a code telling the kind of error apart
+// when a command fails
 func Run() {
 	err := openCliApp().Run(os.Args)
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintf(os.Stderr, "todo: %s\n", err)
+		os.Exit(commandLine.ExitCode(err))
 	}
 }
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	stderrors "errors"
+	"fmt"
+	"strconv"
+
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/store"
+)
+
+// Exit codes returned by the CLI, so scripts can tell failures apart
+const (
+	// ExitFailure is returned for errors without a more specific code
+	ExitFailure = 1
+	// ExitInvalid is returned when arguments or records are rejected
+	ExitInvalid = 2
+	// ExitNotFound is returned when a task, user, token or webhook does not exist
+	ExitNotFound = 3
+	// ExitConflict is returned when a record clashes with an existing one, or
+	// was changed on the server since it was read
+	ExitConflict = 4
+	// ExitUnauthorized is returned when a name and password do not match, or
+	// when the server rejects the token
+	ExitUnauthorized = 5
+)
+
+// ExitCode returns the exit code the CLI finishes with after 'err'
+func ExitCode(err error) int {
+	var validation store.ValidationError
+	var problem *errors.ErrResponse
+
+	switch {
+	case err == nil:
+		return 0
+	case stderrors.As(err, &validation):
+		return ExitInvalid
+	case stderrors.Is(err, store.ErrNotFound):
+		return ExitNotFound
+	case stderrors.Is(err, store.ErrConflict):
+		return ExitConflict
+	case stderrors.Is(err, store.ErrInvalidCredentials):
+		return ExitUnauthorized
+	case stderrors.As(err, &problem):
+		return problemExitCode(problem.HTTPStatusCode)
+	}
+
+	return ExitFailure
+}
+
+// problemExitCode returns the exit code matching the status of a problem
+// document sent by the server in remote mode
+func problemExitCode(status int) int {
+	switch status {
+	case 400, 422:
+		return ExitInvalid
+	case 401, 403:
+		return ExitUnauthorized
+	case 404:
+		return ExitNotFound
+	case 409, 412:
+		return ExitConflict
+	}
+
+	return ExitFailure
+}
+
+// invalid returns a validation error for a command argument
+func invalid(field, format string, a ...interface{}) error {
+	return store.ValidationError{Field: field, Message: fmt.Sprintf(format, a...)}
+}
+
+// unknownUser returns the error reported for a user name that does not exist
+func unknownUser(name string) error {
+	return fmt.Errorf("unknown user '%s': %w", name, store.ErrNotFound)
+}
+
+// parseID parses the ID argument of a command
+func parseID(arg string) (int64, error) {
+	if arg == "" {
+		return 0, invalid("id", "missing")
+	}
+
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, invalid("id", "'%s' is not a number", arg)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/imgabe/todo/pkg/api/rpc"
+	"github.com/imgabe/todo/pkg/api/web"
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/api/web/limit"
+	"github.com/imgabe/todo/pkg/config"
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/logging"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/imgabe/todo/pkg/webhooks"
+	"github.com/urfave/cli/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var (
+	// GRPCFlagKey is the flag key to serve gRPC alongside the web server
+	GRPCFlagKey FlagKey = "grpc"
+	// GRPCListenFlagKey is the flag key used to store the gRPC server
+	// address when started by the web server
+	GRPCListenFlagKey FlagKey = "grpc-listen"
+)
+
+// GRPCServer is responsible for the 'grpc' command on the CLI
+func GRPCServer(c *cli.Context) error {
+	ts := c.Context.Value(TaskStoreContextKey).(store.TaskStore)
+
+	cfg, err := loadGRPCConfig(c, ListenFlagKey)
+	if err != nil {
+		return err
+	}
+	webCfg, err := config.Load(c.String(string(ConfigFlagKey)))
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := grpcTLS(webCfg.Web, cfg, nil)
+	if err != nil {
+		return err
+	}
+
+	broker := events.NewBroker()
+	ts.Events = broker
+
+	server := newGRPCServer(c, ts, broker, cfg, tlsConfig)
+
+	listener, err := web.Listen(cfg.Listen)
+	if err != nil {
+		return err
+	}
+
+	dispatcher := webhooks.NewDispatcher(c.Context.Value(WebhookStoreContextKey).(store.WebhookStore))
+	stop := dispatch(dispatcher, broker, cfg.ShutdownTimeout.Duration)
+	defer stop()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serveGRPC(server, listener, cfg)
+	}()
+
+	select {
+	case err := <-errs:
+		broker.Close()
+		return err
+	case sig := <-signals:
+		logging.Default().Info("shutting down", "signal", sig, "timeout", cfg.ShutdownTimeout.Duration)
+		broker.Close()
+		stopGRPC(server, cfg.ShutdownTimeout.Duration)
+		return nil
+	}
+}
+
+// loadGRPCConfig reads the 'grpc' section of the configuration file,
+// letting command line flags take precedence. 'listen' is the flag holding
+// the address, which differs between the 'grpc' and 'web' commands.
+func loadGRPCConfig(c *cli.Context, listen FlagKey) (config.GRPC, error) {
+	cfg, err := config.Load(c.String(string(ConfigFlagKey)))
+	if err != nil {
+		return cfg.GRPC, err
+	}
+
+	if c.IsSet(string(GRPCFlagKey)) {
+		cfg.GRPC.Enabled = c.Bool(string(GRPCFlagKey))
+	}
+	if c.IsSet(string(listen)) {
+		cfg.GRPC.Listen = c.String(string(listen))
+	}
+	if c.IsSet(string(ShutdownTimeoutFlagKey)) {
+		cfg.GRPC.ShutdownTimeout.Duration = c.Duration(string(ShutdownTimeoutFlagKey))
+	}
+
+	return cfg.GRPC, nil
+}
+
+// grpcTLS returns the TLS configuration of the gRPC server, the one of the
+// web server, 'tlsConfig' when already loaded. Without one, gRPC is only
+// served on the loopback interface or a unix socket, since tokens would
+// otherwise be sent in the clear.
+func grpcTLS(webCfg config.Web, cfg config.GRPC, tlsConfig *tls.Config) (*tls.Config, error) {
+	if tlsConfig == nil {
+		var err error
+		webCfg.Listen = cfg.Listen
+		if tlsConfig, err = web.TLSConfig(webCfg); err != nil {
+			return nil, err
+		}
+	}
+	if tlsConfig != nil || strings.HasPrefix(cfg.Listen, "unix:") {
+		return tlsConfig, nil
+	}
+
+	host, _, err := net.SplitHostPort(cfg.Listen)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("gRPC is only served on %s with TLS, set 'tls_cert' and 'tls_key' in the configuration file", cfg.Listen)
+	}
+
+	return nil, nil
+}
+
+// newGRPCServer returns the gRPC server of the stores of the command,
+// publishing task events to 'broker', over TLS when 'tlsConfig' is set
+func newGRPCServer(c *cli.Context, ts store.TaskStore, broker *events.Broker, cfg config.GRPC, tlsConfig *tls.Config) *grpc.Server {
+	var limiter *limit.Limiter
+	if cfg.RateLimit > 0 {
+		limiter = limit.NewLimiter(cfg.RateLimit, cfg.RateBurst)
+	}
+
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	return rpc.NewServer(rpc.Stores{
+		Tasks: func(ctx context.Context, ownerID int64) controllers.TaskStore {
+			return ts.ForOwner(ownerID).WithLogger(logging.FromContext(ctx))
+		},
+		Tokens: c.Context.Value(TokenStoreContextKey).(store.TokenStore),
+		Users:  c.Context.Value(UserStoreContextKey).(store.UserStore),
+		Events: broker,
+	}, limiter, opts...)
+}
+
+func serveGRPC(server *grpc.Server, listener net.Listener, cfg config.GRPC) error {
+	logging.Default().Info("running grpc server", "address", cfg.Listen)
+	return server.Serve(listener)
+}
+
+// stopGRPC waits up to 'timeout' for in-flight calls, then cancels them
+func stopGRPC(server *grpc.Server, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		server.Stop()
+		<-done
+	}
+
+	logging.Default().Info("grpc server stopped")
+}
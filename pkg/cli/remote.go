@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/imgabe/todo/pkg/client"
+	"github.com/imgabe/todo/pkg/config"
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	// TasksContextKey is the context key used to store the tasks acted upon
+	// by the task commands, either local or remote
+	TasksContextKey ContextKey = "tasks"
+	// RemoteFlagKey is the flag key used to store the address of the server
+	// the task commands talk to
+	RemoteFlagKey FlagKey = "remote"
+	// TokenFlagKey is the flag key used to store the API token sent to the
+	// server in remote mode
+	TokenFlagKey FlagKey = "token"
+)
+
+// LoadRemote returns the client of the server set with --remote or in the
+// 'remote' section of the configuration file, or nil when there is none,
+// and whether the task commands act on the local database anyway, syncing
+// it with the server through 'todo sync'
+func LoadRemote(c *cli.Context) (*client.Client, bool, error) {
+	cfg, err := config.Load(c.String(string(ConfigFlagKey)))
+	if err != nil {
+		return nil, false, err
+	}
+
+	remote := cfg.Remote
+	if c.IsSet(string(RemoteFlagKey)) {
+		remote.URL = c.String(string(RemoteFlagKey))
+	}
+	if c.IsSet(string(TokenFlagKey)) {
+		remote.Token = c.String(string(TokenFlagKey))
+	}
+	if c.IsSet(string(OfflineFlagKey)) {
+		remote.Offline = c.Bool(string(OfflineFlagKey))
+	}
+
+	if remote.URL == "" {
+		return nil, false, nil
+	}
+	if c.IsSet(string(UserFlagKey)) {
+		return nil, false, fmt.Errorf("--%s cannot be used with --%s, the server acts on behalf of the user of the token", UserFlagKey, RemoteFlagKey)
+	}
+
+	u, err := url.Parse(remote.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, false, invalid(string(RemoteFlagKey), "'%s' is not an http or https URL", remote.URL)
+	}
+
+	return client.New(remote.URL, remote.Token), remote.Offline, nil
+}
+
+// Tasks holds the tasks acted upon by the 'add', 'list', 'check', 'edit',
+// 'remove' and 'show' commands, implemented by 'store.TaskStore' for the
+// local database and by 'RemoteTasks' for a server
+type Tasks interface {
+	Insert(task models.Task) (models.Task, error)
+	Select(task models.Task) (models.Task, error)
+	SelectAll(done bool, page models.Page) ([]models.Task, error)
+	Update(task models.Task) (models.Task, error)
+	Check(taskID int64) error
+	Delete(taskID int64) error
+}
+
+var _ Tasks = store.TaskStore{}
+var _ Tasks = RemoteTasks{}
+
+// RemoteTasks acts on the tasks of the user of the client's token through
+// the '/tasks' API of a 'todo web' server
+type RemoteTasks struct {
+	Context context.Context
+	Client  *client.Client
+}
+
+func (r RemoteTasks) Insert(task models.Task) (models.Task, error) {
+	return r.Client.CreateTask(r.Context, task)
+}
+
+func (r RemoteTasks) Select(task models.Task) (models.Task, error) {
+	return r.Client.GetTask(r.Context, task.ID)
+}
+
+// SelectAll reads the tasks of 'page' of the user, leaving the done ones
+// out unless 'done' is set
+func (r RemoteTasks) SelectAll(done bool, page models.Page) ([]models.Task, error) {
+	tasks, err := r.Client.ListTasks(r.Context, client.ListOptions{After: page.After, Limit: page.Limit})
+	if err != nil || done {
+		return tasks, err
+	}
+
+	open := tasks[:0]
+	for _, task := range tasks {
+		if !task.Done {
+			open = append(open, task)
+		}
+	}
+
+	return open, nil
+}
+
+func (r RemoteTasks) Update(task models.Task) (models.Task, error) {
+	return r.Client.UpdateTask(r.Context, task)
+}
+
+func (r RemoteTasks) Check(taskID int64) error {
+	done := true
+	_, err := r.Client.PatchTask(r.Context, taskID, 0, models.TaskPatch{Done: &done})
+
+	return err
+}
+
+func (r RemoteTasks) Delete(taskID int64) error {
+	_, err := r.Client.DeleteTask(r.Context, taskID, 0)
+
+	return err
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/urfave/cli/v2"
+)
+
+// AssignTask is responsible for the 'assign' command on the CLI
+func AssignTask(c *cli.Context) error {
+	ts := c.Context.Value(TaskStoreContextKey).(store.TaskStore)
+	us := c.Context.Value(UserStoreContextKey).(store.UserStore)
+
+	taskID, err := parseID(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	name := c.Args().Get(1)
+	if name == "" {
+		if _, err := ts.Assign(taskID, 0); err != nil {
+			return fmt.Errorf("task (%d): %w", taskID, err)
+		}
+
+		fmt.Printf("task (%d) successfully unassigned\n", taskID)
+		return nil
+	}
+
+	user, err := us.SelectByName(name)
+	if err != nil {
+		return unknownUser(name)
+	}
+
+	if _, err := ts.Assign(taskID, user.ID); err != nil {
+		return fmt.Errorf("task (%d): %w", taskID, err)
+	}
+
+	fmt.Printf("task (%d) successfully assigned to %s\n", taskID, user.Name)
+	return nil
+}
+
+// ShareTasks is responsible for the 'share' command on the CLI
+func ShareTasks(c *cli.Context) error {
+	ss := c.Context.Value(ShareStoreContextKey).(store.ShareStore)
+	us := c.Context.Value(UserStoreContextKey).(store.UserStore)
+
+	owner, ok := c.Context.Value(UserContextKey).(models.User)
+	if !ok {
+		return invalid("user", "--%s is required to share tasks", UserFlagKey)
+	}
+
+	if c.Args().Len() == 0 {
+		shares, err := ss.SelectAll(owner.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, share := range shares {
+			user, err := us.Select(share.UserID)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s %s\n", user.Name, share.Permission)
+		}
+
+		return nil
+	}
+
+	user, err := us.SelectByName(c.Args().Get(0))
+	if err != nil {
+		return unknownUser(c.Args().Get(0))
+	}
+
+	permission := models.PermissionRead
+	if arg := c.Args().Get(1); arg != "" {
+		if permission, ok = models.ParsePermission(arg); !ok {
+			return invalid("permission", "must be '%s' or '%s'", models.PermissionRead, models.PermissionWrite)
+		}
+	}
+
+	err = ss.Upsert(models.Share{OwnerID: owner.ID, UserID: user.ID, Permission: permission})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("tasks of %s successfully shared with %s (%s)\n", owner.Name, user.Name, permission)
+	return nil
+}
+
+// UnshareTasks is responsible for the 'unshare' command on the CLI
+func UnshareTasks(c *cli.Context) error {
+	ss := c.Context.Value(ShareStoreContextKey).(store.ShareStore)
+	us := c.Context.Value(UserStoreContextKey).(store.UserStore)
+
+	owner, ok := c.Context.Value(UserContextKey).(models.User)
+	if !ok {
+		return invalid("user", "--%s is required to unshare tasks", UserFlagKey)
+	}
+
+	user, err := us.SelectByName(c.Args().First())
+	if err != nil {
+		return unknownUser(c.Args().First())
+	}
+
+	err = ss.Delete(owner.ID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("tasks of %s are no longer shared with %s\n", owner.Name, user.Name)
+	return nil
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/imgabe/todo/pkg/client"
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/jmoiron/sqlx"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	// RemoteContextKey is the context key used to store the client of the
+	// server set with --remote, if any
+	RemoteContextKey ContextKey = "remote"
+	// SyncStoreContextKey is the context key used to store the sync store
+	SyncStoreContextKey ContextKey = "syncstore"
+	// OfflineFlagKey is the flag key to keep the task commands on the
+	// database while a server is set, syncing them with 'todo sync'
+	OfflineFlagKey FlagKey = "offline"
+	// StrategyFlagKey is the flag key used to store how 'todo sync' merges
+	// tasks changed on both sides
+	StrategyFlagKey FlagKey = "strategy"
+	// PeerFlagKey is the flag key used to store the 'file://' URL of the
+	// database 'todo sync' syncs with instead of the server
+	PeerFlagKey FlagKey = "peer"
+)
+
+// SyncTasks is responsible for the 'sync' command on the CLI
+func SyncTasks(c *cli.Context) error {
+	ss := c.Context.Value(SyncStoreContextKey).(store.SyncStore)
+
+	strategy := models.MergeStrategy(c.String(string(StrategyFlagKey)))
+	if !strategy.Valid() {
+		return invalid(string(StrategyFlagKey), "'%s' is not 'lww' or 'field'", strategy)
+	}
+
+	if peer := c.String(string(PeerFlagKey)); peer != "" {
+		return syncPeer(c, ss, peer, strategy)
+	}
+
+	remote, ok := c.Context.Value(RemoteContextKey).(*client.Client)
+	if !ok {
+		return invalid(string(RemoteFlagKey), "a server is required to sync with, set with --%s or in the configuration file", RemoteFlagKey)
+	}
+
+	result, err := remote.Sync(c.Context, ss, strategy)
+	if err != nil {
+		return fmt.Errorf("syncing with %s: %w", remote.BaseURL, err)
+	}
+
+	fmt.Printf("%d changes pushed to %s, %d pulled\n", result.Pushed, remote.BaseURL, result.Pulled)
+	for _, conflict := range result.Conflicts {
+		fmt.Println(describeConflict(conflict, "server"))
+	}
+
+	return nil
+}
+
+// syncPeer syncs the database with the one at the 'file://' URL 'peer'
+func syncPeer(c *cli.Context, ss store.SyncStore, peer string, strategy models.MergeStrategy) error {
+	u, err := url.Parse(peer)
+	if err != nil || u.Scheme != "file" || (u.Host != "" && u.Host != "localhost") || u.Path == "" {
+		return invalid(string(PeerFlagKey), "'%s' is not a file:// URL", peer)
+	}
+
+	path, err := filepath.Abs(u.Path)
+	if err != nil {
+		return err
+	}
+	local, err := filepath.Abs(c.String(string(FileFlagKey)))
+	if err != nil {
+		return err
+	}
+	if path == local {
+		return invalid(string(PeerFlagKey), "'%s' is the database being synced", peer)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return invalid(string(PeerFlagKey), "%s", err)
+	}
+
+	db, err := sqlx.Open("sqlite3", path)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer db.Close()
+	if err := store.Migrate(db); err != nil {
+		return fmt.Errorf("migrating %s: %w", path, err)
+	}
+
+	result, err := ss.SyncPeer(store.SyncStore{DB: db}, "file://"+local, "file://"+path, strategy)
+	if err != nil {
+		return fmt.Errorf("syncing with %s: %w", path, err)
+	}
+
+	fmt.Printf("%d tasks changed here, %d in %s\n", result.Applied, result.PeerApplied, path)
+	for _, conflict := range result.Conflicts {
+		fmt.Println(describeConflict(conflict, "peer"))
+	}
+
+	return nil
+}
+
+// describeConflict tells what a sync kept of a task changed both locally
+// and on 'remote', the server or peer, which is 'ours' in its conflicts
+func describeConflict(conflict models.SyncConflict, remote string) string {
+	if conflict.Field == "deleted" {
+		deleted, changed := "on the "+remote, "locally"
+		if conflict.Ours != "deleted" {
+			deleted, changed = changed, deleted
+		}
+
+		kept := conflict.Ours
+		if conflict.Kept == "theirs" {
+			kept = conflict.Theirs
+		}
+		if kept == "deleted" {
+			return fmt.Sprintf("task '%s' was deleted %s and changed %s, it stays deleted", conflict.Description, deleted, changed)
+		}
+
+		return fmt.Sprintf("task '%s' was deleted %s and changed %s later, it is kept", conflict.Description, deleted, changed)
+	}
+
+	kept, lost := "local", remote
+	keptValue, lostValue := conflict.Theirs, conflict.Ours
+	if conflict.Kept == "ours" {
+		kept, lost = lost, kept
+		keptValue, lostValue = lostValue, keptValue
+	}
+
+	return fmt.Sprintf("task '%s': %s changed on both sides, kept the %s value '%s' over the %s value '%s'",
+		conflict.Description, conflict.Field, kept, keptValue, lost, lostValue)
+}
@@ -1,15 +1,30 @@
 package cli
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/imgabe/todo/pkg/api/web"
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/api/web/idempotency"
+	"github.com/imgabe/todo/pkg/api/web/limit"
+	"github.com/imgabe/todo/pkg/config"
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/logging"
 	"github.com/imgabe/todo/pkg/models"
 	"github.com/imgabe/todo/pkg/store"
+	"github.com/imgabe/todo/pkg/webhooks"
 	"github.com/urfave/cli/v2"
+	"google.golang.org/grpc"
 )
 
 // FlagKey is used as a key type on CLI flags
@@ -21,17 +36,49 @@ type ContextKey string
 var (
 	// TaskStoreContextKey is the context key used to store the task store
 	TaskStoreContextKey ContextKey = "taskstore"
+	// TokenStoreContextKey is the context key used to store the token store
+	TokenStoreContextKey ContextKey = "tokenstore"
+	// UserStoreContextKey is the context key used to store the user store
+	UserStoreContextKey ContextKey = "userstore"
+	// ShareStoreContextKey is the context key used to store the share store
+	ShareStoreContextKey ContextKey = "sharestore"
+	// WebhookStoreContextKey is the context key used to store the webhook store
+	WebhookStoreContextKey ContextKey = "webhookstore"
+	// IdempotencyStoreContextKey is the context key used to store the idempotency store
+	IdempotencyStoreContextKey ContextKey = "idempotencystore"
+	// UserContextKey is the context key used to store the user selected with --user
+	UserContextKey ContextKey = "user"
 	// DatabaseContextKey is the context key used to store the database
 	DatabaseContextKey ContextKey = "db"
 	// FileFlagKey is the flag key used to store the database file path
 	FileFlagKey FlagKey = "file"
 	// DoneFlagKey is the flag key to decide the visualization of done tasks
 	DoneFlagKey FlagKey = "done"
+	// UserFlagKey is the flag key used to store the name of the user acted upon
+	UserFlagKey FlagKey = "user"
+	// ConfigFlagKey is the flag key used to store the configuration file path
+	ConfigFlagKey FlagKey = "config"
+	// ShutdownTimeoutFlagKey is the flag key used to store how long the web
+	// server waits for in-flight requests when stopping
+	ShutdownTimeoutFlagKey FlagKey = "shutdown-timeout"
+	// ListenFlagKey is the flag key used to store the web server address
+	ListenFlagKey FlagKey = "listen"
+	// TLSCertFlagKey is the flag key used to store the TLS certificate file
+	TLSCertFlagKey FlagKey = "tls-cert"
+	// TLSKeyFlagKey is the flag key used to store the TLS key file
+	TLSKeyFlagKey FlagKey = "tls-key"
+	// TLSSelfSignedFlagKey is the flag key to serve HTTPS with a generated certificate
+	TLSSelfSignedFlagKey FlagKey = "tls-self-signed"
+	// LogLevelFlagKey is the flag key used to store the least important
+	// level logged
+	LogLevelFlagKey FlagKey = "log-level"
+	// LogFormatFlagKey is the flag key used to store how logs are written
+	LogFormatFlagKey FlagKey = "log-format"
 )
 
 // AddTask is responsible for the 'add' command on the CLI
 func AddTask(c *cli.Context) error {
-	ts := c.Context.Value(TaskStoreContextKey).(store.TaskStore)
+	ts := c.Context.Value(TasksContextKey).(Tasks)
 
 	description := c.Args().First()
 	task, err := ts.Insert(models.Task{Description: description})
@@ -45,9 +92,9 @@ func AddTask(c *cli.Context) error {
 
 // ListTasks is responsible for the 'list' command on the CLI
 func ListTasks(c *cli.Context) error {
-	ts := c.Context.Value(TaskStoreContextKey).(store.TaskStore)
+	ts := c.Context.Value(TasksContextKey).(Tasks)
 
-	tasks, err := ts.SelectAll(c.Bool(string(DoneFlagKey)))
+	tasks, err := ts.SelectAll(c.Bool(string(DoneFlagKey)), models.Page{})
 	if err != nil {
 		return err
 	}
@@ -69,17 +116,16 @@ func ListTasks(c *cli.Context) error {
 
 // Checktask is responsible for the 'check' command on the CLI
 func CheckTask(c *cli.Context) error {
-	ts := c.Context.Value(TaskStoreContextKey).(store.TaskStore)
+	ts := c.Context.Value(TasksContextKey).(Tasks)
 
-	tmp := c.Args().First()
-	taskID, err := strconv.Atoi(tmp)
+	taskID, err := parseID(c.Args().First())
 	if err != nil {
 		return err
 	}
 
-	err = ts.Check(int64(taskID))
+	err = ts.Check(taskID)
 	if err != nil {
-		return err
+		return fmt.Errorf("task (%d): %w", taskID, err)
 	}
 
 	fmt.Printf("task (%d) successfully check\n", taskID)
@@ -88,17 +134,16 @@ func CheckTask(c *cli.Context) error {
 
 // RemoveTask is responsible for the 'remove' command on the CLI
 func RemoveTask(c *cli.Context) error {
-	ts := c.Context.Value(TaskStoreContextKey).(store.TaskStore)
+	ts := c.Context.Value(TasksContextKey).(Tasks)
 
-	tmp := c.Args().First()
-	taskID, err := strconv.Atoi(tmp)
+	taskID, err := parseID(c.Args().First())
 	if err != nil {
 		return err
 	}
 
-	err = ts.Delete(int64(taskID))
+	err = ts.Delete(taskID)
 	if err != nil {
-		return err
+		return fmt.Errorf("task (%d): %w", taskID, err)
 	}
 
 	fmt.Printf("task (%d) successfully removed\n", taskID)
@@ -107,30 +152,27 @@ func RemoveTask(c *cli.Context) error {
 
 // EditTask is responsible for the 'edit' command on the CLI
 func EditTask(c *cli.Context) error {
-	ts := c.Context.Value(TaskStoreContextKey).(store.TaskStore)
+	ts := c.Context.Value(TasksContextKey).(Tasks)
 
-	taskID, err := strconv.ParseInt(c.Args().Get(0), 10, 64)
+	taskID, err := parseID(c.Args().Get(0))
 	if err != nil {
-		fmt.Println("Missing ID field or is not a number")
 		return err
 	}
 
 	taskDescription := c.Args().Get(1)
 	if len(taskDescription) == 0 {
-		fmt.Println("Missing description field")
-		return nil
+		return invalid("description", "missing")
 	}
 
 	tmp := c.Args().Get(2)
 	taskDone, err := strconv.ParseBool(tmp)
 	if err != nil {
-		fmt.Println("Missing done field")
-		return err
+		return invalid("done", "missing or not 'true' or 'false'")
 	}
 
-	newTask, err := ts.Update(models.Task{ID: int64(taskID), Description: taskDescription, Done: taskDone})
+	newTask, err := ts.Update(models.Task{ID: taskID, Description: taskDescription, Done: taskDone})
 	if err != nil {
-		return err
+		return fmt.Errorf("task (%d): %w", taskID, err)
 	}
 
 	fmt.Printf("task (%d) successfully edited\n", newTask.ID)
@@ -139,16 +181,15 @@ func EditTask(c *cli.Context) error {
 
 // ShowTask is responsible for the 'show' command on the CLI
 func ShowTask(c *cli.Context) error {
-	ts := c.Context.Value(TaskStoreContextKey).(store.TaskStore)
-	taskID, err := strconv.ParseInt(c.Args().First(), 10, 64)
-
+	ts := c.Context.Value(TasksContextKey).(Tasks)
+	taskID, err := parseID(c.Args().First())
 	if err != nil {
 		return err
 	}
 
 	task, err := ts.Select(models.Task{ID: taskID})
 	if err != nil {
-		return err
+		return fmt.Errorf("task (%d): %w", taskID, err)
 	}
 
 	fmt.Printf("%d %s %s\n", task.ID, check(task.Done), task.Description)
@@ -157,13 +198,248 @@ func ShowTask(c *cli.Context) error {
 
 // Webserver is responsible for the 'web' command on the CLI
 func Webserver(c *cli.Context) error {
-	port := c.Args().First()
+	ts := c.Context.Value(TaskStoreContextKey).(store.TaskStore)
+	tks := c.Context.Value(TokenStoreContextKey).(store.TokenStore)
+	us := c.Context.Value(UserStoreContextKey).(store.UserStore)
+
+	cfg, err := loadWebConfig(c)
+	if err != nil {
+		return err
+	}
+	grpcCfg, err := loadGRPCConfig(c, GRPCListenFlagKey)
+	if err != nil {
+		return err
+	}
 
-	router := web.NewRouter()
-	server := web.NewServer(port, router)
+	broker := events.NewBroker()
+	ts.Events = broker
+
+	is := c.Context.Value(IdempotencyStoreContextKey).(store.IdempotencyStore)
+	ctx, cancel := context.WithCancel(c.Context)
+	defer cancel()
+	go idempotency.Cleanup(ctx, is, cfg.IdempotencyWindow.Duration, time.Hour)
+
+	stores := web.Stores{
+		Tasks: func(ctx context.Context, ownerID int64) controllers.TaskStore {
+			return ts.ForOwner(ownerID).WithLogger(logging.FromContext(ctx))
+		},
+		Tokens: tks,
+		Users:  us,
+		Shares: c.Context.Value(ShareStoreContextKey).(store.ShareStore),
+		Sync: func(ctx context.Context, ownerID int64) controllers.SyncStore {
+			return store.SyncStore{DB: ts.DB, Events: broker}.ForOwner(ownerID).WithLogger(logging.FromContext(ctx))
+		},
+		Events:      broker,
+		Idempotency: is,
+		Database:    ts.DB,
+		TaskCounts:  ts,
+	}
+	tlsConfig, err := web.TLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	router := web.NewReloader(stores, cfg)
+	server := web.NewServer(cfg.Listen, router)
+	server.TLSConfig = tlsConfig
+	server.RegisterOnShutdown(broker.Close)
+
+	// both listeners are opened before serving, so that neither server
+	// runs when the other cannot
+	listener, err := web.Listen(cfg.Listen)
+	if err != nil {
+		return err
+	}
+
+	var grpcServer *grpc.Server
+	var grpcListener net.Listener
+	if grpcCfg.Enabled {
+		grpcTLSConfig, err := grpcTLS(cfg, grpcCfg, tlsConfig)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		if grpcListener, err = web.Listen(grpcCfg.Listen); err != nil {
+			listener.Close()
+			return err
+		}
+
+		grpcServer = newGRPCServer(c, ts, broker, grpcCfg, grpcTLSConfig)
+		defer func() { stopGRPC(grpcServer, grpcCfg.ShutdownTimeout.Duration) }()
+	}
+
+	dispatcher := webhooks.NewDispatcher(c.Context.Value(WebhookStoreContextKey).(store.WebhookStore))
+	stop := dispatch(dispatcher, broker, cfg.ShutdownTimeout.Duration)
+	defer stop()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- serve(server, listener, cfg)
+	}()
+	if grpcServer != nil {
+		go func() {
+			errs <- serveGRPC(grpcServer, grpcListener, grpcCfg)
+		}()
+	}
+
+	for {
+		select {
+		case err := <-errs:
+			// one of the servers failed, the other one is stopped too
+			shutdown(server, cfg.ShutdownTimeout.Duration)
+			return err
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				reloaded, err := loadWebConfig(c)
+				if err != nil {
+					logging.Default().Error("keeping current configuration", "error", err)
+					continue
+				}
+				reloadedGRPC, err := loadGRPCConfig(c, GRPCListenFlagKey)
+				if err != nil {
+					logging.Default().Error("keeping current configuration", "error", err)
+					continue
+				}
+
+				if settings := restartRequired(cfg, reloaded, grpcCfg, reloadedGRPC); len(settings) > 0 {
+					logging.Default().Warn("settings only applied on restart", "settings", strings.Join(settings, ","))
+				}
+
+				router.Reload(reloaded)
+				cfg.ShutdownTimeout = reloaded.ShutdownTimeout
+				grpcCfg.ShutdownTimeout = reloadedGRPC.ShutdownTimeout
+				logging.Default().Info("configuration reloaded")
+				continue
+			}
+
+			logging.Default().Info("shutting down", "signal", sig, "timeout", cfg.ShutdownTimeout.Duration)
+			return shutdown(server, cfg.ShutdownTimeout.Duration)
+		}
+	}
+}
+
+// loadWebConfig reads the 'web' section of the configuration file, letting
+// command line flags take precedence
+func loadWebConfig(c *cli.Context) (config.Web, error) {
+	cfg, err := config.Load(c.String(string(ConfigFlagKey)))
+	if err != nil {
+		return cfg.Web, err
+	}
+
+	if port := c.Args().First(); port != "" {
+		cfg.Web.Listen = "127.0.0.1:" + port
+	}
+	if c.IsSet(string(ListenFlagKey)) {
+		cfg.Web.Listen = c.String(string(ListenFlagKey))
+	}
+	if c.IsSet(string(TLSCertFlagKey)) {
+		cfg.Web.TLSCert = c.String(string(TLSCertFlagKey))
+	}
+	if c.IsSet(string(TLSKeyFlagKey)) {
+		cfg.Web.TLSKey = c.String(string(TLSKeyFlagKey))
+	}
+	if c.IsSet(string(TLSSelfSignedFlagKey)) {
+		cfg.Web.TLSSelfSigned = c.Bool(string(TLSSelfSignedFlagKey))
+	}
+	if c.IsSet(string(ShutdownTimeoutFlagKey)) {
+		cfg.Web.ShutdownTimeout.Duration = c.Duration(string(ShutdownTimeoutFlagKey))
+	}
+
+	if (cfg.Web.TLSCert == "") != (cfg.Web.TLSKey == "") {
+		return cfg.Web, fmt.Errorf("both --%s and --%s are required for TLS", TLSCertFlagKey, TLSKeyFlagKey)
+	}
+	if _, err := limit.ParseNetworks(cfg.Web.TrustedProxies); err != nil {
+		return cfg.Web, fmt.Errorf("trusted_proxies: %w", err)
+	}
+	for _, origin := range cfg.Web.CORS.AllowedOrigins {
+		if origin == "*" && cfg.Web.CORS.AllowCredentials {
+			return cfg.Web, fmt.Errorf("cors: allow_credentials cannot be set along with the '*' origin, list the allowed origins instead")
+		}
+	}
+
+	return cfg.Web, nil
+}
+
+// restartRequired lists the settings changed from 'cfg' and 'grpcCfg' in
+// 'reloaded' and 'reloadedGRPC' that the running servers cannot apply
+func restartRequired(cfg, reloaded config.Web, grpcCfg, reloadedGRPC config.GRPC) []string {
+	var settings []string
+	if reloaded.Listen != cfg.Listen {
+		settings = append(settings, "listen")
+	}
+	if reloaded.TLSCert != cfg.TLSCert || reloaded.TLSKey != cfg.TLSKey || reloaded.TLSSelfSigned != cfg.TLSSelfSigned {
+		settings = append(settings, "tls")
+	}
+	if reloaded.IdempotencyWindow != cfg.IdempotencyWindow {
+		settings = append(settings, "idempotency_window")
+	}
+	if reloadedGRPC.Enabled != grpcCfg.Enabled {
+		settings = append(settings, "grpc.enabled")
+	}
+	if reloadedGRPC.Listen != grpcCfg.Listen {
+		settings = append(settings, "grpc.listen")
+	}
+	if reloadedGRPC.RateLimit != grpcCfg.RateLimit || reloadedGRPC.RateBurst != grpcCfg.RateBurst {
+		settings = append(settings, "grpc.rate_limit")
+	}
+
+	return settings
+}
+
+// serve accepts connections on 'listener', over HTTPS when the server has
+// a TLS configuration
+func serve(server *http.Server, listener net.Listener, cfg config.Web) error {
+	switch {
+	case server.TLSConfig == nil:
+		logging.Default().Info("running web server", "address", "http://"+cfg.Listen)
+		return server.Serve(listener)
+	case cfg.TLSSelfSigned && cfg.TLSCert == "":
+		logging.Default().Info("running web server", "address", "https://"+cfg.Listen, "certificate", "self-signed")
+	default:
+		logging.Default().Info("running web server", "address", "https://"+cfg.Listen)
+	}
+
+	return server.ServeTLS(listener, "", "")
+}
+
+// dispatch delivers task events to webhooks in the background, queueing
+// them so that none is missed however slow the deliveries are. The
+// returned function waits up to 'timeout' for pending deliveries once the
+// broker is closed, then abandons them.
+func dispatch(dispatcher *webhooks.Dispatcher, broker *events.Broker, timeout time.Duration) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, _ := broker.Queue()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dispatcher.Run(ctx, ch)
+	}()
+
+	return func() {
+		select {
+		case <-done:
+		case <-time.After(timeout):
+		}
+
+		cancel()
+		<-done
+	}
+}
+
+func shutdown(server *http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		return err
+	}
 
-	log.Printf("Running web server on address http://%s", server.Addr)
-	log.Fatal(server.ListenAndServe())
+	logging.Default().Info("web server stopped")
 	return nil
 }
 
@@ -0,0 +1,163 @@
+package cli_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/imgabe/todo/pkg/cli"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/imgabe/todo/pkg/store/storetest"
+	urfave "github.com/urfave/cli/v2"
+)
+
+// serverApp returns an app running the server command 'action' on an
+// in-memory database
+func serverApp(t *testing.T, action urfave.ActionFunc) *urfave.App {
+	t.Helper()
+
+	db := storetest.Open(t)
+
+	return &urfave.App{
+		Flags: []urfave.Flag{
+			&urfave.StringFlag{Name: string(cli.ConfigFlagKey)},
+			&urfave.StringFlag{Name: string(cli.ListenFlagKey)},
+			&urfave.BoolFlag{Name: string(cli.GRPCFlagKey)},
+			&urfave.StringFlag{Name: string(cli.GRPCListenFlagKey)},
+		},
+		Before: func(c *urfave.Context) error {
+			values := map[cli.ContextKey]interface{}{
+				cli.TaskStoreContextKey:        store.TaskStore{DB: db},
+				cli.TokenStoreContextKey:       store.TokenStore{DB: db},
+				cli.UserStoreContextKey:        store.UserStore{DB: db},
+				cli.ShareStoreContextKey:       store.ShareStore{DB: db},
+				cli.WebhookStoreContextKey:     store.WebhookStore{DB: db},
+				cli.IdempotencyStoreContextKey: store.IdempotencyStore{DB: db},
+			}
+			for key, value := range values {
+				c.Context = context.WithValue(c.Context, key, value)
+			}
+
+			return nil
+		},
+		Action: action,
+	}
+}
+
+func TestWebserver_Reload(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	socket := filepath.Join(dir, "web.sock")
+
+	writeConfig := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(cfgPath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig(`{"web": {"rate_limit": 0.001, "rate_burst": 1}}`)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serverApp(t, cli.Webserver).Run([]string{"todo", "--config", cfgPath, "--listen", "unix:" + socket})
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	get := func(path string) int {
+		res, err := client.Get("http://todo" + path)
+		if err != nil {
+			return 0
+		}
+		res.Body.Close()
+
+		return res.StatusCode
+	}
+	waitFor := func(path string, want int) int {
+		t.Helper()
+
+		var got int
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if got = get(path); got == want {
+				break
+			}
+		}
+
+		return got
+	}
+
+	if got := waitFor("/healthz", http.StatusOK); got != http.StatusOK {
+		t.Fatalf("GET /healthz = %d, want the server to start", got)
+	}
+	defer func() {
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		if err := <-errs; err != nil {
+			t.Errorf("Webserver() error = %v", err)
+		}
+	}()
+
+	get("/openapi.json")
+	if got := get("/openapi.json"); got != http.StatusTooManyRequests {
+		t.Fatalf("GET /openapi.json over the limit = %d, want %d", got, http.StatusTooManyRequests)
+	}
+
+	writeConfig(`{"web": {"rate_limit": 0}}`)
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+
+	if got := waitFor("/openapi.json", http.StatusOK); got != http.StatusOK {
+		t.Errorf("GET /openapi.json once the limit is lifted = %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestWebserver_GRPCListenFails(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "web.sock")
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := serverApp(t, cli.Webserver).Run([]string{"todo", "--config", filepath.Join(dir, "config.json"),
+		"--listen", "unix:" + socket, "--grpc", "--grpc-listen", "unix:" + file})
+	if err == nil {
+		t.Fatal("Webserver() error = nil, want the gRPC listener to fail")
+	}
+
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		t.Error("web server still accepts connections")
+	}
+}
+
+func TestWebserver_CORSCredentials(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	config := `{"web": {"cors": {"allowed_origins": ["https://app.example.com", "*"], "allow_credentials": true}}}`
+	if err := os.WriteFile(cfgPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := serverApp(t, cli.Webserver).Run([]string{"todo", "--config", cfgPath, "--listen", "unix:" + filepath.Join(dir, "web.sock")})
+	if err == nil || !strings.Contains(err.Error(), "allow_credentials") {
+		t.Errorf("Webserver() with credentials from any origin error = %v, want them rejected", err)
+	}
+}
+
+func TestGRPCServer_TLS(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+
+	err := serverApp(t, cli.GRPCServer).Run([]string{"todo", "--config", cfgPath, "--listen", "0.0.0.0:0"})
+	if err == nil || !strings.Contains(err.Error(), "TLS") {
+		t.Errorf("GRPCServer() on every interface without TLS error = %v, want TLS required", err)
+	}
+}
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	// ScopesFlagKey is the flag key used to store the scopes of a new token
+	ScopesFlagKey FlagKey = "scopes"
+	// ExpiresFlagKey is the flag key used to store how long a new token lasts
+	ExpiresFlagKey FlagKey = "expires"
+)
+
+// CreateToken is responsible for the 'token create' command on the CLI
+func CreateToken(c *cli.Context) error {
+	ts := c.Context.Value(TokenStoreContextKey).(store.TokenStore)
+
+	name := c.Args().First()
+	if name == "" {
+		return invalid("name", "missing")
+	}
+
+	var scopes []string
+	for _, s := range splitList(c.StringSlice(string(ScopesFlagKey))) {
+		scope, ok := models.ParseScope(s)
+		if !ok {
+			return invalid("scope", "unknown scope '%s'", s)
+		}
+		scopes = append(scopes, string(scope))
+	}
+
+	token := models.Token{Name: name, Scopes: strings.Join(scopes, ",")}
+	if user, ok := c.Context.Value(UserContextKey).(models.User); ok {
+		token.UserID = &user.ID
+	}
+	if expires := c.Duration(string(ExpiresFlagKey)); expires > 0 {
+		expiresAt := time.Now().Add(expires).UTC()
+		token.ExpiresAt = &expiresAt
+	}
+
+	raw, token, err := ts.Create(token)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("token '%s' was created as (%d) with scopes %s\n", token.Name, token.ID, token.Scopes)
+	fmt.Printf("%s\n", raw)
+	fmt.Println("store it now, it will not be shown again")
+	return nil
+}
+
+// ListTokens is responsible for the 'token list' command on the CLI
+func ListTokens(c *cli.Context) error {
+	ts := c.Context.Value(TokenStoreContextKey).(store.TokenStore)
+
+	tokens, err := ts.SelectAll()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, token := range tokens {
+		expires := "never"
+		if token.ExpiresAt != nil {
+			expires = token.ExpiresAt.Local().Format(time.RFC3339)
+			if token.Expired(now) {
+				expires += " (expired)"
+			}
+		}
+
+		fmt.Printf("%d %s [%s] expires %s\n", token.ID, token.Name, token.Scopes, expires)
+	}
+
+	return nil
+}
+
+// RevokeToken is responsible for the 'token revoke' command on the CLI
+func RevokeToken(c *cli.Context) error {
+	ts := c.Context.Value(TokenStoreContextKey).(store.TokenStore)
+
+	tokenID, err := parseID(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	err = ts.Revoke(tokenID)
+	if err != nil {
+		return fmt.Errorf("token (%d): %w", tokenID, err)
+	}
+
+	fmt.Printf("token (%d) successfully revoked\n", tokenID)
+	return nil
+}
+
+// splitList flattens comma separated flag values such as '--scopes read,write'
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/urfave/cli/v2"
+)
+
+// AddUser is responsible for the 'user add' command on the CLI
+func AddUser(c *cli.Context) error {
+	us := c.Context.Value(UserStoreContextKey).(store.UserStore)
+
+	name := c.Args().First()
+	if name == "" {
+		return invalid("name", "missing")
+	}
+
+	fmt.Fprint(os.Stderr, "password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return invalid("password", "missing")
+	}
+
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		return invalid("password", "missing")
+	}
+
+	user, err := us.Insert(name, password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("user '%s' was added as (%d)\n", user.Name, user.ID)
+	return nil
+}
+
+// ListUsers is responsible for the 'user list' command on the CLI
+func ListUsers(c *cli.Context) error {
+	us := c.Context.Value(UserStoreContextKey).(store.UserStore)
+
+	users, err := us.SelectAll()
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		fmt.Printf("%d %s\n", user.ID, user.Name)
+	}
+
+	return nil
+}
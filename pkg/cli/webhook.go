@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	// EventsFlagKey is the flag key used to store the events of a new webhook
+	EventsFlagKey FlagKey = "events"
+	// LimitFlagKey is the flag key used to store how many entries are listed
+	LimitFlagKey FlagKey = "limit"
+)
+
+// WebhookEvents are the events a webhook can subscribe to
+var WebhookEvents = []string{
+	string(events.TaskCreated),
+	string(events.TaskUpdated),
+	string(events.TaskChecked),
+	string(events.TaskDeleted),
+}
+
+// AddWebhook is responsible for the 'webhook add' command on the CLI
+func AddWebhook(c *cli.Context) error {
+	ws := c.Context.Value(WebhookStoreContextKey).(store.WebhookStore)
+
+	target, err := url.Parse(c.Args().First())
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return invalid("url", "missing or invalid webhook URL '%s'", c.Args().First())
+	}
+
+	var subscribed []string
+	for _, event := range splitList(c.StringSlice(string(EventsFlagKey))) {
+		if !isWebhookEvent(event) {
+			return invalid("events", "unknown event '%s', expected one of %s", event, strings.Join(WebhookEvents, ", "))
+		}
+		subscribed = append(subscribed, event)
+	}
+
+	webhook, err := ws.Insert(models.Webhook{URL: target.String(), Events: strings.Join(subscribed, ",")})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("webhook '%s' was added as (%d) for %s\n", webhook.URL, webhook.ID, webhook.Events)
+	fmt.Printf("signing secret: %s\n", webhook.Secret)
+	return nil
+}
+
+func isWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ListWebhooks is responsible for the 'webhook list' command on the CLI
+func ListWebhooks(c *cli.Context) error {
+	ws := c.Context.Value(WebhookStoreContextKey).(store.WebhookStore)
+
+	webhooks, err := ws.SelectAll()
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		fmt.Printf("%d %s [%s]\n", webhook.ID, webhook.URL, webhook.Events)
+	}
+
+	return nil
+}
+
+// RemoveWebhook is responsible for the 'webhook remove' command on the CLI
+func RemoveWebhook(c *cli.Context) error {
+	ws := c.Context.Value(WebhookStoreContextKey).(store.WebhookStore)
+
+	webhookID, err := parseID(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	err = ws.Delete(webhookID)
+	if err != nil {
+		return fmt.Errorf("webhook (%d): %w", webhookID, err)
+	}
+
+	fmt.Printf("webhook (%d) successfully removed\n", webhookID)
+	return nil
+}
+
+// ListDeliveries is responsible for the 'webhook deliveries' command on the CLI
+func ListDeliveries(c *cli.Context) error {
+	ws := c.Context.Value(WebhookStoreContextKey).(store.WebhookStore)
+
+	deliveries, err := ws.SelectDeliveries(c.Int(string(LimitFlagKey)))
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deliveries {
+		result := "ok"
+		if !d.Succeeded() {
+			result = "failed: " + d.Error
+		}
+
+		fmt.Printf("%s webhook (%d) %s %s attempt %d %s\n",
+			d.CreatedAt.Local().Format(time.RFC3339), d.WebhookID, d.Event, d.Delivery[:8], d.Attempt, result)
+	}
+
+	return nil
+}
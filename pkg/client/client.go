@@ -0,0 +1,242 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/store/storeerr"
+)
+
+// Client sends requests to the server at BaseURL on behalf of the user of
+// Token
+type Client struct {
+	// BaseURL is the address of the server, such as 'https://todo.example.com'
+	BaseURL string
+	// Token is an API token created with 'todo token create'
+	Token string
+	// HTTPClient sends the requests, 'http.DefaultClient' when nil
+	HTTPClient *http.Client
+	// MaxRetries is how many times a failed request is sent again, never
+	// when zero
+	MaxRetries int
+	// RetryWait is the delay before the first retry, doubled for every
+	// following one up to MaxRetryWait
+	RetryWait    time.Duration
+	MaxRetryWait time.Duration
+	// SyncBatchSize is how many local changes Sync sends per request,
+	// DefaultSyncBatchSize when zero
+	SyncBatchSize int
+}
+
+// New returns a client of the server at 'baseURL' authenticating with
+// 'token', retrying failed requests up to 3 times
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimSuffix(baseURL, "/"),
+		Token:        token,
+		MaxRetries:   3,
+		RetryWait:    250 * time.Millisecond,
+		MaxRetryWait: 5 * time.Second,
+	}
+}
+
+// request describes a call to the API
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	// body is sent encoded as JSON, and the response decoded into 'out'
+	body interface{}
+	out  interface{}
+}
+
+// do sends a request, retrying it while the server is overloaded or
+// unreachable, and returns the headers of the response. Failed requests
+// return the problem document of the server as an '*errors.ErrResponse'.
+func (c *Client) do(ctx context.Context, req request) (http.Header, error) {
+	var data []byte
+	if req.body != nil {
+		var err error
+		if data, err = json.Marshal(req.body); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := c.send(ctx, req, data)
+
+		wait, retry := c.retry(ctx, req, res, err, attempt)
+		if !retry {
+			if err != nil {
+				return nil, err
+			}
+
+			defer res.Body.Close()
+			return res.Header, decode(res, req.out)
+		}
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// send makes a single attempt at a request
+func (c *Client) send(ctx context.Context, req request, body []byte) (*http.Response, error) {
+	u := c.BaseURL + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, req.method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range req.header {
+		r.Header[name] = values
+	}
+	r.Header.Set("Accept", "application/json")
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return httpClient.Do(r)
+}
+
+// retry tells whether a request should be sent again after an attempt,
+// and how long to wait before. Requests the server turned away are always
+// retried, while the ones which may have been handled are only retried
+// when sending them twice has the same effect as once.
+func (c *Client) retry(ctx context.Context, req request, res *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= c.MaxRetries || ctx.Err() != nil {
+		return 0, false
+	}
+
+	wait := c.backoff(attempt)
+
+	switch {
+	case err != nil:
+		return wait, idempotent(req)
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable:
+		if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && time.Duration(seconds)*time.Second > wait {
+			wait = time.Duration(seconds) * time.Second
+		}
+		return wait, true
+	case res.StatusCode == http.StatusBadGateway || res.StatusCode == http.StatusGatewayTimeout:
+		return wait, idempotent(req)
+	}
+
+	return 0, false
+}
+
+// backoff returns the delay before a retry, randomized so clients failing
+// together do not retry together
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.RetryWait << attempt
+	if wait > c.MaxRetryWait || wait <= 0 {
+		wait = c.MaxRetryWait
+	}
+	if wait <= 0 {
+		return 0
+	}
+
+	return wait/2 + time.Duration(mathrand.Int63n(int64(wait/2)+1))
+}
+
+// idempotent reports whether sending a request twice has the same effect as
+// sending it once, as for POST requests with an 'Idempotency-Key'
+func idempotent(req request) bool {
+	switch req.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		return req.header.Get("Idempotency-Key") != ""
+	}
+
+	return false
+}
+
+// idempotencyKey returns a random 'Idempotency-Key' letting the server
+// recognize retries of a request
+func idempotencyKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// decode reads the body of a response into 'out', or the problem document
+// of a failed request
+func decode(res *http.Response, out interface{}) error {
+	if res.StatusCode >= 400 {
+		return decodeError(res)
+	}
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+
+	return nil
+}
+
+// decodeError reads the problem document of a failed request, describing
+// the failure from the status alone when the body is not one. Statuses
+// matching the errors of the stores wrap them, so they can be told apart
+// with 'errors.Is' like with a local database.
+func decodeError(res *http.Response) error {
+	problem := &errors.ErrResponse{}
+
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err := json.Unmarshal(data, problem); err != nil || problem.StatusText == "" {
+		problem = &errors.ErrResponse{StatusText: http.StatusText(res.StatusCode)}
+	}
+	problem.HTTPStatusCode = res.StatusCode
+
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		problem.Err = storeerr.ErrNotFound
+	case http.StatusConflict:
+		problem.Err = storeerr.ErrConflict
+	case http.StatusPreconditionFailed:
+		problem.Err = storeerr.ErrStale
+	}
+
+	return problem
+}
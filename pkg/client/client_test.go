@@ -0,0 +1,336 @@
+package client_test
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/imgabe/todo/pkg/api/web/auth"
+	"github.com/imgabe/todo/pkg/api/web/controllers"
+	"github.com/imgabe/todo/pkg/client"
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/imgabe/todo/pkg/store/storetest"
+)
+
+// testServer serves the '/tasks' and '/sync' APIs from a
+// storetest.Fixture, and returns the token of alice with every scope
+func testServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+
+	f := storetest.New(t)
+	db := f.DB
+	ts := store.TaskStore{DB: db}
+	us := store.UserStore{DB: db}
+	tks := store.TokenStore{DB: db}
+
+	stores := func(ctx context.Context, ownerID int64) controllers.TaskStore { return ts.ForOwner(ownerID) }
+	r := chi.NewRouter()
+	r.Use(auth.Authenticate(tks))
+	r.Mount("/tasks", controllers.NewTasksController(stores, us))
+	r.Mount("/sync", controllers.NewSyncController(func(ctx context.Context, ownerID int64) controllers.SyncStore {
+		return store.SyncStore{DB: db}.ForOwner(ownerID)
+	}))
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	return srv, f.Admin
+}
+
+// status returns the status of the problem document 'err' holds, zero for
+// other errors
+func status(err error) int {
+	var problem *errors.ErrResponse
+	if stderrors.As(err, &problem) {
+		return problem.HTTPStatusCode
+	}
+
+	return 0
+}
+
+func TestClient(t *testing.T) {
+	srv, token := testServer(t)
+	c := client.New(srv.URL+"/", token)
+	ctx := context.Background()
+	done, bob := true, int64(2)
+
+	tests := []struct {
+		name string
+		call func() (models.Task, error)
+		want int
+		task models.Task
+	}{
+		{
+			name: "Create",
+			call: func() (models.Task, error) { return c.CreateTask(ctx, models.Task{Description: "Buy milk"}) },
+			task: models.Task{ID: 1, Description: "Buy milk", Version: 1},
+		},
+		{
+			name: "Create without description",
+			call: func() (models.Task, error) { return c.CreateTask(ctx, models.Task{}) },
+			want: 400,
+		},
+		{
+			name: "Get",
+			call: func() (models.Task, error) { return c.GetTask(ctx, 1) },
+			task: models.Task{ID: 1, Description: "Buy milk", Version: 1},
+		},
+		{
+			name: "Get non-existent",
+			call: func() (models.Task, error) { return c.GetTask(ctx, 99) },
+			want: 404,
+		},
+		{
+			name: "Update",
+			call: func() (models.Task, error) {
+				return c.UpdateTask(ctx, models.Task{ID: 1, Description: "Buy oat milk", Version: 1})
+			},
+			task: models.Task{ID: 1, Description: "Buy oat milk", Version: 2},
+		},
+		{
+			name: "Update stale version",
+			call: func() (models.Task, error) {
+				return c.UpdateTask(ctx, models.Task{ID: 1, Description: "Buy milk", Version: 1})
+			},
+			want: 412,
+		},
+		{
+			name: "Assign",
+			call: func() (models.Task, error) { return c.AssignTask(ctx, 1, "bob") },
+			task: models.Task{ID: 1, Description: "Buy oat milk", AssigneeID: &bob, Version: 3},
+		},
+		{
+			name: "Assign to unknown user",
+			call: func() (models.Task, error) { return c.AssignTask(ctx, 1, "nobody") },
+			want: 404,
+		},
+		{
+			name: "Unassign",
+			call: func() (models.Task, error) { return c.AssignTask(ctx, 1, "") },
+			task: models.Task{ID: 1, Description: "Buy oat milk", Version: 4},
+		},
+		{
+			name: "Patch any version",
+			call: func() (models.Task, error) {
+				return c.PatchTask(ctx, 1, 0, models.TaskPatch{Done: &done})
+			},
+			task: models.Task{ID: 1, Description: "Buy oat milk", Done: true, Version: 5},
+		},
+		{
+			name: "Delete stale version",
+			call: func() (models.Task, error) { return c.DeleteTask(ctx, 1, 2) },
+			want: 412,
+		},
+		{
+			name: "Delete",
+			call: func() (models.Task, error) { return c.DeleteTask(ctx, 1, 5) },
+			task: models.Task{ID: 1, Description: "Buy oat milk", Done: true, Version: 5},
+		},
+		{
+			name: "Delete again",
+			call: func() (models.Task, error) { return c.DeleteTask(ctx, 1, 0) },
+			want: 404,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task, err := tt.call()
+			if got := status(err); got != tt.want {
+				t.Fatalf("status = %d, want %d: %v", got, tt.want, err)
+			}
+			if tt.want != 0 {
+				return
+			}
+
+			task.OwnerID = nil
+			if !reflect.DeepEqual(task, tt.task) {
+				t.Errorf("task = %+v, want %+v", task, tt.task)
+			}
+		})
+	}
+}
+
+func TestClient_ListTasks(t *testing.T) {
+	srv, token := testServer(t)
+	c := client.New(srv.URL, token)
+	ctx := context.Background()
+
+	tasks, err := c.ListTasks(ctx, client.ListOptions{})
+	if err != nil || len(tasks) != 0 {
+		t.Fatalf("ListTasks() = %v, %v, want no tasks", tasks, err)
+	}
+
+	for i := 1; i <= 5; i++ {
+		if _, err := c.CreateTask(ctx, models.Task{Description: fmt.Sprintf("Task %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts client.ListOptions
+		want []int64
+	}{
+		{name: "All", opts: client.ListOptions{}, want: []int64{1, 2, 3, 4, 5}},
+		{name: "First page", opts: client.ListOptions{Limit: 2}, want: []int64{1, 2}},
+		{name: "Next page", opts: client.ListOptions{Limit: 2, After: 2}, want: []int64{3, 4}},
+		{name: "Assigned", opts: client.ListOptions{AssignedToMe: true}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks, err := c.ListTasks(ctx, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(tasks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListTasks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := c.ListTasks(ctx, client.ListOptions{Owner: "nobody"}); !stderrors.Is(err, store.ErrNotFound) {
+		t.Errorf("ListTasks() of unknown owner = %v, want %v", err, store.ErrNotFound)
+	}
+}
+
+func TestClient_Tasks(t *testing.T) {
+	srv, token := testServer(t)
+	c := client.New(srv.URL, token)
+	ctx := context.Background()
+
+	for i := 1; i <= 5; i++ {
+		if _, err := c.CreateTask(ctx, models.Task{Description: fmt.Sprintf("Task %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, limit := range []int{0, 1, 2, 5, 10} {
+		var tasks []models.Task
+		it := c.Tasks(ctx, client.ListOptions{Limit: limit})
+		for it.Next() {
+			tasks = append(tasks, it.Task())
+		}
+
+		if err := it.Err(); err != nil {
+			t.Fatalf("limit %d: %v", limit, err)
+		}
+		if got, want := ids(tasks), []int64{1, 2, 3, 4, 5}; !reflect.DeepEqual(got, want) {
+			t.Errorf("limit %d: tasks = %v, want %v", limit, got, want)
+		}
+	}
+
+	it := client.New(srv.URL, "nope").Tasks(ctx, client.ListOptions{})
+	if it.Next() || status(it.Err()) != 401 {
+		t.Errorf("iterating with invalid token = %v, want 401", it.Err())
+	}
+}
+
+func ids(tasks []models.Task) []int64 {
+	var ids []int64
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+
+	return ids
+}
+
+func TestClient_InvalidToken(t *testing.T) {
+	srv, _ := testServer(t)
+	c := client.New(srv.URL, "nope")
+
+	_, err := c.ListTasks(context.Background(), client.ListOptions{})
+	if status(err) != 401 || err.Error() != errors.ErrUnauthorized.Error() {
+		t.Errorf("err = %v, want %v", err, errors.ErrUnauthorized)
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures []int
+		call     func(c *client.Client) error
+		want     int
+		calls    int32
+	}{
+		{
+			name:     "Overloaded",
+			failures: []int{503, 429},
+			call:     func(c *client.Client) error { _, err := c.GetTask(context.Background(), 1); return err },
+			calls:    3,
+		},
+		{
+			name:     "Too many failures",
+			failures: []int{503, 503, 503, 503},
+			call:     func(c *client.Client) error { _, err := c.GetTask(context.Background(), 1); return err },
+			want:     503,
+			calls:    3,
+		},
+		{
+			name:     "Create with idempotency key",
+			failures: []int{502},
+			call: func(c *client.Client) error {
+				_, err := c.CreateTask(context.Background(), models.Task{Description: "Task"})
+				return err
+			},
+			calls: 2,
+		},
+		{
+			name:     "Patch not retried",
+			failures: []int{502},
+			call: func(c *client.Client) error {
+				_, err := c.PatchTask(context.Background(), 1, 1, models.TaskPatch{})
+				return err
+			},
+			want:  502,
+			calls: 1,
+		},
+		{
+			name:     "Client error not retried",
+			failures: []int{400},
+			call:     func(c *client.Client) error { _, err := c.GetTask(context.Background(), 1); return err },
+			want:     400,
+			calls:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			keys := make(map[string]bool)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&calls, 1)
+				keys[r.Header.Get("Idempotency-Key")] = true
+				if int(n) <= len(tt.failures) {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(tt.failures[n-1])
+					return
+				}
+
+				w.Write([]byte(`{"id":1,"description":"Task","version":1}`))
+			}))
+			defer srv.Close()
+
+			c := client.New(srv.URL, "token")
+			c.MaxRetries = 2
+			c.RetryWait = time.Millisecond
+
+			err := tt.call(c)
+			if got := status(err); got != tt.want {
+				t.Errorf("status = %d, want %d: %v", got, tt.want, err)
+			}
+			if calls != tt.calls {
+				t.Errorf("calls = %d, want %d", calls, tt.calls)
+			}
+			if len(keys) != 1 {
+				t.Errorf("requests were sent with %d idempotency keys, want 1", len(keys))
+			}
+		})
+	}
+}
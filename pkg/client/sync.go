@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// SyncStore is the local database synced with the server, satisfied by
+// 'store.SyncStore'
+type SyncStore interface {
+	Changes(since int64, limit int) ([]models.TaskChange, int64, error)
+	Merge(changes []models.TaskChange, since int64, strategy models.MergeStrategy) (models.MergeResult, error)
+	State(remote string) (models.SyncState, error)
+	SaveState(state models.SyncState) error
+}
+
+// DefaultSyncBatchSize is how many local changes are sent per request when
+// Client.SyncBatchSize is not set, keeping requests well under the body size
+// limit of the server
+const DefaultSyncBatchSize = 100
+
+// SyncResult sums up a sync
+type SyncResult struct {
+	// Pushed is how many local changes were sent to the server
+	Pushed int
+	// Pulled is how many local tasks were created, changed or deleted
+	Pulled int
+	// Conflicts lists the fields changed on both sides, 'Ours' being the
+	// value on the server
+	Conflicts []models.SyncConflict
+}
+
+// SyncChanges sends changes to the server and returns the ones made there
+// since 'req.Since'
+func (c *Client) SyncChanges(ctx context.Context, req models.SyncRequest) (models.SyncResponse, error) {
+	if req.Changes == nil {
+		req.Changes = []models.TaskChange{}
+	}
+
+	var res models.SyncResponse
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/sync", body: req, out: &res})
+
+	return res, err
+}
+
+// Sync sends the changes made to the local database since the previous
+// sync to the server, then merges the ones made on the server. Changes are
+// sent in batches of SyncBatchSize, and where the sync stands is kept in the
+// local database after each of them, so that every change is only
+// exchanged once and an interrupted sync carries on from the last batch.
+func (c *Client) Sync(ctx context.Context, local SyncStore, strategy models.MergeStrategy) (SyncResult, error) {
+	batchSize := c.SyncBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultSyncBatchSize
+	}
+
+	state, err := local.State(c.BaseURL)
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	var result SyncResult
+	for {
+		changes, seq, err := local.Changes(state.Pushed, batchSize)
+		if err != nil {
+			return result, err
+		}
+
+		res, err := c.SyncChanges(ctx, models.SyncRequest{Since: state.Cursor, Strategy: strategy, Changes: changes})
+		if err != nil {
+			return result, err
+		}
+
+		merged, err := local.Merge(res.Changes, seq, strategy)
+		if err != nil {
+			return result, err
+		}
+
+		// the changes made by the merge are already on the server, unless
+		// others were made locally in the meantime or are left to send
+		state.Cursor, state.Pushed = res.Cursor, seq
+		if merged.Before == seq {
+			state.Pushed = merged.After
+		}
+		if err := local.SaveState(state); err != nil {
+			return result, err
+		}
+
+		result.Pushed += len(changes)
+		result.Pulled += merged.Applied
+		result.Conflicts = append(result.Conflicts, res.Conflicts...)
+
+		if len(changes) < batchSize {
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package client_test
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/imgabe/todo/pkg/client"
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/imgabe/todo/pkg/store/storetest"
+)
+
+// laptop opens an in-memory database of local tasks
+func laptop(t *testing.T) (store.TaskStore, store.SyncStore) {
+	t.Helper()
+
+	db := storetest.Open(t)
+
+	return store.TaskStore{DB: db}, store.SyncStore{DB: db}
+}
+
+// descriptions returns the description of every task of a store, checked
+// ones prefixed with 'x '
+func descriptions(t *testing.T, ts store.TaskStore) []string {
+	t.Helper()
+
+	tasks, err := ts.SelectAll(true, models.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, task := range tasks {
+		if task.Done {
+			got = append(got, "x "+task.Description)
+		} else {
+			got = append(got, task.Description)
+		}
+	}
+	sort.Strings(got)
+
+	return got
+}
+
+func TestClient_Sync(t *testing.T) {
+	srv, token := testServer(t)
+	c := client.New(srv.URL, token)
+	ctx := context.Background()
+
+	home, homeSync := laptop(t)
+	work, workSync := laptop(t)
+
+	sync := func(name string, ss store.SyncStore, strategy models.MergeStrategy, want client.SyncResult) {
+		t.Helper()
+
+		got, err := c.Sync(ctx, ss, strategy)
+		if err != nil {
+			t.Fatalf("%s: Sync() error = %v", name, err)
+		}
+		if got.Conflicts == nil {
+			got.Conflicts = []models.SyncConflict{}
+		}
+		if want.Conflicts == nil {
+			want.Conflicts = []models.SyncConflict{}
+		}
+		for i := range got.Conflicts {
+			got.Conflicts[i].UUID = ""
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Sync() = %+v, want %+v", name, got, want)
+		}
+	}
+
+	milk, _ := home.Insert(models.Task{Description: "Buy milk"})
+	home.Insert(models.Task{Description: "Call mom"})
+	sync("home pushes", homeSync, models.MergeLastWriter, client.SyncResult{Pushed: 2})
+	sync("work pulls", workSync, models.MergeLastWriter, client.SyncResult{Pulled: 2})
+	sync("home has nothing new", homeSync, models.MergeLastWriter, client.SyncResult{})
+
+	tasks, err := c.ListTasks(ctx, client.ListOptions{})
+	if err != nil || len(tasks) != 2 {
+		t.Fatalf("server tasks = %+v, %v, want the synced ones", tasks, err)
+	}
+
+	// both laptops change the same task while offline
+	workTasks, _ := work.SelectAll(true, models.Page{})
+	workMilk := workTasks[0]
+	time.Sleep(2 * time.Millisecond)
+	work.Update(models.Task{ID: workMilk.ID, Description: "Buy oat milk"})
+	time.Sleep(2 * time.Millisecond)
+	home.Update(models.Task{ID: milk.ID, Description: "Buy soy milk"})
+	home.Check(milk.ID)
+
+	sync("work pushes its edit", workSync, models.MergeFields, client.SyncResult{Pushed: 1})
+	sync("home pushes the later edit", homeSync, models.MergeFields, client.SyncResult{
+		Pushed: 1,
+		Conflicts: []models.SyncConflict{
+			{Description: "Buy oat milk", Field: "description", Ours: "Buy oat milk", Theirs: "Buy soy milk", Kept: "theirs"},
+		},
+	})
+	sync("work pulls the merged task", workSync, models.MergeFields, client.SyncResult{Pulled: 1})
+
+	want := []string{"Call mom", "x Buy soy milk"}
+	if got := descriptions(t, home); !reflect.DeepEqual(got, want) {
+		t.Errorf("home tasks = %v, want %v", got, want)
+	}
+	if got := descriptions(t, work); !reflect.DeepEqual(got, want) {
+		t.Errorf("work tasks = %v, want %v", got, want)
+	}
+
+	// a task deleted at home is deleted at work
+	home.Delete(milk.ID)
+	sync("home pushes the deletion", homeSync, models.MergeLastWriter, client.SyncResult{Pushed: 1})
+	sync("work pulls the deletion", workSync, models.MergeLastWriter, client.SyncResult{Pulled: 1})
+	if got, want := descriptions(t, work), []string{"Call mom"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("work tasks = %v, want %v", got, want)
+	}
+
+	if _, err := client.New(srv.URL, "nope").Sync(ctx, homeSync, models.MergeLastWriter); status(err) != 401 {
+		t.Errorf("Sync() with invalid token = %v, want 401", err)
+	}
+}
+
+// failingTransport fails the requests numbered in 'fail', counting from 1
+type failingTransport struct {
+	sent int
+	fail map[int]bool
+}
+
+func (f *failingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.sent++
+	if f.fail[f.sent] {
+		return nil, stderrors.New("connection reset")
+	}
+
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestClient_Sync_Batches(t *testing.T) {
+	srv, token := testServer(t)
+	ctx := context.Background()
+
+	transport := &failingTransport{fail: map[int]bool{2: true}}
+	c := client.New(srv.URL, token)
+	c.HTTPClient = &http.Client{Transport: transport}
+	c.MaxRetries = 0
+	c.SyncBatchSize = 2
+
+	home, homeSync := laptop(t)
+	for i := 1; i <= 5; i++ {
+		home.Insert(models.Task{Description: fmt.Sprintf("Task %d", i)})
+	}
+
+	if _, err := c.Sync(ctx, homeSync, models.MergeLastWriter); err == nil {
+		t.Fatal("Sync() error = nil, want the second batch to fail")
+	}
+
+	// the first batch is not sent again
+	got, err := c.Sync(ctx, homeSync, models.MergeLastWriter)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got.Pushed != 3 || transport.sent != 4 {
+		t.Errorf("Sync() pushed %d changes in %d requests, want 3 changes in 4 requests", got.Pushed, transport.sent)
+	}
+
+	work, workSync := laptop(t)
+	if _, err := client.New(srv.URL, token).Sync(ctx, workSync, models.MergeLastWriter); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	want := []string{"Task 1", "Task 2", "Task 3", "Task 4", "Task 5"}
+	if got := descriptions(t, work); !reflect.DeepEqual(got, want) {
+		t.Errorf("work tasks = %v, want %v", got, want)
+	}
+}
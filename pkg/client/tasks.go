@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// DefaultPageSize is how many tasks are read at once by iterators when
+// 'ListOptions.Limit' is not set
+const DefaultPageSize = 50
+
+// ListOptions selects the tasks read by ListTasks and Tasks
+type ListOptions struct {
+	// AssignedToMe lists the tasks assigned to the user instead of theirs
+	AssignedToMe bool
+	// Owner lists the tasks of the user with this name, who shared them,
+	// instead of the user's
+	Owner string
+	// Limit is the most tasks read at once, every task when zero
+	Limit int
+	// After skips the tasks with an ID up to this one
+	After int64
+}
+
+func (o ListOptions) query() url.Values {
+	query := url.Values{}
+	if o.AssignedToMe {
+		query.Set("assignee", "me")
+	}
+	if o.Owner != "" {
+		query.Set("owner", o.Owner)
+	}
+	if o.Limit > 0 {
+		query.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.After > 0 {
+		query.Set("after", strconv.FormatInt(o.After, 10))
+	}
+
+	return query
+}
+
+// ListTasks reads the tasks selected by 'opts' ordered by ID, only the
+// first page of them when 'opts.Limit' is set
+func (c *Client) ListTasks(ctx context.Context, opts ListOptions) ([]models.Task, error) {
+	tasks, _, err := c.listPage(ctx, opts)
+
+	return tasks, err
+}
+
+// listPage reads a page of tasks, and whether more follow
+func (c *Client) listPage(ctx context.Context, opts ListOptions) ([]models.Task, bool, error) {
+	var tasks []models.Task
+	header, err := c.do(ctx, request{method: http.MethodGet, path: "/tasks", query: opts.query(), out: &tasks})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return tasks, header.Get("Link") != "", nil
+}
+
+// Tasks returns an iterator over the tasks selected by 'opts', read page
+// by page as the iteration goes
+func (c *Client) Tasks(ctx context.Context, opts ListOptions) *TaskIterator {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultPageSize
+	}
+
+	return &TaskIterator{client: c, ctx: ctx, opts: opts, more: true}
+}
+
+// TaskIterator reads a list of tasks page by page:
+//
+//	it := c.Tasks(ctx, client.ListOptions{})
+//	for it.Next() {
+//		task := it.Task()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type TaskIterator struct {
+	client *Client
+	ctx    context.Context
+	opts   ListOptions
+
+	page []models.Task
+	task models.Task
+	more bool
+	err  error
+}
+
+// Next advances to the following task, reading the next page when the
+// current one is exhausted. It returns false once every task was read or
+// a request failed.
+func (it *TaskIterator) Next() bool {
+	for len(it.page) == 0 {
+		if !it.more || it.err != nil {
+			return false
+		}
+
+		it.page, it.more, it.err = it.client.listPage(it.ctx, it.opts)
+		if len(it.page) > 0 {
+			it.opts.After = it.page[len(it.page)-1].ID
+		}
+	}
+
+	it.task, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Task returns the current task
+func (it *TaskIterator) Task() models.Task {
+	return it.task
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *TaskIterator) Err() error {
+	return it.err
+}
+
+// GetTask reads a single task
+func (c *Client) GetTask(ctx context.Context, id int64) (models.Task, error) {
+	var task models.Task
+	_, err := c.do(ctx, request{method: http.MethodGet, path: taskPath(id), out: &task})
+
+	return task, err
+}
+
+// CreateTask adds a task. Retries are sent with the same
+// 'Idempotency-Key', so the task is only added once.
+func (c *Client) CreateTask(ctx context.Context, task models.Task) (models.Task, error) {
+	header := http.Header{}
+	header.Set("Idempotency-Key", idempotencyKey())
+
+	var created models.Task
+	_, err := c.do(ctx, request{method: http.MethodPost, path: "/tasks", header: header, body: task, out: &created})
+
+	return created, err
+}
+
+// UpdateTask replaces the description and the state of a task. Like
+// 'store.TaskStore.Update', the task is only updated if it still has
+// 'task.Version', whatever its version when zero.
+func (c *Client) UpdateTask(ctx context.Context, task models.Task) (models.Task, error) {
+	body := models.Task{Description: task.Description, Done: task.Done}
+
+	var updated models.Task
+	_, err := c.do(ctx, request{method: http.MethodPut, path: taskPath(task.ID), header: ifMatch(task.Version), body: body, out: &updated})
+
+	return updated, err
+}
+
+// PatchTask changes the fields set on 'patch' of a task still at 'version',
+// whatever its version when zero
+func (c *Client) PatchTask(ctx context.Context, id, version int64, patch models.TaskPatch) (models.Task, error) {
+	var updated models.Task
+	_, err := c.do(ctx, request{method: http.MethodPatch, path: taskPath(id), header: ifMatch(version), body: patch, out: &updated})
+
+	return updated, err
+}
+
+// DeleteTask deletes a task still at 'version', whatever its version when
+// zero, and returns it
+func (c *Client) DeleteTask(ctx context.Context, id, version int64) (models.Task, error) {
+	var deleted models.Task
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: taskPath(id), header: ifMatch(version), out: &deleted})
+
+	return deleted, err
+}
+
+// AssignTask assigns a task to the user named 'assignee', or unassigns it
+// when empty
+func (c *Client) AssignTask(ctx context.Context, id int64, assignee string) (models.Task, error) {
+	var assigned models.Task
+	_, err := c.do(ctx, request{method: http.MethodPut, path: taskPath(id) + "/assignee", body: models.Assignment{Assignee: assignee}, out: &assigned})
+
+	return assigned, err
+}
+
+func taskPath(id int64) string {
+	return fmt.Sprintf("/tasks/%d", id)
+}
+
+// ifMatch returns the If-Match header of writes to a task at 'version',
+// matching any version when zero
+func ifMatch(version int64) http.Header {
+	header := http.Header{}
+	if version == 0 {
+		header.Set("If-Match", "*")
+	} else {
+		header.Set("If-Match", fmt.Sprintf(`"%d"`, version))
+	}
+
+	return header
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Config holds the settings read from the configuration file
+type Config struct {
+	Web    Web    `json:"web"`
+	GRPC   GRPC   `json:"grpc"`
+	Remote Remote `json:"remote"`
+}
+
+// Web holds the settings of the 'web' command
+type Web struct {
+	// Listen is either 'host:port' or 'unix:/path/to.sock'
+	Listen string `json:"listen"`
+	// TLSCert and TLSKey are the certificate and key files used to serve HTTPS
+	TLSCert string `json:"tls_cert"`
+	TLSKey  string `json:"tls_key"`
+	// TLSSelfSigned serves HTTPS with a generated self-signed certificate
+	TLSSelfSigned bool `json:"tls_self_signed"`
+	// AllowRegistration lets anyone create an account through 'POST /users'
+	AllowRegistration bool `json:"allow_registration"`
+	// ShutdownTimeout is how long in-flight requests are given to finish
+	// once the server is asked to stop
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	// IdempotencyWindow is how long the response to a request sent with an
+	// 'Idempotency-Key' header is replayed for retries
+	IdempotencyWindow Duration `json:"idempotency_window"`
+	// RateLimit is how many requests per second each token, or each address
+	// before authentication, may send on average; zero disables rate limiting
+	RateLimit float64 `json:"rate_limit"`
+	// RateBurst is how many requests may be sent at once before being limited
+	RateBurst int `json:"rate_burst"`
+	// TrustedProxies are the addresses or CIDR ranges of the reverse proxies
+	// whose 'X-Forwarded-For' and 'X-Real-IP' headers identify clients;
+	// other clients are identified by the address of their connection
+	TrustedProxies []string `json:"trusted_proxies"`
+	// MaxBodySize is the largest request body accepted, in bytes; zero
+	// accepts bodies of any size
+	MaxBodySize int64 `json:"max_body_size"`
+	// CORS lists what browser front-ends served from other origins may do
+	CORS CORS `json:"cors"`
+}
+
+// CORS holds the cross-origin resource sharing settings of the 'web'
+// command. No origin is allowed unless listed.
+type CORS struct {
+	// AllowedOrigins are origins such as 'https://todo.example.com', '*'
+	// allowing any of them
+	AllowedOrigins []string `json:"allowed_origins"`
+	AllowedMethods []string `json:"allowed_methods"`
+	AllowedHeaders []string `json:"allowed_headers"`
+	// ExposedHeaders are the response headers scripts may read
+	ExposedHeaders []string `json:"exposed_headers"`
+	// AllowCredentials lets browsers send cookies and authorization headers.
+	// It cannot be set along with the '*' origin.
+	AllowCredentials bool `json:"allow_credentials"`
+	// MaxAge is how long browsers may cache the answer to a preflight request
+	MaxAge Duration `json:"max_age"`
+}
+
+// GRPC holds the settings of the 'grpc' command, also used by the 'web'
+// command when it serves gRPC alongside HTTP
+type GRPC struct {
+	// Enabled starts the gRPC server along with the web server
+	Enabled bool `json:"enabled"`
+	// Listen is either 'host:port' or 'unix:/path/to.sock'
+	Listen string `json:"listen"`
+	// ShutdownTimeout is how long in-flight calls are given to finish once
+	// the server is asked to stop
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	// RateLimit is how many calls per second each token may make on average,
+	// failed authentications being limited by address; zero disables rate
+	// limiting
+	RateLimit float64 `json:"rate_limit"`
+	// RateBurst is how many calls may be made at once before being limited
+	RateBurst int `json:"rate_burst"`
+}
+
+// Remote holds the server the task commands talk to instead of the local
+// database
+type Remote struct {
+	// URL is the address of a 'todo web' server, such as
+	// 'https://todo.example.com'; the local database is used when empty
+	URL string `json:"url"`
+	// Token is an API token created on the server with 'todo token create'
+	Token string `json:"token"`
+	// Offline keeps the task commands on the local database, which 'todo
+	// sync' then syncs with the server
+	Offline bool `json:"offline"`
+}
+
+// Duration is a 'time.Duration' read from strings such as "10s"
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses a duration string using 'time.ParseDuration'
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	d.Duration = duration
+	return nil
+}
+
+// MarshalJSON writes the duration in the format accepted by UnmarshalJSON
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Default returns the configuration used when no file is present
+func Default() Config {
+	return Config{
+		Web: Web{
+			Listen:            "127.0.0.1:8080",
+			ShutdownTimeout:   Duration{10 * time.Second},
+			IdempotencyWindow: Duration{24 * time.Hour},
+			RateLimit:         10,
+			RateBurst:         20,
+			MaxBodySize:       1 << 20,
+			CORS: CORS{
+				AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+				AllowedHeaders: []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "Idempotency-Key"},
+				ExposedHeaders: []string{
+					"ETag", "Idempotent-Replayed", "Retry-After",
+					"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+				},
+				MaxAge: Duration{10 * time.Minute},
+			},
+		},
+		GRPC: GRPC{
+			Listen:          "127.0.0.1:9090",
+			ShutdownTimeout: Duration{10 * time.Second},
+			RateLimit:       10,
+			RateBurst:       20,
+		},
+	}
+}
+
+// DefaultPath returns the default configuration file path following the
+// XDG base directory specification, i.e. '$XDG_CONFIG_HOME/todo/config.json'
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "config.json"
+	}
+
+	return filepath.Join(dir, "todo", "config.json")
+}
+
+// Load reads the configuration file at 'path' on top of the defaults. A
+// missing file is not an error.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
@@ -1,18 +1,40 @@
 package errors
 
 import (
+	"encoding/json"
+	stderrors "errors"
 	"net/http"
 
 	"github.com/go-chi/render"
+	"github.com/imgabe/todo/pkg/logging"
+	"github.com/imgabe/todo/pkg/store/storeerr"
 )
 
+// ContentType is the media type of the problem documents sent for errors
+const ContentType = "application/problem+json"
+
+// ErrResponse is an RFC 7807 problem document describing why a request failed
 type ErrResponse struct {
-	Err            error `json:"-"`
-	HTTPStatusCode int   `json:"-"`
+	Err error `json:"-"`
+
+	Type           string `json:"type"`
+	StatusText     string `json:"title"`
+	HTTPStatusCode int    `json:"status"`
+	ErrorText      string `json:"detail,omitempty"`
+	Instance       string `json:"instance,omitempty"`
+	AppCode        int64  `json:"code,omitempty"`
+}
+
+func (e *ErrResponse) Error() string {
+	if e.ErrorText != "" {
+		return e.StatusText + " " + e.ErrorText
+	}
+
+	return e.StatusText
+}
 
-	StatusText string `json:"status"`
-	AppCode    int64  `json:"code,omitempty"`
-	ErrorText  string `json:"error,omitempty"`
+func (e *ErrResponse) Unwrap() error {
+	return e.Err
 }
 
 func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
@@ -20,7 +42,7 @@ func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-func ErrInvalidRequest(err error) render.Renderer {
+func ErrInvalidRequest(err error) *ErrResponse {
 	return &ErrResponse{
 		Err:            err,
 		HTTPStatusCode: 400,
@@ -29,7 +51,7 @@ func ErrInvalidRequest(err error) render.Renderer {
 	}
 }
 
-func ErrRender(err error) render.Renderer {
+func ErrRender(err error) *ErrResponse {
 	return &ErrResponse{
 		Err:            err,
 		HTTPStatusCode: 422,
@@ -38,4 +60,98 @@ func ErrRender(err error) render.Renderer {
 	}
 }
 
+func ErrValidation(err error) *ErrResponse {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 422,
+		StatusText:     "Validation failed.",
+		ErrorText:      err.Error(),
+	}
+}
+
+func ErrConflict(err error) *ErrResponse {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 409,
+		StatusText:     "Resource already exists.",
+		ErrorText:      err.Error(),
+	}
+}
+
 var ErrNotFound = &ErrResponse{HTTPStatusCode: 404, StatusText: "Resource not found."}
+
+var ErrUnauthorized = &ErrResponse{HTTPStatusCode: 401, StatusText: "Missing or invalid token."}
+
+var ErrForbidden = &ErrResponse{HTTPStatusCode: 403, StatusText: "Token lacks the required scope."}
+
+var ErrInvalidCredentials = &ErrResponse{HTTPStatusCode: 401, StatusText: "Invalid name or password."}
+
+var ErrInternal = &ErrResponse{HTTPStatusCode: 500, StatusText: "Internal server error."}
+
+var ErrPreconditionFailed = &ErrResponse{HTTPStatusCode: 412, StatusText: "Resource was changed since it was read."}
+
+var ErrPreconditionRequired = &ErrResponse{HTTPStatusCode: 428, StatusText: "Missing If-Match header."}
+
+var ErrIdempotencyKeyReused = &ErrResponse{HTTPStatusCode: 422, StatusText: "Idempotency-Key was used for a different request."}
+
+var ErrIdempotencyKeyInUse = &ErrResponse{HTTPStatusCode: 409, StatusText: "A request with this Idempotency-Key is still being handled."}
+
+var ErrTooManyRequests = &ErrResponse{HTTPStatusCode: 429, StatusText: "Too many requests."}
+
+var ErrTooLarge = &ErrResponse{HTTPStatusCode: 413, StatusText: "Request body too large."}
+
+var ErrOriginNotAllowed = &ErrResponse{HTTPStatusCode: 403, StatusText: "Cross-origin request not allowed."}
+
+var ErrInvalidCSRFToken = &ErrResponse{HTTPStatusCode: 403, StatusText: "Missing or invalid CSRF token."}
+
+var ErrUnavailable = &ErrResponse{HTTPStatusCode: 503, StatusText: "Service unavailable."}
+
+// FromError maps the errors returned by the stores to problem documents.
+// Unexpected errors are reported without details.
+func FromError(err error) *ErrResponse {
+	var problem *ErrResponse
+	var validation storeerr.ValidationError
+
+	switch {
+	case stderrors.Is(err, ErrTooLarge):
+		return ErrTooLarge
+	case stderrors.As(err, &problem):
+		return problem
+	case stderrors.As(err, &validation):
+		return ErrValidation(validation)
+	case stderrors.Is(err, storeerr.ErrNotFound):
+		return ErrNotFound
+	case stderrors.Is(err, storeerr.ErrConflict):
+		return ErrConflict(err)
+	case stderrors.Is(err, storeerr.ErrStale):
+		return ErrPreconditionFailed
+	case stderrors.Is(err, storeerr.ErrInvalidCredentials):
+		return ErrInvalidCredentials
+	}
+
+	return ErrInternal
+}
+
+// FromRequest maps 'err' like FromError, logging unexpected errors with the
+// logger of the request so they can be traced back to it
+func FromRequest(r *http.Request, err error) *ErrResponse {
+	problem := FromError(err)
+	if problem == ErrInternal && err != ErrInternal {
+		logging.FromContext(r.Context()).Error("internal error", "error", err, "path", r.URL.Path)
+	}
+
+	return problem
+}
+
+// Render writes the problem document matching 'err' as the response
+func Render(w http.ResponseWriter, r *http.Request, err error) {
+	problem := *FromRequest(r, err)
+	if problem.Type == "" {
+		problem.Type = "about:blank"
+	}
+	problem.Instance = r.URL.Path
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(problem.HTTPStatusCode)
+	json.NewEncoder(w).Encode(problem)
+}
@@ -0,0 +1,54 @@
+package errors_test
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/imgabe/todo/pkg/errors"
+	"github.com/imgabe/todo/pkg/store/storeerr"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		want      int
+		wantTitle string
+	}{
+		{name: "Not found", err: storeerr.ErrNotFound, want: 404, wantTitle: "Resource not found."},
+		{name: "Wrapped not found", err: fmt.Errorf("task 1: %w", storeerr.ErrNotFound), want: 404, wantTitle: "Resource not found."},
+		{name: "Conflict", err: fmt.Errorf("%w: name", storeerr.ErrConflict), want: 409, wantTitle: "Resource already exists."},
+		{name: "Validation", err: storeerr.ValidationError{Field: "name", Message: "must not be empty"}, want: 422, wantTitle: "Validation failed."},
+		{name: "Invalid credentials", err: storeerr.ErrInvalidCredentials, want: 401, wantTitle: "Invalid name or password."},
+		{name: "Problem", err: errors.ErrForbidden, want: 403, wantTitle: "Token lacks the required scope."},
+		{name: "Unexpected", err: stderrors.New("disk I/O error"), want: 500, wantTitle: "Internal server error."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/tasks/1", nil)
+			w := httptest.NewRecorder()
+			errors.Render(w, r, tt.err)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("Content-Type"); got != errors.ContentType {
+				t.Errorf("Content-Type = %q, want %q", got, errors.ContentType)
+			}
+
+			var problem map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("invalid body %s: %+v", w.Body, err)
+			}
+			if problem["title"] != tt.wantTitle || problem["status"] != float64(tt.want) || problem["instance"] != "/tasks/1" {
+				t.Errorf("body = %s", w.Body)
+			}
+			if tt.want == 500 && problem["detail"] != nil {
+				t.Errorf("internal error leaked in %s", w.Body)
+			}
+		})
+	}
+}
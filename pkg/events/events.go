@@ -0,0 +1,215 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/imgabe/todo/pkg/models"
+)
+
+// Type is the kind of change an event reports
+type Type string
+
+const (
+	// TaskCreated is published when a task is inserted
+	TaskCreated Type = "created"
+	// TaskUpdated is published when a task is edited or (un)assigned
+	TaskUpdated Type = "updated"
+	// TaskChecked is published when a task is checked
+	TaskChecked Type = "checked"
+	// TaskDeleted is published when a task is removed
+	TaskDeleted Type = "deleted"
+)
+
+// Event is a change made to a task
+type Event struct {
+	Type Type        `json:"type"`
+	Task models.Task `json:"task"`
+	Time time.Time   `json:"time"`
+}
+
+// Publisher is implemented by anything events can be sent to
+type Publisher interface {
+	Publish(e Event)
+}
+
+// bufferSize is how many events a subscriber may fall behind before
+// newer events are dropped for it
+const bufferSize = 64
+
+// Broker is an in-process publish/subscribe hub for task events
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[chan Event]struct{}
+	queues map[*queue]struct{}
+	closed bool
+}
+
+// NewBroker returns a broker without subscribers
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[chan Event]struct{}), queues: make(map[*queue]struct{})}
+}
+
+// Publish sends an event to every subscriber without blocking; slow
+// subscribers miss the events that do not fit in their buffer
+func (b *Broker) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	for q := range b.queues {
+		q.push(e)
+	}
+}
+
+// Subscribe returns a channel receiving every published event and a
+// function to stop the subscription, which closes the channel
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, bufferSize)
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+
+	return ch, cancel
+}
+
+// Queue is like Subscribe, but never drops events: they are held in memory
+// until received, however far the receiver falls behind. It suits
+// subscribers that must see every event, such as webhooks.
+func (b *Broker) Queue() (<-chan Event, func()) {
+	q := &queue{wake: make(chan struct{}, 1), stop: make(chan struct{}), out: make(chan Event)}
+	go q.run()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		q.close()
+		return q.out, func() {}
+	}
+	b.queues[q] = struct{}{}
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.queues[q]; ok {
+			delete(b.queues, q)
+			close(q.stop)
+		}
+	}
+
+	return q.out, cancel
+}
+
+// Close ends every subscription, so long-lived streams finish when the
+// server shuts down. Queues are closed once the events they hold are
+// received.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+	for q := range b.queues {
+		delete(b.queues, q)
+		q.close()
+	}
+	b.closed = true
+}
+
+// queue passes the events pushed to it on to 'out' in order, keeping the
+// ones not received yet
+type queue struct {
+	mu     sync.Mutex
+	events []Event
+	closed bool
+	// wake tells 'run' about a new event or the queue being closed
+	wake chan struct{}
+	// stop ends 'run' right away, dropping the events left
+	stop chan struct{}
+	out  chan Event
+}
+
+func (q *queue) push(e Event) {
+	q.mu.Lock()
+	q.events = append(q.events, e)
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+// close closes 'out' once the events left are received
+func (q *queue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+func (q *queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue) run() {
+	defer close(q.out)
+
+	for {
+		q.mu.Lock()
+		if len(q.events) > 0 {
+			e := q.events[0]
+			q.events[0] = Event{}
+			q.events = q.events[1:]
+			q.mu.Unlock()
+
+			select {
+			case q.out <- e:
+			case <-q.stop:
+				return
+			}
+			continue
+		}
+		closed := q.closed
+		q.mu.Unlock()
+
+		if closed {
+			return
+		}
+		select {
+		case <-q.wake:
+		case <-q.stop:
+			return
+		}
+	}
+}
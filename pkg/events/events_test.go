@@ -0,0 +1,92 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+func TestBroker(t *testing.T) {
+	broker := events.NewBroker()
+
+	first, cancelFirst := broker.Subscribe()
+	second, cancelSecond := broker.Subscribe()
+	defer cancelSecond()
+
+	broker.Publish(events.Event{Type: events.TaskCreated, Task: models.Task{ID: 1}})
+	for _, ch := range []<-chan events.Event{first, second} {
+		if got := <-ch; got.Type != events.TaskCreated || got.Task.ID != 1 || got.Time.IsZero() {
+			t.Errorf("Subscribe() received %+v", got)
+		}
+	}
+
+	cancelFirst()
+	if _, ok := <-first; ok {
+		t.Errorf("Subscribe() channel still open after cancel")
+	}
+
+	broker.Publish(events.Event{Type: events.TaskDeleted})
+	if got := <-second; got.Type != events.TaskDeleted {
+		t.Errorf("Subscribe() received %+v, want %+v", got.Type, events.TaskDeleted)
+	}
+
+	broker.Close()
+	if _, ok := <-second; ok {
+		t.Errorf("Subscribe() channel still open after Close")
+	}
+	if _, ok := <-mustSubscribe(broker); ok {
+		t.Errorf("Subscribe() after Close returned an open channel")
+	}
+}
+
+func TestBroker_Queue(t *testing.T) {
+	broker := events.NewBroker()
+	queued, _ := broker.Queue()
+	subscribed, cancel := broker.Subscribe()
+	defer cancel()
+
+	// far more events than a subscriber buffers, none received meanwhile
+	const published = 500
+	for i := 1; i <= published; i++ {
+		broker.Publish(events.Event{Type: events.TaskCreated, Task: models.Task{ID: int64(i)}})
+	}
+	broker.Close()
+
+	received := 0
+	for e := range queued {
+		received++
+		if e.Task.ID != int64(received) {
+			t.Fatalf("Queue() received task %d, want %d", e.Task.ID, received)
+		}
+	}
+	if received != published {
+		t.Errorf("Queue() received %d events, want %d", received, published)
+	}
+
+	dropped := published
+	for range subscribed {
+		dropped--
+	}
+	if dropped == 0 {
+		t.Errorf("Subscribe() received every event, want the ones over its buffer dropped")
+	}
+}
+
+func TestBroker_Queue_Cancel(t *testing.T) {
+	broker := events.NewBroker()
+	queued, cancel := broker.Queue()
+
+	broker.Publish(events.Event{Type: events.TaskCreated})
+	cancel()
+
+	for range queued {
+	}
+	broker.Publish(events.Event{Type: events.TaskDeleted})
+	broker.Close()
+}
+
+func mustSubscribe(b *events.Broker) <-chan events.Event {
+	ch, _ := b.Subscribe()
+	return ch
+}
@@ -0,0 +1,220 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level tells how important a log entry is
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+
+	return levelNames[l]
+}
+
+// ParseLevel reads one of 'debug', 'info', 'warn' or 'error'
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("unknown log level '%s', expected one of %s", s, strings.Join(levelNames, ", "))
+}
+
+// Format is how entries are written
+type Format string
+
+const (
+	// FormatText writes entries as logfmt 'key=value' pairs
+	FormatText Format = "text"
+	// FormatJSON writes entries as JSON objects, one per line
+	FormatJSON Format = "json"
+)
+
+// ParseFormat reads either 'text' or 'json'
+func ParseFormat(s string) (Format, error) {
+	switch format := Format(strings.ToLower(s)); format {
+	case FormatText, FormatJSON:
+		return format, nil
+	}
+
+	return FormatText, fmt.Errorf("unknown log format '%s', expected text or json", s)
+}
+
+// output is the writer shared by a logger and the loggers derived from it
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Logger writes leveled entries made of a message and key/value pairs
+type Logger struct {
+	out     *output
+	level   Level
+	format  Format
+	keyvals []interface{}
+	now     func() time.Time
+}
+
+// New returns a logger writing the entries of at least 'level' to 'w'
+func New(w io.Writer, level Level, format Format) *Logger {
+	return &Logger{out: &output{w: w}, level: level, format: format, now: time.Now}
+}
+
+// With returns a logger adding 'keyvals' to every entry
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	derived := *l
+	derived.keyvals = append(append([]interface{}{}, l.keyvals...), keyvals...)
+
+	return &derived
+}
+
+// Enabled reports whether entries of 'level' are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) { l.Log(LevelDebug, msg, keyvals...) }
+func (l *Logger) Info(msg string, keyvals ...interface{})  { l.Log(LevelInfo, msg, keyvals...) }
+func (l *Logger) Warn(msg string, keyvals ...interface{})  { l.Log(LevelWarn, msg, keyvals...) }
+func (l *Logger) Error(msg string, keyvals ...interface{}) { l.Log(LevelError, msg, keyvals...) }
+
+// Log writes an entry when 'level' is enabled. 'keyvals' alternates keys
+// and values; a key without value is logged with '(MISSING)'.
+func (l *Logger) Log(level Level, msg string, keyvals ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	pairs := append([]interface{}{"time", l.now().UTC().Format(time.RFC3339Nano), "level", level.String(), "msg", msg}, l.keyvals...)
+	pairs = append(pairs, keyvals...)
+	if len(pairs)%2 == 1 {
+		pairs = append(pairs, "(MISSING)")
+	}
+
+	var buf bytes.Buffer
+	if l.format == FormatJSON {
+		writeJSON(&buf, pairs)
+	} else {
+		writeText(&buf, pairs)
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(buf.Bytes())
+}
+
+// value turns errors, durations and other stringers into strings, leaving
+// the values JSON represents natively untouched
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, bool, string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	return fmt.Sprintf("%+v", v)
+}
+
+func writeText(buf *bytes.Buffer, pairs []interface{}) {
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+
+		buf.WriteString(fmt.Sprint(pairs[i]))
+		buf.WriteByte('=')
+
+		s := fmt.Sprint(value(pairs[i+1]))
+		if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	}
+	buf.WriteByte('\n')
+}
+
+func writeJSON(buf *bytes.Buffer, pairs []interface{}) {
+	buf.WriteByte('{')
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(fmt.Sprint(pairs[i]))
+		buf.Write(key)
+		buf.WriteByte(':')
+
+		data, err := json.Marshal(value(pairs[i+1]))
+		if err != nil {
+			data, _ = json.Marshal(fmt.Sprint(pairs[i+1]))
+		}
+		buf.Write(data)
+	}
+	buf.WriteString("}\n")
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger = New(os.Stderr, LevelInfo, FormatText)
+)
+
+// Default returns the logger used when no other is at hand, writing info
+// entries as text to stderr unless replaced with SetDefault
+func Default() *Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+
+	return defaultLogger
+}
+
+// SetDefault replaces the logger returned by Default
+func SetDefault(l *Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultLogger = l
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of 'ctx' carrying 'l'
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger carried by 'ctx', such as the one tagged
+// with the ID of a request, or the default logger
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+
+	return Default()
+}
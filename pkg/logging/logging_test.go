@@ -0,0 +1,101 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imgabe/todo/pkg/logging"
+)
+
+func TestLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   logging.Level
+		format  logging.Format
+		log     func(l *logging.Logger)
+		want    string
+		wantNot string
+	}{
+		{
+			name: "Text", level: logging.LevelInfo, format: logging.FormatText,
+			log:  func(l *logging.Logger) { l.Info("request served", "status", 200, "path", "/tasks") },
+			want: `level=info msg="request served" status=200 path=/tasks`,
+		},
+		{
+			name: "Text quoting", level: logging.LevelInfo, format: logging.FormatText,
+			log:  func(l *logging.Logger) { l.Warn("failed", "error", errors.New(`no "such" file`), "empty", "") },
+			want: `level=warn msg=failed error="no \"such\" file" empty=""`,
+		},
+		{
+			name: "Fields", level: logging.LevelInfo, format: logging.FormatText,
+			log:  func(l *logging.Logger) { l.With("request_id", "abc").Error("failed", "duration", time.Second) },
+			want: `level=error msg=failed request_id=abc duration=1s`,
+		},
+		{
+			name: "Missing value", level: logging.LevelInfo, format: logging.FormatText,
+			log:  func(l *logging.Logger) { l.Info("odd", "key") },
+			want: `msg=odd key=(MISSING)`,
+		},
+		{
+			name: "Below level", level: logging.LevelWarn, format: logging.FormatText,
+			log:     func(l *logging.Logger) { l.Info("hidden") },
+			wantNot: "hidden",
+		},
+		{
+			name: "JSON", level: logging.LevelDebug, format: logging.FormatJSON,
+			log: func(l *logging.Logger) {
+				l.With("request_id", "abc").Debug("query", "rows", 3, "error", errors.New("oops"))
+			},
+			want: `"level":"debug","msg":"query","request_id":"abc","rows":3,"error":"oops"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(logging.New(&buf, tt.level, tt.format))
+
+			got := buf.String()
+			if tt.want != "" && !strings.Contains(got, tt.want) {
+				t.Errorf("log = %q, want it to contain %q", got, tt.want)
+			}
+			if tt.wantNot != "" && strings.Contains(got, tt.wantNot) {
+				t.Errorf("log = %q, want it not to contain %q", got, tt.wantNot)
+			}
+			if tt.format == logging.FormatJSON && !json.Valid(buf.Bytes()) {
+				t.Errorf("log = %q is not valid JSON", got)
+			}
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, name := range []string{"debug", "INFO", "warn", "error"} {
+		level, err := logging.ParseLevel(name)
+		if err != nil || level.String() != strings.ToLower(name) {
+			t.Errorf("ParseLevel(%q) = %s, %v", name, level, err)
+		}
+	}
+
+	if _, err := logging.ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(\"verbose\") did not fail")
+	}
+	if _, err := logging.ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat(\"xml\") did not fail")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if logging.FromContext(context.Background()) != logging.Default() {
+		t.Error("FromContext() without logger is not the default logger")
+	}
+
+	l := logging.New(&bytes.Buffer{}, logging.LevelInfo, logging.FormatText)
+	if logging.FromContext(logging.NewContext(context.Background(), l)) != l {
+		t.Error("FromContext() is not the logger of the context")
+	}
+}
@@ -0,0 +1,266 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the Prometheus text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds, in seconds, of the histograms
+// measuring latencies
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is a family of series sharing a name
+type metric interface {
+	write(w io.Writer)
+}
+
+// Registry holds metrics and writes them in the Prometheus text format
+type Registry struct {
+	mu       sync.Mutex
+	metrics  []metric
+	collects []func()
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics = append(r.metrics, m)
+}
+
+// OnCollect runs 'collect' before each scrape, letting gauges be set from
+// values read on demand
+func (r *Registry) OnCollect(collect func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collects = append(r.collects, collect)
+}
+
+// Write runs the collect functions then writes every metric
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	collects := append([]func(){}, r.collects...)
+	metrics := append([]metric{}, r.metrics...)
+	r.mu.Unlock()
+
+	for _, collect := range collects {
+		collect()
+	}
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// ServeHTTP answers Prometheus scrapes
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.Write(w)
+}
+
+// family holds what every kind of metric shares: a name, a help text, the
+// names of its labels and one series per set of label values
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string][]string
+}
+
+func newFamily(name, help, kind string, labels []string) family {
+	return family{name: name, help: help, kind: kind, labels: labels, series: make(map[string][]string)}
+}
+
+// key identifies the series of 'values', remembering them for 'write'
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", f.name, len(f.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	if _, ok := f.series[key]; !ok {
+		f.series[key] = append([]string{}, values...)
+	}
+
+	return key
+}
+
+// keys returns the series in a stable order
+func (f *family) keys() []string {
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (f *family) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, strings.ReplaceAll(f.help, "\n", `\n`))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+}
+
+// labelPairs formats the labels of a series, followed by the 'extra' pairs
+func (f *family) labelPairs(values []string, extra ...string) string {
+	var pairs []string
+	for i, label := range f.labels {
+		pairs = append(pairs, label+"="+quote(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+quote(extra[i+1]))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Vec is a counter or gauge with one value per set of label values
+type Vec struct {
+	family
+	values map[string]float64
+}
+
+func (r *Registry) newVec(name, help, kind string, labels []string) *Vec {
+	v := &Vec{family: newFamily(name, help, kind, labels), values: make(map[string]float64)}
+	r.register(v)
+
+	return v
+}
+
+// NewCounter registers a value that only goes up
+func (r *Registry) NewCounter(name, help string, labels ...string) *Vec {
+	return r.newVec(name, help, "counter", labels)
+}
+
+// NewGauge registers a value that goes up and down
+func (r *Registry) NewGauge(name, help string, labels ...string) *Vec {
+	return r.newVec(name, help, "gauge", labels)
+}
+
+// Add adds 'delta' to the series of 'values'
+func (v *Vec) Add(delta float64, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.values[v.key(values)] += delta
+}
+
+// Inc adds one to the series of 'values'
+func (v *Vec) Inc(values ...string) {
+	v.Add(1, values...)
+}
+
+// Set replaces the value of the series of 'values', for gauges
+func (v *Vec) Set(value float64, values ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.values[v.key(values)] = value
+}
+
+func (v *Vec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.header(w)
+	for _, key := range v.keys() {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelPairs(v.series[key]), formatFloat(v.values[key]))
+	}
+}
+
+// Histogram counts observations in buckets, one set of buckets per set of
+// label values
+type Histogram struct {
+	family
+	buckets []float64
+	counts  map[string][]uint64
+	sums    map[string]float64
+	totals  map[string]uint64
+}
+
+// NewHistogram registers a histogram with the upper bounds 'buckets'
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		family:  newFamily(name, help, "histogram", labels),
+		buckets: buckets,
+		counts:  make(map[string][]uint64),
+		sums:    make(map[string]float64),
+		totals:  make(map[string]uint64),
+	}
+	r.register(h)
+
+	return h
+}
+
+// Observe records 'value' in the series of 'values'
+func (h *Histogram) Observe(value float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := h.key(values)
+	counts, ok := h.counts[key]
+	if !ok {
+		counts = make([]uint64, len(h.buckets))
+		h.counts[key] = counts
+	}
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			counts[i]++
+		}
+	}
+	h.sums[key] += value
+	h.totals[key]++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w)
+	for _, key := range h.keys() {
+		values := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(values, "le", formatFloat(bound)), h.counts[key][i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(values, "le", "+Inf"), h.totals[key])
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(values), formatFloat(h.sums[key]))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(values), h.totals[key])
+	}
+}
@@ -0,0 +1,62 @@
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/imgabe/todo/pkg/metrics"
+)
+
+func TestRegistry(t *testing.T) {
+	reg := metrics.NewRegistry()
+
+	requests := reg.NewCounter("requests_total", "Requests.", "route")
+	requests.Inc("/b")
+	requests.Add(2, "/a")
+	requests.Inc(`/"quoted"`)
+
+	tasks := reg.NewGauge("tasks", "Tasks.")
+	reg.OnCollect(func() { tasks.Set(3) })
+
+	latency := reg.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{route="/\"quoted\""} 1
+requests_total{route="/a"} 2
+requests_total{route="/b"} 1
+# HELP tasks Tasks.
+# TYPE tasks gauge
+tasks 3
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 5.55
+latency_seconds_count 3
+`
+	if got := w.Body.String(); got != want {
+		t.Errorf("metrics =\n%s\nwant\n%s", got, want)
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", got)
+	}
+}
+
+func TestVec_WrongLabels(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc() with missing label values did not panic")
+		}
+	}()
+
+	metrics.NewRegistry().NewCounter("requests_total", "Requests.", "route").Inc()
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// IdempotentRequest is a request sent with an 'Idempotency-Key' header and
+// the response it got, replayed when the request is retried with the same
+// key
+type IdempotentRequest struct {
+	OwnerID     int64     `db:"owner_id"`
+	Key         string    `db:"key"`
+	RequestHash string    `db:"request_hash"`
+	StatusCode  int       `db:"status_code"`
+	Header      string    `db:"header"`
+	Body        []byte    `db:"body"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// Pending reports whether the first request with the key is still being
+// handled, so there is no response to replay yet
+func (r IdempotentRequest) Pending() bool {
+	return r.StatusCode == 0
+}
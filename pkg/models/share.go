@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Permission is the access a user has to the tasks shared with them
+type Permission string
+
+const (
+	// PermissionRead allows reading the shared tasks
+	PermissionRead Permission = "read"
+	// PermissionWrite allows reading, editing, checking and removing the shared tasks
+	PermissionWrite Permission = "write"
+)
+
+// ParsePermission validates a permission name
+func ParsePermission(s string) (Permission, bool) {
+	switch permission := Permission(s); permission {
+	case PermissionRead, PermissionWrite:
+		return permission, true
+	default:
+		return permission, false
+	}
+}
+
+// Share grants a user access to all the tasks of an owner
+type Share struct {
+	OwnerID    int64      `db:"owner_id" json:"owner_id"`
+	UserID     int64      `db:"user_id" json:"user_id"`
+	Permission Permission `db:"permission" json:"permission"`
+}
+
+func (s *Share) Bind(r *http.Request) error {
+	if _, ok := ParsePermission(string(s.Permission)); !ok {
+		return errors.New("permission must be 'read' or 'write'")
+	}
+
+	return nil
+}
+
+func (s *Share) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// Assignment is the payload used to assign a task to a user by name. An
+// empty name removes the assignee.
+type Assignment struct {
+	Assignee string `json:"assignee"`
+}
+
+func (a *Assignment) Bind(r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MergeStrategy decides which side wins when a task was changed on both
+// sides of a sync
+type MergeStrategy string
+
+const (
+	// MergeLastWriter keeps the whole task as last changed
+	MergeLastWriter MergeStrategy = "lww"
+	// MergeFields keeps each field as last changed, so changes to different
+	// fields of a task are both kept
+	MergeFields MergeStrategy = "field"
+)
+
+// Valid reports whether the strategy is one of the known ones
+func (s MergeStrategy) Valid() bool {
+	return s == MergeLastWriter || s == MergeFields
+}
+
+// TaskChange is the state of a task exchanged when syncing databases.
+// Tasks are identified by UUID since their IDs differ between databases,
+// and times are Unix milliseconds.
+type TaskChange struct {
+	UUID                 string `db:"uuid" json:"uuid"`
+	Description          string `db:"description" json:"description"`
+	Done                 bool   `db:"done" json:"done"`
+	DescriptionUpdatedAt int64  `db:"description_updated_at" json:"description_updated_at"`
+	DoneUpdatedAt        int64  `db:"done_updated_at" json:"done_updated_at"`
+	// DescriptionClock and DoneClock are the hybrid logical clocks of the
+	// last changes to the fields, 'wall.counter.node' strings ordered like
+	// the changes. They take precedence over the times when set.
+	DescriptionClock string `db:"description_clock" json:"description_clock,omitempty"`
+	DoneClock        string `db:"done_clock" json:"done_clock,omitempty"`
+	// DescriptionChanged and DoneChanged tell which fields were changed
+	// since the previous sync, so that conflicts can be told apart from
+	// changes made on a single side
+	DescriptionChanged bool `db:"description_changed" json:"description_changed,omitempty"`
+	DoneChanged        bool `db:"done_changed" json:"done_changed,omitempty"`
+	// Deleted tells the task was deleted at DeletedAt and DeletedClock, the
+	// other fields being left empty
+	Deleted      bool   `db:"deleted" json:"deleted,omitempty"`
+	DeletedAt    int64  `db:"deleted_at" json:"deleted_at,omitempty"`
+	DeletedClock string `db:"deleted_clock" json:"deleted_clock,omitempty"`
+}
+
+// UpdatedAt returns when the task was last changed
+func (c TaskChange) UpdatedAt() int64 {
+	if c.Deleted {
+		return c.DeletedAt
+	}
+	if c.DoneUpdatedAt > c.DescriptionUpdatedAt {
+		return c.DoneUpdatedAt
+	}
+
+	return c.DescriptionUpdatedAt
+}
+
+// Clock returns the clock of the last change to the task
+func (c TaskChange) Clock() string {
+	if c.Deleted {
+		return c.DeletedClock
+	}
+	if CompareClocks(c.DoneClock, c.DescriptionClock) > 0 {
+		return c.DoneClock
+	}
+
+	return c.DescriptionClock
+}
+
+// ParseClock reads the wall time, counter and node of a clock
+func ParseClock(clock string) (int64, int64, string, bool) {
+	parts := strings.SplitN(clock, ".", 3)
+	if len(parts) != 3 {
+		return 0, 0, "", false
+	}
+
+	wall, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, "", false
+	}
+	counter, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, "", false
+	}
+
+	return wall, counter, parts[2], true
+}
+
+// CompareClocks returns -1, 0 or 1 as clock 'a' is before, the same as or
+// after clock 'b'. Walls and counters are compared as numbers, since the
+// counter outgrows its padding after 99999 changes in a millisecond, and
+// clocks that cannot be read as strings.
+func CompareClocks(a, b string) int {
+	aWall, aCounter, aNode, aOK := ParseClock(a)
+	bWall, bCounter, bNode, bOK := ParseClock(b)
+	switch {
+	case !aOK || !bOK:
+		return strings.Compare(a, b)
+	case aWall != bWall:
+		return compareInts(aWall, bWall)
+	case aCounter != bCounter:
+		return compareInts(aCounter, bCounter)
+	}
+
+	return strings.Compare(aNode, bNode)
+}
+
+func compareInts(a, b int64) int {
+	if a < b {
+		return -1
+	}
+
+	return 1
+}
+
+// SyncConflict reports a field of a task changed on both sides of a sync
+// since they last synced. 'Ours' is the value of the database merging the
+// changes and 'Theirs' the value received.
+type SyncConflict struct {
+	UUID        string `json:"uuid"`
+	Description string `json:"description"`
+	// Field is 'description', 'done' or 'deleted'
+	Field  string `json:"field"`
+	Ours   string `json:"ours"`
+	Theirs string `json:"theirs"`
+	// Kept is either 'ours' or 'theirs'
+	Kept string `json:"kept"`
+}
+
+// MergeResult describes what merging sync changes did to a database
+type MergeResult struct {
+	// Applied is how many tasks were created, changed or deleted
+	Applied   int
+	Conflicts []SyncConflict
+	// Before and After are the values of the sequence around the merge,
+	// the changes numbered in between being the ones the merge made
+	Before int64
+	After  int64
+}
+
+// SyncState is where the sync of the tasks of a user with a server stands
+type SyncState struct {
+	Remote  string `db:"remote"`
+	OwnerID int64  `db:"owner_id"`
+	// Cursor is the one returned by the server on the last sync
+	Cursor int64 `db:"cursor"`
+	// Pushed is the sequence number of the last local change sent
+	Pushed int64 `db:"pushed"`
+}
+
+// SyncRequest is the payload of 'POST /sync'
+type SyncRequest struct {
+	// Since is the cursor returned by the previous sync, zero for the first
+	Since    int64         `json:"since"`
+	Strategy MergeStrategy `json:"strategy"`
+	Changes  []TaskChange  `json:"changes"`
+}
+
+func (s *SyncRequest) Bind(r *http.Request) error {
+	if s.Strategy == "" {
+		s.Strategy = MergeLastWriter
+	}
+	if !s.Strategy.Valid() {
+		return errors.New("strategy must be 'lww' or 'field'")
+	}
+	if s.Since < 0 {
+		return errors.New("since must not be negative")
+	}
+
+	for _, change := range s.Changes {
+		if change.UUID == "" {
+			return errors.New("missing required uuid of change")
+		}
+		if !change.Deleted && change.Description == "" {
+			return errors.New("missing required description of change")
+		}
+	}
+
+	return nil
+}
+
+// SyncResponse answers 'POST /sync' with the changes made on the server
+// since the request's cursor, once the request's changes are merged
+type SyncResponse struct {
+	// Cursor is sent as 'since' by the next sync
+	Cursor    int64          `json:"cursor"`
+	Changes   []TaskChange   `json:"changes"`
+	Conflicts []SyncConflict `json:"conflicts"`
+}
+
+func (s *SyncResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -9,6 +9,9 @@ type Task struct {
 	ID          int64  `db:"id" json:"id"`
 	Description string `db:"description" json:"description"`
 	Done        bool   `db:"done" json:"done"`
+	OwnerID     *int64 `db:"owner_id" json:"owner_id,omitempty"`
+	AssigneeID  *int64 `db:"assignee_id" json:"assignee_id,omitempty"`
+	Version     int64  `db:"version" json:"version"`
 }
 
 func (t *Task) Bind(r *http.Request) error {
@@ -23,3 +26,38 @@ func (t *Task) Bind(r *http.Request) error {
 func (t *Task) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
+
+// Page selects the tasks listed at once, in the order of their IDs
+type Page struct {
+	// After skips the tasks with an ID up to this one
+	After int64
+	// Limit is the most tasks listed, every task when zero
+	Limit int
+}
+
+// TaskPatch is the payload used to change some fields of a task, leaving
+// the missing ones untouched
+type TaskPatch struct {
+	Description *string `json:"description"`
+	Done        *bool   `json:"done"`
+}
+
+func (p *TaskPatch) Bind(r *http.Request) error {
+	if p.Description != nil && *p.Description == "" {
+		return errors.New("Description must not be empty")
+	}
+
+	return nil
+}
+
+// Apply returns 'task' with the fields set on the patch
+func (p TaskPatch) Apply(task Task) Task {
+	if p.Description != nil {
+		task.Description = *p.Description
+	}
+	if p.Done != nil {
+		task.Done = *p.Done
+	}
+
+	return task
+}
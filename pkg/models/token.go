@@ -0,0 +1,59 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Scope is a permission granted to an API token
+type Scope string
+
+const (
+	// ScopeRead allows reading tasks
+	ScopeRead Scope = "read"
+	// ScopeWrite allows creating, editing and removing tasks
+	ScopeWrite Scope = "write"
+	// ScopeAdmin allows everything
+	ScopeAdmin Scope = "admin"
+)
+
+// ParseScope validates a scope name
+func ParseScope(s string) (Scope, bool) {
+	switch scope := Scope(strings.TrimSpace(s)); scope {
+	case ScopeRead, ScopeWrite, ScopeAdmin:
+		return scope, true
+	default:
+		return scope, false
+	}
+}
+
+// Token is an API token. Only the hash of the secret is kept.
+type Token struct {
+	ID        int64      `db:"id" json:"id"`
+	Name      string     `db:"name" json:"name"`
+	Hash      string     `db:"hash" json:"-"`
+	Scopes    string     `db:"scopes" json:"scopes"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	ExpiresAt *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	UserID    *int64     `db:"user_id" json:"user_id,omitempty"`
+}
+
+// HasScope reports whether the token grants 'scope'. Admin tokens grant
+// every scope and write tokens can also read.
+func (t Token) HasScope(scope Scope) bool {
+	for _, s := range strings.Split(t.Scopes, ",") {
+		switch granted := Scope(s); {
+		case granted == scope, granted == ScopeAdmin:
+			return true
+		case granted == ScopeWrite && scope == ScopeRead:
+			return true
+		}
+	}
+
+	return false
+}
+
+// Expired reports whether the token is no longer valid at 'now'
+func (t Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// User is an account of the web server owning tasks
+type User struct {
+	ID           int64     `db:"id" json:"id"`
+	Name         string    `db:"name" json:"name"`
+	PasswordHash string    `db:"password_hash" json:"-"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+func (u *User) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// Credentials is the payload used to register and log in
+type Credentials struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+func (c *Credentials) Bind(r *http.Request) error {
+	if c.Name == "" || c.Password == "" {
+		return errors.New("missing required Name or Password fields")
+	}
+
+	return nil
+}
+
+// Session is returned on log in, holding a token for later requests
+type Session struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *Session) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
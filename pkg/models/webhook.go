@@ -0,0 +1,46 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Webhook is a URL receiving the events it subscribed to on the tasks of
+// its owner, or on the tasks without owner when it has none
+type Webhook struct {
+	ID        int64     `db:"id" json:"id"`
+	URL       string    `db:"url" json:"url"`
+	Events    string    `db:"events" json:"events"`
+	Secret    string    `db:"secret" json:"-"`
+	OwnerID   *int64    `db:"owner_id" json:"owner_id,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// Subscribed reports whether the webhook receives events of type 'event'
+func (w Webhook) Subscribed(event string) bool {
+	for _, e := range strings.Split(w.Events, ",") {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Delivery is an attempt to deliver an event to a webhook. Attempts of the
+// same event share the Delivery identifier.
+type Delivery struct {
+	ID         int64     `db:"id" json:"id"`
+	WebhookID  int64     `db:"webhook_id" json:"webhook_id"`
+	Delivery   string    `db:"delivery" json:"delivery"`
+	Event      string    `db:"event" json:"event"`
+	Attempt    int       `db:"attempt" json:"attempt"`
+	StatusCode int       `db:"status_code" json:"status_code"`
+	Error      string    `db:"error" json:"error"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// Succeeded reports whether the receiver accepted the delivery
+func (d Delivery) Succeeded() bool {
+	return d.StatusCode >= 200 && d.StatusCode < 300
+}
@@ -5,5 +5,245 @@ var CreateDatabaseStatement = `
 		id   INTEGER NOT NULL PRIMARY KEY,
 		description TEXT    NOT NULL,
 		done BOOL    NOT NULL
-	)
+	);
+
+	CREATE TABLE IF NOT EXISTS token (
+		id         INTEGER   NOT NULL PRIMARY KEY,
+		name       TEXT      NOT NULL,
+		hash       TEXT      NOT NULL UNIQUE,
+		scopes     TEXT      NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP
+	);
+`
+
+var CreateUserStatement = `
+	CREATE TABLE IF NOT EXISTS user (
+		id            INTEGER   NOT NULL PRIMARY KEY,
+		name          TEXT      NOT NULL UNIQUE,
+		password_hash TEXT      NOT NULL,
+		created_at    TIMESTAMP NOT NULL
+	);
+
+	ALTER TABLE task ADD COLUMN owner_id INTEGER REFERENCES user (id);
+	ALTER TABLE token ADD COLUMN user_id INTEGER REFERENCES user (id);
+`
+
+var CreateShareStatement = `
+	ALTER TABLE task ADD COLUMN assignee_id INTEGER REFERENCES user (id);
+
+	CREATE TABLE IF NOT EXISTS share (
+		owner_id   INTEGER NOT NULL REFERENCES user (id),
+		user_id    INTEGER NOT NULL REFERENCES user (id),
+		permission TEXT    NOT NULL,
+		PRIMARY KEY (owner_id, user_id)
+	);
+`
+
+var CreateWebhookStatement = `
+	CREATE TABLE IF NOT EXISTS webhook (
+		id         INTEGER   NOT NULL PRIMARY KEY,
+		url        TEXT      NOT NULL,
+		events     TEXT      NOT NULL,
+		secret     TEXT      NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_delivery (
+		id          INTEGER   NOT NULL PRIMARY KEY,
+		webhook_id  INTEGER   NOT NULL REFERENCES webhook (id),
+		delivery    TEXT      NOT NULL,
+		event       TEXT      NOT NULL,
+		attempt     INTEGER   NOT NULL,
+		status_code INTEGER   NOT NULL,
+		error       TEXT      NOT NULL,
+		created_at  TIMESTAMP NOT NULL
+	);
+`
+
+// CreateWebhookOwnerStatement gives webhooks the owner of the tasks whose
+// events they receive. Existing webhooks receive the events of the tasks
+// without owner.
+var CreateWebhookOwnerStatement = `
+	ALTER TABLE webhook ADD COLUMN owner_id INTEGER REFERENCES user (id);
+`
+
+var CreateVersionStatement = `
+	ALTER TABLE task ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+`
+
+var CreateIdempotencyStatement = `
+	CREATE TABLE IF NOT EXISTS idempotency_key (
+		owner_id     INTEGER   NOT NULL,
+		key          TEXT      NOT NULL,
+		request_hash TEXT      NOT NULL,
+		status_code  INTEGER   NOT NULL,
+		header       TEXT      NOT NULL,
+		body         BLOB      NOT NULL,
+		created_at   TIMESTAMP NOT NULL,
+		PRIMARY KEY (owner_id, key)
+	);
+
+	CREATE INDEX IF NOT EXISTS idempotency_key_created_at ON idempotency_key (created_at);
+`
+
+// nowMillis is the SQL expression of the current time in Unix milliseconds
+const nowMillis = `CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)`
+
+// CreateSyncStatement tracks the changes made to tasks so they can be
+// exchanged with other databases. Triggers keep 'task_sync' up to date on
+// every write, numbering changes from 'sync_sequence' and recording when
+// each field was last changed, and leave a 'task_tombstone' behind deleted
+// tasks.
+var CreateSyncStatement = `
+	CREATE TABLE IF NOT EXISTS sync_sequence (
+		value INTEGER NOT NULL
+	);
+
+	INSERT INTO sync_sequence (value) SELECT COALESCE(MAX(id), 0) FROM task;
+
+	CREATE TABLE IF NOT EXISTS task_sync (
+		task_id                INTEGER NOT NULL PRIMARY KEY REFERENCES task (id),
+		uuid                   TEXT    NOT NULL UNIQUE,
+		description_updated_at INTEGER NOT NULL,
+		done_updated_at        INTEGER NOT NULL,
+		description_seq        INTEGER NOT NULL,
+		done_seq               INTEGER NOT NULL,
+		change_seq             INTEGER NOT NULL
+	);
+
+	INSERT INTO task_sync (task_id, uuid, description_updated_at, done_updated_at, description_seq, done_seq, change_seq)
+		SELECT id, lower(hex(randomblob(16))), ` + nowMillis + `, ` + nowMillis + `, id, id, id FROM task;
+
+	CREATE INDEX IF NOT EXISTS task_sync_change_seq ON task_sync (change_seq);
+
+	CREATE TABLE IF NOT EXISTS task_tombstone (
+		uuid       TEXT    NOT NULL PRIMARY KEY,
+		owner_id   INTEGER REFERENCES user (id),
+		deleted_at INTEGER NOT NULL,
+		change_seq INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS task_tombstone_change_seq ON task_tombstone (change_seq);
+
+	CREATE TABLE IF NOT EXISTS sync_state (
+		remote   TEXT    NOT NULL,
+		owner_id INTEGER NOT NULL,
+		cursor   INTEGER NOT NULL,
+		pushed   INTEGER NOT NULL,
+		PRIMARY KEY (remote, owner_id)
+	);
+
+	CREATE TRIGGER IF NOT EXISTS task_sync_insert AFTER INSERT ON task
+	BEGIN
+		UPDATE sync_sequence SET value = value + 1;
+		INSERT INTO task_sync (task_id, uuid, description_updated_at, done_updated_at, description_seq, done_seq, change_seq)
+			SELECT NEW.id, lower(hex(randomblob(16))), ` + nowMillis + `, ` + nowMillis + `, value, value, value
+			FROM sync_sequence;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS task_sync_update AFTER UPDATE OF description, done ON task
+	WHEN OLD.description IS NOT NEW.description OR OLD.done IS NOT NEW.done
+	BEGIN
+		UPDATE sync_sequence SET value = value + 1;
+		UPDATE task_sync SET
+			description_updated_at = CASE WHEN OLD.description IS NOT NEW.description THEN ` + nowMillis + ` ELSE description_updated_at END,
+			done_updated_at = CASE WHEN OLD.done IS NOT NEW.done THEN ` + nowMillis + ` ELSE done_updated_at END,
+			description_seq = CASE WHEN OLD.description IS NOT NEW.description THEN (SELECT value FROM sync_sequence) ELSE description_seq END,
+			done_seq = CASE WHEN OLD.done IS NOT NEW.done THEN (SELECT value FROM sync_sequence) ELSE done_seq END,
+			change_seq = (SELECT value FROM sync_sequence)
+		WHERE task_id = NEW.id;
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS task_sync_delete AFTER DELETE ON task
+	BEGIN
+		UPDATE sync_sequence SET value = value + 1;
+		INSERT OR REPLACE INTO task_tombstone (uuid, owner_id, deleted_at, change_seq)
+			SELECT uuid, OLD.owner_id, ` + nowMillis + `, (SELECT value FROM sync_sequence)
+			FROM task_sync
+			WHERE task_id = OLD.id;
+		DELETE FROM task_sync WHERE task_id = OLD.id;
+	END;
+`
+
+// CreateClockStatement orders the changes made to tasks with a hybrid
+// logical clock, 'sync_clock', instead of the wall clock alone, so that
+// every database orders concurrent changes the same way. Clocks are
+// written 'wall.counter.node' and ordered by 'models.CompareClocks'.
+var CreateClockStatement = `
+	CREATE TABLE IF NOT EXISTS sync_clock (
+		node    TEXT    NOT NULL,
+		wall    INTEGER NOT NULL,
+		counter INTEGER NOT NULL
+	);
+
+	INSERT INTO sync_clock (node, wall, counter)
+		SELECT lower(hex(randomblob(8))), COALESCE(MAX(MAX(description_updated_at), MAX(done_updated_at)), 0), 0 FROM task_sync;
+
+	ALTER TABLE task_sync ADD COLUMN description_clock TEXT NOT NULL DEFAULT '';
+	ALTER TABLE task_sync ADD COLUMN done_clock TEXT NOT NULL DEFAULT '';
+
+	UPDATE task_sync SET
+		description_clock = (SELECT printf('%013d.%05d.%s', description_updated_at, 0, node) FROM sync_clock),
+		done_clock = (SELECT printf('%013d.%05d.%s', done_updated_at, 0, node) FROM sync_clock);
+
+	DROP TRIGGER IF EXISTS task_sync_insert;
+	DROP TRIGGER IF EXISTS task_sync_update;
+
+	CREATE TRIGGER task_sync_insert AFTER INSERT ON task
+	BEGIN
+		UPDATE sync_sequence SET value = value + 1;
+		UPDATE sync_clock SET
+			counter = CASE WHEN ` + nowMillis + ` > wall THEN 0 ELSE counter + 1 END,
+			wall = MAX(wall, ` + nowMillis + `);
+		INSERT INTO task_sync (task_id, uuid, description_updated_at, done_updated_at, description_seq, done_seq, change_seq, description_clock, done_clock)
+			SELECT NEW.id, lower(hex(randomblob(16))), ` + nowMillis + `, ` + nowMillis + `, value, value, value,
+				(SELECT printf('%013d.%05d.%s', wall, counter, node) FROM sync_clock),
+				(SELECT printf('%013d.%05d.%s', wall, counter, node) FROM sync_clock)
+			FROM sync_sequence;
+	END;
+
+	CREATE TRIGGER task_sync_update AFTER UPDATE OF description, done ON task
+	WHEN OLD.description IS NOT NEW.description OR OLD.done IS NOT NEW.done
+	BEGIN
+		UPDATE sync_sequence SET value = value + 1;
+		UPDATE sync_clock SET
+			counter = CASE WHEN ` + nowMillis + ` > wall THEN 0 ELSE counter + 1 END,
+			wall = MAX(wall, ` + nowMillis + `);
+		UPDATE task_sync SET
+			description_updated_at = CASE WHEN OLD.description IS NOT NEW.description THEN ` + nowMillis + ` ELSE description_updated_at END,
+			done_updated_at = CASE WHEN OLD.done IS NOT NEW.done THEN ` + nowMillis + ` ELSE done_updated_at END,
+			description_clock = CASE WHEN OLD.description IS NOT NEW.description THEN (SELECT printf('%013d.%05d.%s', wall, counter, node) FROM sync_clock) ELSE description_clock END,
+			done_clock = CASE WHEN OLD.done IS NOT NEW.done THEN (SELECT printf('%013d.%05d.%s', wall, counter, node) FROM sync_clock) ELSE done_clock END,
+			description_seq = CASE WHEN OLD.description IS NOT NEW.description THEN (SELECT value FROM sync_sequence) ELSE description_seq END,
+			done_seq = CASE WHEN OLD.done IS NOT NEW.done THEN (SELECT value FROM sync_sequence) ELSE done_seq END,
+			change_seq = (SELECT value FROM sync_sequence)
+		WHERE task_id = NEW.id;
+	END;
+`
+
+// CreateTombstoneClockStatement stamps deletions with the clock of the
+// database too, so that a task deleted on one side and changed on the
+// other is kept or deleted as ordered by their clocks
+var CreateTombstoneClockStatement = `
+	ALTER TABLE task_tombstone ADD COLUMN clock TEXT NOT NULL DEFAULT '';
+
+	UPDATE task_tombstone SET
+		clock = (SELECT printf('%013d.%05d.%s', deleted_at, 0, node) FROM sync_clock);
+
+	DROP TRIGGER IF EXISTS task_sync_delete;
+
+	CREATE TRIGGER task_sync_delete AFTER DELETE ON task
+	BEGIN
+		UPDATE sync_sequence SET value = value + 1;
+		UPDATE sync_clock SET
+			counter = CASE WHEN ` + nowMillis + ` > wall THEN 0 ELSE counter + 1 END,
+			wall = MAX(wall, ` + nowMillis + `);
+		INSERT OR REPLACE INTO task_tombstone (uuid, owner_id, deleted_at, change_seq, clock)
+			SELECT uuid, OLD.owner_id, ` + nowMillis + `, (SELECT value FROM sync_sequence),
+				(SELECT printf('%013d.%05d.%s', wall, counter, node) FROM sync_clock)
+			FROM task_sync
+			WHERE task_id = OLD.id;
+		DELETE FROM task_sync WHERE task_id = OLD.id;
+	END;
 `
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/imgabe/todo/pkg/store/storeerr"
+	"github.com/mattn/go-sqlite3"
+)
+
+// the errors returned by the stores, defined in 'storeerr'
+var (
+	ErrNotFound           = storeerr.ErrNotFound
+	ErrConflict           = storeerr.ErrConflict
+	ErrStale              = storeerr.ErrStale
+	ErrInvalidCredentials = storeerr.ErrInvalidCredentials
+)
+
+// ValidationError is returned when a record is rejected before reaching
+// the database
+type ValidationError = storeerr.ValidationError
+
+// translate turns driver errors into the domain errors above
+func translate(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return fmt.Errorf("%w: %s", ErrConflict, sqliteErr.Error())
+		}
+	}
+
+	return err
+}
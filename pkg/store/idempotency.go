@@ -0,0 +1,119 @@
+package store
+
+import (
+	"time"
+
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// IdempotencyStore is responsible for all database actions related to
+// idempotency keys and the responses recorded for them
+type IdempotencyStore struct {
+	DB *sqlx.DB
+}
+
+// Reserve records 'request' as pending unless its key is already in use by
+// the same owner since 'since', or by a request still pending since
+// 'leaseSince'. It returns the request holding the key and whether it is the
+// one just reserved.
+func (s IdempotencyStore) Reserve(request models.IdempotentRequest, since, leaseSince time.Time) (models.IdempotentRequest, bool, error) {
+	deleteStmt := `
+		DELETE FROM idempotency_key
+		WHERE owner_id = $1 AND key = $2
+			AND (created_at < $3 OR (status_code = 0 AND created_at < $4))
+	`
+
+	insertStmt := `
+		INSERT INTO idempotency_key (owner_id, key, request_hash, status_code, header, body, created_at)
+		VALUES (:owner_id, :key, :request_hash, 0, '', x'', :created_at)
+		ON CONFLICT (owner_id, key) DO NOTHING
+	`
+
+	selectStmt := `
+		SELECT *
+		FROM idempotency_key
+		WHERE owner_id = $1 AND key = $2
+	`
+
+	var received models.IdempotentRequest
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return received, false, translate(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(deleteStmt, request.OwnerID, request.Key, since.UTC(), leaseSince.UTC())
+	if err != nil {
+		return received, false, translate(err)
+	}
+
+	request.CreatedAt = time.Now().UTC()
+	result, err := tx.NamedExec(insertStmt, &request)
+	if err != nil {
+		return received, false, translate(err)
+	}
+
+	err = tx.Get(&received, selectStmt, request.OwnerID, request.Key)
+	if err != nil {
+		return models.IdempotentRequest{}, false, translate(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.IdempotentRequest{}, false, translate(err)
+	}
+
+	affected, _ := result.RowsAffected()
+	return received, affected == 1, nil
+}
+
+// Complete records the response of a reserved request
+func (s IdempotencyStore) Complete(request models.IdempotentRequest) error {
+	stmt := `
+		UPDATE idempotency_key
+		SET status_code = :status_code,
+			header = :header,
+			body = :body
+		WHERE owner_id = :owner_id AND key = :key
+	`
+
+	result, err := s.DB.NamedExec(stmt, &request)
+	if err != nil {
+		return translate(err)
+	}
+
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Release frees a reserved key, letting the request be retried
+func (s IdempotencyStore) Release(ownerID int64, key string) error {
+	stmt := `
+		DELETE FROM idempotency_key
+		WHERE owner_id = $1 AND key = $2
+	`
+
+	_, err := s.DB.Exec(stmt, ownerID, key)
+	return translate(err)
+}
+
+// DeleteExpired removes the keys reserved before 'before', returning how
+// many were removed
+func (s IdempotencyStore) DeleteExpired(before time.Time) (int64, error) {
+	stmt := `
+		DELETE FROM idempotency_key
+		WHERE created_at < $1
+	`
+
+	result, err := s.DB.Exec(stmt, before.UTC())
+	if err != nil {
+		return 0, translate(err)
+	}
+
+	return result.RowsAffected()
+}
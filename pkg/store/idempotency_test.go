@@ -0,0 +1,86 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+)
+
+func TestIdempotencyStore_Reserve(t *testing.T) {
+	hour := time.Hour
+
+	tests := []struct {
+		name         string
+		request      models.IdempotentRequest
+		window       time.Duration
+		wantReserved bool
+		wantStatus   int
+	}{
+		{name: "New key", request: models.IdempotentRequest{OwnerID: 1, Key: "b", RequestHash: "h"}, window: hour, wantReserved: true},
+		{name: "Key of another owner", request: models.IdempotentRequest{OwnerID: 2, Key: "a", RequestHash: "h"}, window: hour, wantReserved: true},
+		{name: "Used key", request: models.IdempotentRequest{OwnerID: 1, Key: "a", RequestHash: "h"}, window: hour, wantReserved: false, wantStatus: 201},
+		{name: "Expired key", request: models.IdempotentRequest{OwnerID: 1, Key: "a", RequestHash: "h"}, window: -hour, wantReserved: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := store.IdempotencyStore{DB: mustOpenDatabase(databasePath)}
+
+			used := models.IdempotentRequest{OwnerID: 1, Key: "a", RequestHash: "h"}
+			if _, reserved, err := is.Reserve(used, time.Now().Add(-hour), time.Now().Add(-hour)); err != nil || !reserved {
+				t.Fatalf("IdempotencyStore.Reserve() = %v, %+v", reserved, err)
+			}
+			used.StatusCode, used.Header, used.Body = 201, `{}`, []byte(`{"id":1}`)
+			if err := is.Complete(used); err != nil {
+				t.Fatalf("IdempotencyStore.Complete() error = %+v", err)
+			}
+
+			got, reserved, err := is.Reserve(tt.request, time.Now().Add(-tt.window), time.Now().Add(-hour))
+			if err != nil {
+				t.Fatalf("IdempotencyStore.Reserve() error = %+v", err)
+			}
+			if reserved != tt.wantReserved || got.StatusCode != tt.wantStatus {
+				t.Errorf("IdempotencyStore.Reserve() = %+v, %v, want status %d, %v", got, reserved, tt.wantStatus, tt.wantReserved)
+			}
+			if !reserved && string(got.Body) != `{"id":1}` {
+				t.Errorf("IdempotencyStore.Reserve() body = %s, want the recorded one", got.Body)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStore_Reserve_Lease(t *testing.T) {
+	is := store.IdempotencyStore{DB: mustOpenDatabase(databasePath)}
+	request := models.IdempotentRequest{OwnerID: 1, Key: "a", RequestHash: "h"}
+
+	if _, reserved, err := is.Reserve(request, time.Now().Add(-time.Hour), time.Now()); err != nil || !reserved {
+		t.Fatalf("IdempotencyStore.Reserve() = %v, %+v", reserved, err)
+	}
+	if _, reserved, err := is.Reserve(request, time.Now().Add(-time.Hour), time.Now().Add(-time.Minute)); err != nil || reserved {
+		t.Errorf("IdempotencyStore.Reserve() within the lease = %v, %+v, want the key in use", reserved, err)
+	}
+	if _, reserved, err := is.Reserve(request, time.Now().Add(-time.Hour), time.Now().Add(time.Minute)); err != nil || !reserved {
+		t.Errorf("IdempotencyStore.Reserve() after the lease = %v, %+v, want the key reserved again", reserved, err)
+	}
+}
+
+func TestIdempotencyStore_DeleteExpired(t *testing.T) {
+	is := store.IdempotencyStore{DB: mustOpenDatabase(databasePath)}
+
+	for _, key := range []string{"a", "b"} {
+		if _, _, err := is.Reserve(models.IdempotentRequest{OwnerID: 1, Key: key}, time.Now(), time.Now()); err != nil {
+			t.Fatalf("IdempotencyStore.Reserve() error = %+v", err)
+		}
+	}
+	if err := is.Release(1, "b"); err != nil {
+		t.Fatalf("IdempotencyStore.Release() error = %+v", err)
+	}
+
+	if deleted, err := is.DeleteExpired(time.Now().Add(-time.Hour)); err != nil || deleted != 0 {
+		t.Errorf("IdempotencyStore.DeleteExpired() = %d, %+v, want 0", deleted, err)
+	}
+	if deleted, err := is.DeleteExpired(time.Now().Add(time.Hour)); err != nil || deleted != 1 {
+		t.Errorf("IdempotencyStore.DeleteExpired() = %d, %+v, want 1", deleted, err)
+	}
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/imgabe/todo/pkg/logging"
+)
+
+// logged logs a store operation once it returned, at debug level, or at
+// error level when it failed for a reason callers do not expect, such as
+// the database being unreachable rather than ErrNotFound. It is deferred
+// with the error result of the operation.
+func logged(l *logging.Logger, operation string, start time.Time, err *error) {
+	elapsed := time.Since(start)
+
+	var validation ValidationError
+	switch {
+	case *err == nil,
+		errors.Is(*err, ErrNotFound), errors.Is(*err, ErrConflict), errors.Is(*err, ErrStale),
+		errors.Is(*err, ErrInvalidCredentials), errors.As(*err, &validation):
+		l.Debug("store operation", "operation", operation, "duration", elapsed, "error", *err)
+	default:
+		l.Error("store operation failed", "operation", operation, "duration", elapsed, "error", *err)
+	}
+}
+
+// storeLogger returns 'l', or the default logger when nil, tagged with the
+// store and the owner of the records it reaches
+func storeLogger(l *logging.Logger, store string, ownerID int64) *logging.Logger {
+	if l == nil {
+		l = logging.Default()
+	}
+
+	return l.With("store", store, "owner_id", ownerID)
+}
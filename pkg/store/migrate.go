@@ -0,0 +1,53 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migrations are applied in order, each one exactly once. The number of
+// applied migrations is kept in SQLite's 'user_version'.
+var migrations = []string{
+	CreateDatabaseStatement,
+	CreateUserStatement,
+	CreateShareStatement,
+	CreateWebhookStatement,
+	CreateWebhookOwnerStatement,
+	CreateVersionStatement,
+	CreateIdempotencyStatement,
+	CreateSyncStatement,
+	CreateClockStatement,
+	CreateTombstoneClockStatement,
+}
+
+// Migrate brings the database schema up to date
+func Migrate(db *sqlx.DB) error {
+	var version int
+	if err := db.Get(&version, "PRAGMA user_version"); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Beginx()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// legacyFileName is the database file name used before the XDG layout
+	legacyFileName = "database.todo"
+	// dataDirName is the directory created inside the XDG data home
+	dataDirName = "todo"
+	// dataFileName is the database file name inside the data directory
+	dataFileName = "todo.db"
+	// lockTimeout is how long MigrateLegacy waits for another process to
+	// finish migrating
+	lockTimeout = 5 * time.Second
+)
+
+// DefaultPath returns the default database path following the XDG base
+// directory specification, i.e. '$XDG_DATA_HOME/todo/todo.db'. It fails
+// when neither XDG_DATA_HOME nor the home directory are known.
+func DefaultPath() (string, error) {
+	dir, err := dataHome()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, dataDirName, dataFileName), nil
+}
+
+// LegacyPath returns the database path used by older versions, in the home
+// directory
+func LegacyPath() (string, error) {
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, legacyFileName), nil
+}
+
+func homeDir() (string, error) {
+	if home, err := os.UserHomeDir(); err == nil {
+		return home, nil
+	}
+
+	user, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("finding the home directory: %w", err)
+	}
+	if user.HomeDir == "" {
+		return "", fmt.Errorf("finding the home directory: user %s has none", user.Username)
+	}
+
+	return user.HomeDir, nil
+}
+
+func dataHome() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".local", "share"), nil
+}
+
+// MigrateLegacy moves the database found at 'from' to 'to'. The move is
+// done while holding a lock file next to 'to', waiting for another process
+// holding it to finish, and the original file is kept as a '.bak' copy. It
+// reports whether a migration happened.
+func MigrateLegacy(from, to string) (bool, error) {
+	if _, err := os.Stat(from); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+		return false, err
+	}
+
+	unlock, err := lockFile(to+".lock", lockTimeout)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	// another process may have migrated while we waited for the lock
+	if _, err := os.Stat(to); err == nil {
+		return false, nil
+	}
+
+	if err := copyFile(from, to); err != nil {
+		return false, err
+	}
+
+	if err := os.Rename(from, from+".bak"); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// lockFile creates the lock file 'path', retrying for up to 'timeout'
+// while another process holds it, and returns the function removing it
+func lockFile(path string, timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("database migration still in progress after %s (remove %s if stale)", timeout, path)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// copyFile copies 'src' into a temporary file beside 'dst' and renames it
+// into place, so 'dst' is never left partially written
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
@@ -0,0 +1,125 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imgabe/todo/pkg/store"
+)
+
+func TestDefaultPath(t *testing.T) {
+	old := os.Getenv("XDG_DATA_HOME")
+	defer os.Setenv("XDG_DATA_HOME", old)
+	os.Setenv("XDG_DATA_HOME", "/tmp/xdg")
+
+	want := filepath.Join("/tmp/xdg", "todo", "todo.db")
+	if got, err := store.DefaultPath(); err != nil || got != want {
+		t.Errorf("DefaultPath() = %v, %v, want %v", got, err, want)
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	tests := []struct {
+		name       string
+		legacy     bool
+		existing   bool
+		want       bool
+		wantData   string
+		wantBackup bool
+	}{
+		{
+			name:       "Move legacy database",
+			legacy:     true,
+			want:       true,
+			wantData:   "legacy",
+			wantBackup: true,
+		},
+		{
+			name:   "No legacy database",
+			legacy: false,
+			want:   false,
+		},
+		{
+			name:     "Keep existing database",
+			legacy:   true,
+			existing: true,
+			want:     false,
+			wantData: "existing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			from := filepath.Join(dir, "database.todo")
+			to := filepath.Join(dir, "data", "todo", "todo.db")
+
+			if tt.legacy {
+				writeFile(t, from, "legacy")
+			}
+			if tt.existing {
+				writeFile(t, to, "existing")
+			}
+
+			got, err := store.MigrateLegacy(from, to)
+			if err != nil {
+				t.Fatalf("MigrateLegacy() error = %+v", err)
+			}
+			if got != tt.want {
+				t.Errorf("MigrateLegacy() = %+v, want %+v", got, tt.want)
+			}
+
+			if tt.wantData != "" {
+				data, err := os.ReadFile(to)
+				if err != nil {
+					t.Fatalf("ReadFile() error = %+v", err)
+				}
+				if string(data) != tt.wantData {
+					t.Errorf("database content = %q, want %q", data, tt.wantData)
+				}
+			}
+
+			if _, err := os.Stat(from + ".bak"); (err == nil) != tt.wantBackup {
+				t.Errorf("backup exists = %+v, want %+v", err == nil, tt.wantBackup)
+			}
+			if _, err := os.Stat(to + ".lock"); err == nil {
+				t.Errorf("lock file was left behind")
+			}
+		})
+	}
+}
+
+func TestMigrateLegacy_WaitsForLock(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "database.todo")
+	to := filepath.Join(dir, "data", "todo", "todo.db")
+	writeFile(t, from, "legacy")
+
+	// another process is migrating, and is done shortly
+	writeFile(t, to+".lock", "")
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		os.WriteFile(to, []byte("migrated"), 0600)
+		os.Remove(to + ".lock")
+	}()
+
+	got, err := store.MigrateLegacy(from, to)
+	if err != nil || got {
+		t.Errorf("MigrateLegacy() = %+v, %+v, want false and the other migration kept", got, err)
+	}
+	if data, _ := os.ReadFile(to); string(data) != "migrated" {
+		t.Errorf("database content = %q, want %q", data, "migrated")
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// ShareStore is responsible for all database actions related to sharing
+// a user's tasks with other users
+type ShareStore struct {
+	DB *sqlx.DB
+}
+
+// Upsert shares the tasks of the owner, replacing a previous permission
+func (s ShareStore) Upsert(share models.Share) error {
+	stmt := `
+		INSERT INTO share (owner_id, user_id, permission)
+		VALUES (:owner_id, :user_id, :permission)
+		ON CONFLICT (owner_id, user_id) DO UPDATE SET permission = excluded.permission
+	`
+
+	if _, ok := models.ParsePermission(string(share.Permission)); !ok {
+		return ValidationError{Field: "permission", Message: "must be 'read' or 'write'"}
+	}
+	if share.OwnerID == share.UserID {
+		return ValidationError{Field: "user", Message: "tasks cannot be shared with their owner"}
+	}
+
+	_, err := s.DB.NamedExec(stmt, &share)
+	return translate(err)
+}
+
+// Delete stops sharing the tasks of 'ownerID' with 'userID'
+func (s ShareStore) Delete(ownerID, userID int64) error {
+	stmt := `
+		DELETE FROM share
+		WHERE owner_id = $1 AND user_id = $2
+	`
+
+	result, err := s.DB.Exec(stmt, ownerID, userID)
+	if err != nil {
+		return translate(err)
+	}
+
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// SelectAll retrieves the shares granted by 'ownerID'
+func (s ShareStore) SelectAll(ownerID int64) ([]models.Share, error) {
+	stmt := `
+		SELECT *
+		FROM share
+		WHERE owner_id = $1
+		ORDER BY user_id
+	`
+
+	var shares []models.Share
+
+	err := s.DB.Select(&shares, stmt, ownerID)
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return shares, nil
+}
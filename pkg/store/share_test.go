@@ -0,0 +1,75 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+)
+
+func TestTaskStore_Access(t *testing.T) {
+	tests := []struct {
+		name       string
+		share      models.Permission
+		assign     bool
+		wantRead   bool
+		wantWrite  bool
+		wantDelete bool
+	}{
+		{name: "Not shared", wantRead: false, wantWrite: false, wantDelete: false},
+		{name: "Assigned", assign: true, wantRead: true, wantWrite: true, wantDelete: false},
+		{name: "Shared read", share: models.PermissionRead, wantRead: true, wantWrite: false, wantDelete: false},
+		{name: "Shared write", share: models.PermissionWrite, wantRead: true, wantWrite: true, wantDelete: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := mustOpenDatabase(databasePath)
+			users := store.UserStore{DB: db}
+			shares := store.ShareStore{DB: db}
+
+			alice, _ := users.Insert("alice", "secret")
+			bob, _ := users.Insert("bob", "secret")
+			owner := store.TaskStore{DB: db}.ForOwner(alice.ID)
+			other := store.TaskStore{DB: db}.ForOwner(bob.ID)
+
+			task, err := owner.Insert(models.Task{Description: "Alice Task"})
+			if err != nil {
+				t.Fatalf("TaskStore.Insert() error = %+v", err)
+			}
+
+			if tt.assign {
+				if _, err := owner.Assign(task.ID, bob.ID); err != nil {
+					t.Fatalf("TaskStore.Assign() error = %+v", err)
+				}
+			}
+			if tt.share != "" {
+				if err := shares.Upsert(models.Share{OwnerID: alice.ID, UserID: bob.ID, Permission: tt.share}); err != nil {
+					t.Fatalf("ShareStore.Upsert() error = %+v", err)
+				}
+			}
+
+			_, err = other.Select(task)
+			if got := err == nil; got != tt.wantRead {
+				t.Errorf("TaskStore.Select() error = %+v, want read %+v", err, tt.wantRead)
+			}
+
+			_, err = other.SelectShared(alice.ID, true, models.Page{})
+			if got := err == nil; got != (tt.share != "") {
+				t.Errorf("TaskStore.SelectShared() error = %+v", err)
+			}
+
+			err = other.Check(task.ID)
+			if got := err == nil; got != tt.wantWrite {
+				t.Errorf("TaskStore.Check() error = %+v, want write %+v", err, tt.wantWrite)
+			}
+
+			err = other.Delete(task.ID)
+			if got := err == nil; got != tt.wantDelete {
+				t.Errorf("TaskStore.Delete() error = %+v, want delete %+v", err, tt.wantDelete)
+			}
+			if err != nil && err != store.ErrNotFound {
+				t.Errorf("TaskStore.Delete() error = %+v", err)
+			}
+		})
+	}
+}
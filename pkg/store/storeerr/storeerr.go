@@ -0,0 +1,32 @@
+package storeerr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// the errors returned by the stores live apart from them, so that packages
+// telling them apart, like the client, do not depend on the database driver
+var (
+	// ErrNotFound is returned when a record does not exist or cannot be
+	// reached by the store's user
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a record clashes with an existing one
+	ErrConflict = errors.New("conflict")
+	// ErrStale is returned when a record was changed since the version a
+	// write was based on
+	ErrStale = errors.New("changed since it was read")
+	// ErrInvalidCredentials is returned when a name and password do not match
+	ErrInvalidCredentials = errors.New("invalid name or password")
+)
+
+// ValidationError is returned when a record is rejected before reaching
+// the database
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Message)
+}
@@ -0,0 +1,62 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Fixture is a database holding the users 'alice' and 'bob', both with the
+// password 'secret', and tokens for alice with every scope and with only
+// the read scope
+type Fixture struct {
+	DB     *sqlx.DB
+	Alice  models.User
+	Bob    models.User
+	Admin  string
+	Reader string
+}
+
+// Open returns an empty in-memory database, closed when the test ends
+func Open(t testing.TB) *sqlx.DB {
+	t.Helper()
+
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	// every connection would open a database of its own
+	db.SetMaxOpenConns(1)
+	if err := store.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// New returns a Fixture in an in-memory database, closed when the test ends
+func New(t testing.TB) Fixture {
+	t.Helper()
+
+	f := Fixture{DB: Open(t)}
+	us := store.UserStore{DB: f.DB}
+	tks := store.TokenStore{DB: f.DB}
+
+	var err error
+	if f.Alice, err = us.Insert("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if f.Bob, err = us.Insert("bob", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if f.Admin, _, err = tks.Create(models.Token{Name: "admin", Scopes: "admin", UserID: &f.Alice.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if f.Reader, _, err = tks.Create(models.Token{Name: "reader", Scopes: "read", UserID: &f.Alice.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
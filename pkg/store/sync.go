@@ -0,0 +1,702 @@
+package store
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/logging"
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// SyncStore exchanges the changes made to the tasks of OwnerID with other
+// databases, zero standing for the tasks of the local CLI like in
+// TaskStore. Changes are numbered by a sequence shared by every task of
+// the database, so the changes made since a sync are the ones numbered
+// above the sequence value read by that sync. Tasks changed by a merge are
+// published to Events when it is set, and operations logged to Log like in
+// TaskStore.
+type SyncStore struct {
+	DB      *sqlx.DB
+	OwnerID int64
+	Events  events.Publisher
+	Log     *logging.Logger
+}
+
+// ForOwner returns a copy of the store limited to the tasks of 'ownerID'
+func (s SyncStore) ForOwner(ownerID int64) SyncStore {
+	s.OwnerID = ownerID
+	return s
+}
+
+// WithLogger returns a copy of the store logging to 'l', such as the
+// logger of the request it serves
+func (s SyncStore) WithLogger(l *logging.Logger) SyncStore {
+	s.Log = l
+	return s
+}
+
+func (s SyncStore) log() *logging.Logger {
+	return storeLogger(s.Log, "sync", s.OwnerID)
+}
+
+// owner returns the value compared with the 'owner_id' column
+func (s SyncStore) owner() *int64 {
+	if s.OwnerID == 0 {
+		return nil
+	}
+
+	ownerID := s.OwnerID
+	return &ownerID
+}
+
+// syncedTask is a task with its sync metadata
+type syncedTask struct {
+	models.TaskChange
+	TaskID         int64 `db:"task_id"`
+	DescriptionSeq int64 `db:"description_seq"`
+	DoneSeq        int64 `db:"done_seq"`
+}
+
+// tombstone remembers a deleted task
+type tombstone struct {
+	UUID      string `db:"uuid"`
+	DeletedAt int64  `db:"deleted_at"`
+	Clock     string `db:"clock"`
+	ChangeSeq int64  `db:"change_seq"`
+}
+
+// Changes returns the state of the tasks changed since the sequence value
+// 'since', deleted ones included, along with the sequence value to pass as
+// 'since' on the next call. With a positive 'limit', at most that many
+// changes are returned, the next call returning the following ones.
+func (s SyncStore) Changes(since int64, limit int) (_ []models.TaskChange, _ int64, err error) {
+	defer logged(s.log(), "changes", time.Now(), &err)
+	stmt := `
+		SELECT uuid, description, done, description_updated_at, done_updated_at,
+			description_clock, done_clock, description_changed, done_changed, deleted, deleted_at, deleted_clock,
+			change_seq
+		FROM (
+			SELECT s.uuid, t.description, t.done, s.description_updated_at, s.done_updated_at,
+				s.description_clock, s.done_clock,
+				s.description_seq > $1 AS description_changed, s.done_seq > $1 AS done_changed,
+				0 AS deleted, 0 AS deleted_at, '' AS deleted_clock, s.change_seq
+			FROM task_sync s
+			JOIN task t ON t.id = s.task_id
+			WHERE t.owner_id IS $2 AND s.change_seq > $1
+			UNION ALL
+			SELECT uuid, '', 0, 0, 0, '', '', 0, 0, 1, deleted_at, clock, change_seq
+			FROM task_tombstone
+			WHERE owner_id IS $2 AND change_seq > $1
+		)
+		ORDER BY change_seq
+		LIMIT $3
+	`
+
+	// a negative limit returns every row
+	if limit <= 0 {
+		limit = -1
+	}
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return nil, 0, translate(err)
+	}
+	defer tx.Rollback()
+
+	cursor, err := sequence(tx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var rows []struct {
+		models.TaskChange
+		ChangeSeq int64 `db:"change_seq"`
+	}
+	err = tx.Select(&rows, stmt, since, s.owner(), limit)
+	if err != nil {
+		return nil, 0, translate(err)
+	}
+
+	changes := make([]models.TaskChange, len(rows))
+	for i, row := range rows {
+		changes[i] = row.TaskChange
+	}
+	// the changes left out are the ones numbered after the last returned
+	if len(rows) == limit {
+		cursor = rows[len(rows)-1].ChangeSeq
+	}
+
+	return changes, cursor, translate(tx.Commit())
+}
+
+// Merge applies changes received from another database which last synced
+// with this one at the sequence value 'since'. Tasks changed on both sides
+// are merged with 'strategy', and fields changed on both sides since the
+// last sync are reported as conflicts. A task deleted on one side and
+// changed on the other is kept if the change is later than the deletion,
+// as ordered by the clocks, which is reported as a conflict too. When the
+// database keeps a newer state than the one received, the task is numbered
+// as changed again, so that the other database gets it on its next sync.
+func (s SyncStore) Merge(changes []models.TaskChange, since int64, strategy models.MergeStrategy) (_ models.MergeResult, err error) {
+	defer logged(s.log(), "merge", time.Now(), &err)
+	var result models.MergeResult
+	var published []events.Event
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return result, translate(err)
+	}
+	defer tx.Rollback()
+
+	if result.Before, err = sequence(tx); err != nil {
+		return result, err
+	}
+	if err := observe(tx, changes); err != nil {
+		return result, err
+	}
+
+	for _, change := range changes {
+		event, conflicts, err := s.mergeOne(tx, change, since, strategy)
+		if err != nil {
+			return models.MergeResult{}, err
+		}
+		if event != nil {
+			result.Applied++
+			published = append(published, *event)
+		}
+		result.Conflicts = append(result.Conflicts, conflicts...)
+	}
+
+	if result.After, err = sequence(tx); err != nil {
+		return result, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.MergeResult{}, translate(err)
+	}
+
+	if s.Events != nil {
+		for _, event := range published {
+			s.Events.Publish(event)
+		}
+	}
+
+	return result, nil
+}
+
+// mergeOne applies a single change, returning the event describing the
+// change made to the database if any
+func (s SyncStore) mergeOne(tx *sqlx.Tx, change models.TaskChange, since int64, strategy models.MergeStrategy) (*events.Event, []models.SyncConflict, error) {
+	selectStmt := `
+		SELECT s.task_id, s.uuid, t.description, t.done, s.description_updated_at, s.done_updated_at,
+			s.description_clock, s.done_clock, s.description_seq, s.done_seq
+		FROM task_sync s
+		JOIN task t ON t.id = s.task_id
+		WHERE s.uuid = $1 AND t.owner_id IS $2
+	`
+
+	tombstoneStmt := `
+		SELECT uuid, deleted_at, clock, change_seq
+		FROM task_tombstone
+		WHERE uuid = $1 AND owner_id IS $2
+	`
+
+	var ours syncedTask
+	err := tx.Get(&ours, selectStmt, change.UUID, s.owner())
+	if err != nil && translate(err) != ErrNotFound {
+		return nil, nil, translate(err)
+	}
+	found := err == nil
+
+	if !found {
+		var deleted tombstone
+		err := tx.Get(&deleted, tombstoneStmt, change.UUID, s.owner())
+		if err != nil && translate(err) != ErrNotFound {
+			return nil, nil, translate(err)
+		}
+		if err == nil {
+			return s.undelete(tx, deleted, change, since)
+		}
+	}
+
+	switch {
+	case !found && change.Deleted:
+		return nil, nil, s.bury(tx, change)
+	case !found:
+		return s.insert(tx, change)
+	case change.Deleted:
+		return s.delete(tx, ours, change, since)
+	}
+
+	return s.update(tx, ours, change, since, strategy)
+}
+
+// undelete handles a change to a task deleted here, which comes back when
+// it was changed after it was deleted, and stays deleted otherwise
+func (s SyncStore) undelete(tx *sqlx.Tx, deleted tombstone, change models.TaskChange, since int64) (*events.Event, []models.SyncConflict, error) {
+	if change.Deleted {
+		return nil, nil, nil
+	}
+
+	// whichever of the deletion and the change was last wins, as for the
+	// fields of a task, and a tie keeps the task
+	restored := later(change.Clock(), deleted.Clock, change.UpdatedAt(), deleted.DeletedAt, true)
+
+	var conflicts []models.SyncConflict
+	if deleted.ChangeSeq > since && (change.DescriptionChanged || change.DoneChanged) {
+		c := models.SyncConflict{
+			UUID:        change.UUID,
+			Description: change.Description,
+			Field:       "deleted",
+			Ours:        "deleted",
+			Theirs:      "changed",
+			Kept:        "ours",
+		}
+		if restored {
+			c.Kept = "theirs"
+		}
+		conflicts = append(conflicts, c)
+	}
+
+	if restored {
+		_, err := tx.Exec(`DELETE FROM task_tombstone WHERE uuid = $1`, deleted.UUID)
+		if err != nil {
+			return nil, nil, translate(err)
+		}
+
+		event, _, err := s.insert(tx, change)
+		return event, conflicts, err
+	}
+
+	// the other database still has the task
+	seq, err := bump(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = tx.Exec(`UPDATE task_tombstone SET change_seq = $1 WHERE uuid = $2`, seq, deleted.UUID)
+	if err != nil {
+		return nil, nil, translate(err)
+	}
+
+	return nil, conflicts, nil
+}
+
+// bury remembers a task deleted elsewhere and never seen here
+func (s SyncStore) bury(tx *sqlx.Tx, change models.TaskChange) error {
+	stmt := `
+		INSERT INTO task_tombstone (uuid, owner_id, deleted_at, clock, change_seq)
+		SELECT $1, $2, $3, $4, value
+		FROM sync_sequence
+	`
+
+	_, err := tx.Exec(stmt, change.UUID, s.owner(), change.DeletedAt, change.DeletedClock)
+	return translate(err)
+}
+
+// insert creates a task created elsewhere
+func (s SyncStore) insert(tx *sqlx.Tx, change models.TaskChange) (*events.Event, []models.SyncConflict, error) {
+	insertStmt := `
+		INSERT INTO task (description, done, owner_id)
+		VALUES ($1, $2, $3)
+	`
+
+	result, err := tx.Exec(insertStmt, change.Description, change.Done, s.owner())
+	if err != nil {
+		return nil, nil, translate(err)
+	}
+
+	taskID, _ := result.LastInsertId()
+	if err := stamp(tx, taskID, change); err != nil {
+		return nil, nil, err
+	}
+	_, err = tx.Exec(`UPDATE task_sync SET uuid = $1 WHERE task_id = $2`, change.UUID, taskID)
+	if err != nil {
+		return nil, nil, translate(err)
+	}
+
+	event, err := taskEvent(tx, events.TaskCreated, taskID)
+	return event, nil, err
+}
+
+// delete deletes a task deleted elsewhere, unless it was changed here
+// after it was deleted there
+func (s SyncStore) delete(tx *sqlx.Tx, ours syncedTask, change models.TaskChange, since int64) (*events.Event, []models.SyncConflict, error) {
+	kept := !later(change.DeletedClock, ours.Clock(), change.DeletedAt, ours.UpdatedAt(), false)
+
+	var conflicts []models.SyncConflict
+	if ours.DescriptionSeq > since || ours.DoneSeq > since {
+		c := models.SyncConflict{
+			UUID:        ours.UUID,
+			Description: ours.Description,
+			Field:       "deleted",
+			Ours:        "changed",
+			Theirs:      "deleted",
+			Kept:        "theirs",
+		}
+		if kept {
+			c.Kept = "ours"
+		}
+		conflicts = append(conflicts, c)
+	}
+
+	if kept {
+		// the other database does not have the task anymore
+		seq, err := bump(tx)
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = tx.Exec(`UPDATE task_sync SET change_seq = $1 WHERE task_id = $2`, seq, ours.TaskID)
+		if err != nil {
+			return nil, nil, translate(err)
+		}
+
+		return nil, conflicts, nil
+	}
+
+	event, err := taskEvent(tx, events.TaskDeleted, ours.TaskID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM task WHERE id = $1`, ours.TaskID)
+	if err != nil {
+		return nil, nil, translate(err)
+	}
+	_, err = tx.Exec(`UPDATE task_tombstone SET deleted_at = $1, clock = $2 WHERE uuid = $3`, change.DeletedAt, change.DeletedClock, ours.UUID)
+	if err != nil {
+		return nil, nil, translate(err)
+	}
+
+	return event, conflicts, nil
+}
+
+// update merges a change into a task existing on both sides
+func (s SyncStore) update(tx *sqlx.Tx, ours syncedTask, change models.TaskChange, since int64, strategy models.MergeStrategy) (*events.Event, []models.SyncConflict, error) {
+	merged := merge(ours.TaskChange, change, strategy)
+
+	// a field is in conflict when the side losing it had changed it, and
+	// the winning side had changed it too, or the task with the last
+	// writer strategy
+	oursChanged := ours.DescriptionSeq > since || ours.DoneSeq > since
+	theirsChanged := change.DescriptionChanged || change.DoneChanged
+	lost := func(keptOurs, oursField, theirsField bool) bool {
+		loser, winner, winnerTask := oursField, theirsField, theirsChanged
+		if keptOurs {
+			loser, winner, winnerTask = theirsField, oursField, oursChanged
+		}
+		if strategy == models.MergeLastWriter {
+			winner = winnerTask
+		}
+
+		return loser && winner
+	}
+
+	var conflicts []models.SyncConflict
+	if ours.Description != change.Description && lost(merged.Description == ours.Description, ours.DescriptionSeq > since, change.DescriptionChanged) {
+		conflicts = append(conflicts, conflict(ours.TaskChange, "description", ours.Description, change.Description, merged.Description))
+	}
+	if ours.Done != change.Done && lost(merged.Done == ours.Done, ours.DoneSeq > since, change.DoneChanged) {
+		conflicts = append(conflicts, conflict(ours.TaskChange, "done", strconv.FormatBool(ours.Done), strconv.FormatBool(change.Done), strconv.FormatBool(merged.Done)))
+	}
+
+	var event *events.Event
+	if merged.Description != ours.Description || merged.Done != ours.Done {
+		stmt := `
+			UPDATE task
+			SET description = $1,
+				done = $2,
+				version = version + 1
+			WHERE id = $3
+		`
+
+		_, err := tx.Exec(stmt, merged.Description, merged.Done, ours.TaskID)
+		if err != nil {
+			return nil, nil, translate(err)
+		}
+		if event, err = taskEvent(tx, events.TaskUpdated, ours.TaskID); err != nil {
+			return nil, nil, err
+		}
+	}
+	if !sameState(merged, ours.TaskChange) {
+		if err := stamp(tx, ours.TaskID, merged); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// the other database does not have the merged task yet
+	if !sameState(merged, change) {
+		seq, err := bump(tx)
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = tx.Exec(`UPDATE task_sync SET change_seq = $1 WHERE task_id = $2`, seq, ours.TaskID)
+		if err != nil {
+			return nil, nil, translate(err)
+		}
+	}
+
+	return event, conflicts, nil
+}
+
+// merge returns the task resulting from merging 'theirs' into 'ours'. The
+// side changed last wins, as ordered by the clocks of the changes, so that
+// both sides of a sync merge to the same task.
+func merge(ours, theirs models.TaskChange, strategy models.MergeStrategy) models.TaskChange {
+	if strategy == models.MergeLastWriter {
+		tie := theirs.Description > ours.Description ||
+			(theirs.Description == ours.Description && theirs.Done && !ours.Done)
+		if later(theirs.Clock(), ours.Clock(), theirs.UpdatedAt(), ours.UpdatedAt(), tie) {
+			return theirs
+		}
+
+		return ours
+	}
+
+	merged := ours
+	if later(theirs.DescriptionClock, ours.DescriptionClock, theirs.DescriptionUpdatedAt, ours.DescriptionUpdatedAt, theirs.Description > ours.Description) {
+		merged.Description = theirs.Description
+		merged.DescriptionUpdatedAt = theirs.DescriptionUpdatedAt
+		merged.DescriptionClock = theirs.DescriptionClock
+	}
+	if later(theirs.DoneClock, ours.DoneClock, theirs.DoneUpdatedAt, ours.DoneUpdatedAt, theirs.Done && !ours.Done) {
+		merged.Done = theirs.Done
+		merged.DoneUpdatedAt = theirs.DoneUpdatedAt
+		merged.DoneClock = theirs.DoneClock
+	}
+
+	return merged
+}
+
+// later tells whether a value changed at clock 'theirs' replaces one
+// changed at clock 'ours'. Changes without clocks, sent by older clients,
+// are ordered by their times, 'tie' deciding between simultaneous ones.
+func later(theirs, ours string, theirsAt, oursAt int64, tie bool) bool {
+	if theirs != "" && ours != "" && theirs != ours {
+		return models.CompareClocks(theirs, ours) > 0
+	}
+	if theirsAt != oursAt {
+		return theirsAt > oursAt
+	}
+
+	return tie
+}
+
+// sameState reports whether two changes describe the same task
+func sameState(a, b models.TaskChange) bool {
+	return a.Description == b.Description && a.Done == b.Done &&
+		a.DescriptionUpdatedAt == b.DescriptionUpdatedAt && a.DoneUpdatedAt == b.DoneUpdatedAt &&
+		a.DescriptionClock == b.DescriptionClock && a.DoneClock == b.DoneClock
+}
+
+func conflict(ours models.TaskChange, field, oursValue, theirsValue, kept string) models.SyncConflict {
+	c := models.SyncConflict{
+		UUID:        ours.UUID,
+		Description: ours.Description,
+		Field:       field,
+		Ours:        oursValue,
+		Theirs:      theirsValue,
+		Kept:        "ours",
+	}
+	if kept != oursValue {
+		c.Kept = "theirs"
+	}
+
+	return c
+}
+
+// stamp sets when the fields of a task were changed to the times and
+// clocks of 'change', replacing the ones set by the triggers
+func stamp(tx *sqlx.Tx, taskID int64, change models.TaskChange) error {
+	stmt := `
+		UPDATE task_sync
+		SET description_updated_at = $1,
+			done_updated_at = $2,
+			description_clock = $3,
+			done_clock = $4
+		WHERE task_id = $5
+	`
+
+	_, err := tx.Exec(stmt, change.DescriptionUpdatedAt, change.DoneUpdatedAt, change.DescriptionClock, change.DoneClock, taskID)
+	return translate(err)
+}
+
+// taskEvent describes a change made to a task for the subscribers of Events
+func taskEvent(tx *sqlx.Tx, t events.Type, taskID int64) (*events.Event, error) {
+	var task models.Task
+	err := tx.Get(&task, `SELECT * FROM task WHERE id = $1`, taskID)
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return &events.Event{Type: t, Task: task}, nil
+}
+
+// observe moves the clock of the database past the clocks of 'changes',
+// so that the changes made after a merge are ordered after the merged ones
+func observe(tx *sqlx.Tx, changes []models.TaskChange) error {
+	var received string
+	for _, change := range changes {
+		if clock := change.Clock(); models.CompareClocks(clock, received) > 0 {
+			received = clock
+		}
+	}
+
+	wall, counter, _, ok := models.ParseClock(received)
+	if !ok {
+		return nil
+	}
+
+	var clock struct {
+		Wall    int64 `db:"wall"`
+		Counter int64 `db:"counter"`
+	}
+	err := tx.Get(&clock, `SELECT wall, counter FROM sync_clock`)
+	if err != nil {
+		return translate(err)
+	}
+
+	next := time.Now().UnixMilli()
+	if clock.Wall > next {
+		next = clock.Wall
+	}
+	if wall > next {
+		next = wall
+	}
+
+	switch {
+	case next == clock.Wall && next == wall:
+		if counter < clock.Counter {
+			counter = clock.Counter
+		}
+		counter++
+	case next == clock.Wall:
+		counter = clock.Counter + 1
+	case next == wall:
+		counter++
+	default:
+		counter = 0
+	}
+
+	_, err = tx.Exec(`UPDATE sync_clock SET wall = $1, counter = $2`, next, counter)
+	return translate(err)
+}
+
+// sequence returns the number of the last change made to the database
+func sequence(tx *sqlx.Tx) (int64, error) {
+	var value int64
+	err := tx.Get(&value, `SELECT value FROM sync_sequence`)
+
+	return value, translate(err)
+}
+
+// bump numbers a new change
+func bump(tx *sqlx.Tx) (int64, error) {
+	_, err := tx.Exec(`UPDATE sync_sequence SET value = value + 1`)
+	if err != nil {
+		return 0, translate(err)
+	}
+
+	return sequence(tx)
+}
+
+// State returns where the sync with 'remote' stands, at the start when
+// it never happened
+func (s SyncStore) State(remote string) (_ models.SyncState, err error) {
+	defer logged(s.log(), "state", time.Now(), &err)
+	stmt := `
+		SELECT *
+		FROM sync_state
+		WHERE remote = $1 AND owner_id = $2
+	`
+
+	var state models.SyncState
+	err = s.DB.Get(&state, stmt, remote, s.OwnerID)
+	if err != nil {
+		if err := translate(err); err != ErrNotFound {
+			return state, err
+		}
+		return models.SyncState{Remote: remote, OwnerID: s.OwnerID}, nil
+	}
+
+	return state, nil
+}
+
+// SaveState records where the sync with 'state.Remote' stands
+func (s SyncStore) SaveState(state models.SyncState) (err error) {
+	defer logged(s.log(), "save_state", time.Now(), &err)
+	stmt := `
+		INSERT OR REPLACE INTO sync_state (remote, owner_id, cursor, pushed)
+		VALUES (:remote, :owner_id, :cursor, :pushed)
+	`
+
+	state.OwnerID = s.OwnerID
+	_, err = s.DB.NamedExec(stmt, &state)
+	return translate(err)
+}
+
+// PeerResult sums up a sync between two databases
+type PeerResult struct {
+	// Applied and PeerApplied are how many tasks were created, changed or
+	// deleted in the database syncing and in its peer
+	Applied     int
+	PeerApplied int
+	// Conflicts lists the fields changed on both sides, 'Ours' being the
+	// value of the peer
+	Conflicts []models.SyncConflict
+}
+
+// SyncPeer merges the changes made to the tasks of two databases both ways,
+// without a server in between. Each database keeps where the sync with the
+// other stands, 'name' and 'peerName' identifying them. Fields take the
+// value of their last change as ordered by the clocks, and so does whether
+// a task exists: a deletion wins over the changes it is later than, while a
+// task changed on one side after it was deleted on the other comes back.
+// Both databases thus end up with the same tasks whichever side runs the
+// sync.
+func (s SyncStore) SyncPeer(peer SyncStore, name, peerName string, strategy models.MergeStrategy) (_ PeerResult, err error) {
+	defer logged(s.log(), "sync_peer", time.Now(), &err)
+	state, err := s.State(peerName)
+	if err != nil {
+		return PeerResult{}, err
+	}
+
+	ours, seq, err := s.Changes(state.Pushed, 0)
+	if err != nil {
+		return PeerResult{}, err
+	}
+	theirs, peerSeq, err := peer.Changes(state.Cursor, 0)
+	if err != nil {
+		return PeerResult{}, err
+	}
+
+	pushed, err := peer.Merge(ours, state.Cursor, strategy)
+	if err != nil {
+		return PeerResult{}, err
+	}
+	pulled, err := s.Merge(theirs, seq, strategy)
+	if err != nil {
+		return PeerResult{}, err
+	}
+
+	// the changes made by the merges are already on the other side, unless
+	// others were made in the meantime
+	state.Pushed, state.Cursor = seq, peerSeq
+	if pulled.Before == seq {
+		state.Pushed = pulled.After
+	}
+	if pushed.Before == peerSeq {
+		state.Cursor = pushed.After
+	}
+	if err := s.SaveState(state); err != nil {
+		return PeerResult{}, err
+	}
+
+	mirror := models.SyncState{Remote: name, Cursor: state.Pushed, Pushed: state.Cursor}
+	if err := peer.SaveState(mirror); err != nil {
+		return PeerResult{}, err
+	}
+
+	return PeerResult{Applied: pulled.Applied, PeerApplied: pushed.Applied, Conflicts: pushed.Conflicts}, nil
+}
@@ -0,0 +1,565 @@
+package store_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+	"github.com/imgabe/todo/pkg/store/storetest"
+	"github.com/jmoiron/sqlx"
+)
+
+// syncDatabase opens an in-memory database whose tasks belong to 'ownerID'
+func syncDatabase(t *testing.T, ownerID int64) (store.TaskStore, store.SyncStore) {
+	t.Helper()
+
+	db := storetest.Open(t)
+
+	if ownerID != 0 {
+		if _, err := (store.UserStore{DB: db}).Insert("alice", "secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return store.TaskStore{DB: db, OwnerID: ownerID}, store.SyncStore{DB: db, OwnerID: ownerID}
+}
+
+// syncStores syncs 'local' with 'remote' the way 'todo sync' does with a
+// server, returning the conflicts found by the remote
+func syncStores(t *testing.T, local, remote store.SyncStore, strategy models.MergeStrategy) []models.SyncConflict {
+	t.Helper()
+
+	state, err := local.State("remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, seq, err := local.Changes(state.Pushed, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushed, err := remote.Merge(changes, state.Cursor, strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received, cursor, err := remote.Changes(state.Cursor, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pulled, err := local.Merge(received, seq, strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state.Cursor, state.Pushed = cursor, seq
+	if pulled.Before == seq {
+		state.Pushed = pulled.After
+	}
+	if err := local.SaveState(state); err != nil {
+		t.Fatal(err)
+	}
+
+	return pushed.Conflicts
+}
+
+// contents returns the description and state of every task of a store
+func contents(t *testing.T, ts store.TaskStore) []models.Task {
+	t.Helper()
+
+	tasks, err := ts.SelectAll(true, models.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []models.Task{}
+	for _, task := range tasks {
+		got = append(got, models.Task{Description: task.Description, Done: task.Done})
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].Description < got[j].Description })
+
+	return got
+}
+
+func TestSyncStore_Changes(t *testing.T) {
+	ts, ss := syncDatabase(t, 0)
+
+	first, _ := ts.Insert(models.Task{Description: "Task 1"})
+	second, _ := ts.Insert(models.Task{Description: "Task 2"})
+
+	changes, cursor, err := ss.Changes(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || cursor != 2 {
+		t.Fatalf("Changes(0) = %+v, %d, want 2 changes up to 2", changes, cursor)
+	}
+	if !changes[0].DescriptionChanged || !changes[0].DoneChanged || changes[0].UUID == changes[1].UUID {
+		t.Errorf("Changes(0) = %+v, want new tasks with distinct uuids", changes)
+	}
+
+	if err := ts.Check(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Delete(second.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, cursor, err = ss.Changes(cursor, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) == 2 && models.CompareClocks(changes[1].DeletedClock, changes[0].DoneClock) <= 0 {
+		t.Errorf("deletion clock %q, want it after the check at %q", changes[1].DeletedClock, changes[0].DoneClock)
+	}
+
+	want := []models.TaskChange{
+		{Description: "Task 1", Done: true, DoneChanged: true},
+		{Deleted: true},
+	}
+	for i := range changes {
+		changes[i].UUID = ""
+		changes[i].DescriptionUpdatedAt, changes[i].DoneUpdatedAt, changes[i].DeletedAt = 0, 0, 0
+		changes[i].DescriptionClock, changes[i].DoneClock, changes[i].DeletedClock = "", "", ""
+	}
+	if !reflect.DeepEqual(changes, want) || cursor != 4 {
+		t.Errorf("Changes(2) = %+v, %d, want %+v up to 4", changes, cursor, want)
+	}
+
+	if changes, _, _ := ss.Changes(cursor, 0); len(changes) != 0 {
+		t.Errorf("Changes(%d) = %+v, want none", cursor, changes)
+	}
+	if changes, _, _ := ss.ForOwner(1).Changes(0, 0); len(changes) != 0 {
+		t.Errorf("Changes(0) of another owner = %+v, want none", changes)
+	}
+}
+
+func TestSyncStore_Changes_Limit(t *testing.T) {
+	ts, ss := syncDatabase(t, 0)
+
+	for _, description := range []string{"Task 1", "Task 2", "Task 3"} {
+		if _, err := ts.Insert(models.Task{Description: description}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	var cursors []int64
+	for cursor := int64(0); ; {
+		changes, next, err := ss.Changes(cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) == 0 {
+			break
+		}
+		for _, change := range changes {
+			got = append(got, change.Description)
+		}
+		cursor = next
+		cursors = append(cursors, cursor)
+	}
+
+	if want := []string{"Task 1", "Task 2", "Task 3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Changes() with limit 2 = %v, want %v", got, want)
+	}
+	if want := []int64{2, 3}; !reflect.DeepEqual(cursors, want) {
+		t.Errorf("Changes() with limit 2 cursors = %v, want %v", cursors, want)
+	}
+}
+
+func TestSyncStore_Merge(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy models.MergeStrategy
+		// change edits the task 'Task' synced on both sides, the laptop
+		// first
+		change    func(laptop, server store.TaskStore, id, serverID int64)
+		want      []models.Task
+		conflicts []string
+	}{
+		{
+			name:     "Nothing changed",
+			strategy: models.MergeLastWriter,
+			change:   func(laptop, server store.TaskStore, id, serverID int64) {},
+			want:     []models.Task{{Description: "Task"}},
+		},
+		{
+			name:     "Push and pull new tasks",
+			strategy: models.MergeLastWriter,
+			change: func(laptop, server store.TaskStore, id, serverID int64) {
+				laptop.Insert(models.Task{Description: "Laptop task"})
+				server.Insert(models.Task{Description: "Server task", Done: true})
+			},
+			want: []models.Task{{Description: "Laptop task"}, {Description: "Server task", Done: true}, {Description: "Task"}},
+		},
+		{
+			name:     "Fields changed on different sides by field",
+			strategy: models.MergeFields,
+			change: func(laptop, server store.TaskStore, id, serverID int64) {
+				laptop.Update(models.Task{ID: id, Description: "Laptop"})
+				time.Sleep(2 * time.Millisecond)
+				server.Check(serverID)
+			},
+			want: []models.Task{{Description: "Laptop", Done: true}},
+		},
+		{
+			name:     "Fields changed on different sides by last writer",
+			strategy: models.MergeLastWriter,
+			change: func(laptop, server store.TaskStore, id, serverID int64) {
+				laptop.Update(models.Task{ID: id, Description: "Laptop"})
+				time.Sleep(2 * time.Millisecond)
+				server.Check(serverID)
+			},
+			want:      []models.Task{{Description: "Task", Done: true}},
+			conflicts: []string{"description:ours"},
+		},
+		{
+			name:     "Field changed on both sides",
+			strategy: models.MergeFields,
+			change: func(laptop, server store.TaskStore, id, serverID int64) {
+				server.Update(models.Task{ID: serverID, Description: "Server"})
+				time.Sleep(2 * time.Millisecond)
+				laptop.Update(models.Task{ID: id, Description: "Laptop", Done: true})
+			},
+			want:      []models.Task{{Description: "Laptop", Done: true}},
+			conflicts: []string{"description:theirs"},
+		},
+		{
+			name:     "Deleted on the laptop",
+			strategy: models.MergeLastWriter,
+			change: func(laptop, server store.TaskStore, id, serverID int64) {
+				laptop.Delete(id)
+			},
+			want: []models.Task{},
+		},
+		{
+			name:     "Deleted on the laptop after changed on the server",
+			strategy: models.MergeFields,
+			change: func(laptop, server store.TaskStore, id, serverID int64) {
+				server.Check(serverID)
+				time.Sleep(2 * time.Millisecond)
+				laptop.Delete(id)
+			},
+			want:      []models.Task{},
+			conflicts: []string{"deleted:theirs"},
+		},
+		{
+			name:     "Changed on the laptop after deleted on the server",
+			strategy: models.MergeLastWriter,
+			change: func(laptop, server store.TaskStore, id, serverID int64) {
+				server.Delete(serverID)
+				time.Sleep(2 * time.Millisecond)
+				laptop.Check(id)
+			},
+			want:      []models.Task{{Description: "Task", Done: true}},
+			conflicts: []string{"deleted:theirs"},
+		},
+		{
+			name:     "Changed on the server after deleted on the laptop",
+			strategy: models.MergeFields,
+			change: func(laptop, server store.TaskStore, id, serverID int64) {
+				laptop.Delete(id)
+				time.Sleep(2 * time.Millisecond)
+				server.Check(serverID)
+			},
+			want:      []models.Task{{Description: "Task", Done: true}},
+			conflicts: []string{"deleted:ours"},
+		},
+		{
+			name:     "Deleted on the server after changed on the laptop",
+			strategy: models.MergeLastWriter,
+			change: func(laptop, server store.TaskStore, id, serverID int64) {
+				laptop.Check(id)
+				time.Sleep(2 * time.Millisecond)
+				server.Delete(serverID)
+			},
+			want:      []models.Task{},
+			conflicts: []string{"deleted:ours"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			laptop, laptopSync := syncDatabase(t, 0)
+			server, serverSync := syncDatabase(t, 1)
+
+			task, _ := laptop.Insert(models.Task{Description: "Task"})
+			syncStores(t, laptopSync, serverSync, tt.strategy)
+			serverTasks, _ := server.SelectAll(true, models.Page{})
+			if len(serverTasks) != 1 {
+				t.Fatalf("server tasks = %+v, want the laptop's", serverTasks)
+			}
+
+			time.Sleep(2 * time.Millisecond)
+			tt.change(laptop, server, task.ID, serverTasks[0].ID)
+			time.Sleep(2 * time.Millisecond)
+
+			var conflicts []string
+			for _, c := range syncStores(t, laptopSync, serverSync, tt.strategy) {
+				conflicts = append(conflicts, c.Field+":"+c.Kept)
+			}
+			if !reflect.DeepEqual(conflicts, tt.conflicts) {
+				t.Errorf("conflicts = %v, want %v", conflicts, tt.conflicts)
+			}
+
+			if got := contents(t, laptop); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("laptop tasks = %+v, want %+v", got, tt.want)
+			}
+			if got := contents(t, server); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("server tasks = %+v, want %+v", got, tt.want)
+			}
+
+			// a second sync finds nothing left to exchange
+			if conflicts := syncStores(t, laptopSync, serverSync, tt.strategy); len(conflicts) != 0 {
+				t.Errorf("second sync conflicts = %+v, want none", conflicts)
+			}
+			state, _ := laptopSync.State("remote")
+			if changes, _, _ := laptopSync.Changes(state.Pushed, 0); len(changes) != 0 {
+				t.Errorf("changes left after syncing = %+v, want none", changes)
+			}
+			if changes, _, _ := serverSync.Changes(state.Cursor, 0); len(changes) != 0 {
+				t.Errorf("server changes left after syncing = %+v, want none", changes)
+			}
+		})
+	}
+}
+
+func TestSyncStore_State(t *testing.T) {
+	_, ss := syncDatabase(t, 0)
+
+	state, err := ss.State("https://todo.example.com")
+	if err != nil || state != (models.SyncState{Remote: "https://todo.example.com"}) {
+		t.Fatalf("State() = %+v, %v, want an empty state", state, err)
+	}
+
+	want := models.SyncState{Remote: "https://todo.example.com", Cursor: 4, Pushed: 2}
+	if err := ss.SaveState(want); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ss.State(want.Remote); err != nil || got != want {
+		t.Errorf("State() = %+v, %v, want %+v", got, err, want)
+	}
+}
+
+// peerDatabase opens the database file at 'path'
+func peerDatabase(t *testing.T, path string) (store.TaskStore, store.SyncStore) {
+	t.Helper()
+
+	db := sqlx.MustOpen("sqlite3", path)
+	db.SetMaxOpenConns(1)
+	if err := store.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return store.TaskStore{DB: db}, store.SyncStore{DB: db}
+}
+
+// replica returns the state of every task of a database, deleted ones
+// included, ordered by uuid
+func replica(t *testing.T, ss store.SyncStore) []models.TaskChange {
+	t.Helper()
+
+	changes, _, err := ss.Changes(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].UUID < changes[j].UUID })
+
+	return changes
+}
+
+func TestSyncStore_SyncPeer(t *testing.T) {
+	dir := t.TempDir()
+	a, aSync := peerDatabase(t, filepath.Join(dir, "a.todo"))
+	b, bSync := peerDatabase(t, filepath.Join(dir, "b.todo"))
+
+	milk, _ := a.Insert(models.Task{Description: "Buy milk"})
+	mom, _ := a.Insert(models.Task{Description: "Call mom"})
+	result, err := aSync.SyncPeer(bSync, "a", "b", models.MergeFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (store.PeerResult{PeerApplied: 2}); !reflect.DeepEqual(result, want) {
+		t.Errorf("SyncPeer() = %+v, want %+v", result, want)
+	}
+
+	// both databases change the same tasks concurrently
+	bTasks, _ := b.SelectAll(true, models.Page{})
+	sort.Slice(bTasks, func(i, j int) bool { return bTasks[i].Description < bTasks[j].Description })
+	time.Sleep(2 * time.Millisecond)
+	a.Update(models.Task{ID: milk.ID, Description: "Buy oat milk"})
+	b.Check(bTasks[0].ID)
+	b.Delete(bTasks[1].ID)
+	time.Sleep(2 * time.Millisecond)
+	a.Update(models.Task{ID: mom.ID, Description: "Call mom back"})
+	a.Insert(models.Task{Description: "Walk the dog"})
+	b.Insert(models.Task{Description: "Read a book"})
+
+	// sync copies of both databases the other way around
+	for _, name := range []string{"a", "b"} {
+		data, err := os.ReadFile(filepath.Join(dir, name+".todo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+"2.todo"), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a2, a2Sync := peerDatabase(t, filepath.Join(dir, "a2.todo"))
+	b2, b2Sync := peerDatabase(t, filepath.Join(dir, "b2.todo"))
+
+	result, err = aSync.SyncPeer(bSync, "a", "b", models.MergeFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Conflicts) != 1 || result.Conflicts[0].Field != "deleted" || result.Conflicts[0].Kept != "theirs" {
+		t.Errorf("SyncPeer() conflicts = %+v, want the deleted task changed later kept", result.Conflicts)
+	}
+	if _, err := b2Sync.SyncPeer(a2Sync, "b", "a", models.MergeFields); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.Task{{Description: "Buy oat milk", Done: true}, {Description: "Call mom back"}, {Description: "Read a book"}, {Description: "Walk the dog"}}
+	for name, ts := range map[string]store.TaskStore{"a": a, "b": b, "a2": a2, "b2": b2} {
+		if got := contents(t, ts); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s tasks = %+v, want %+v", name, got, want)
+		}
+	}
+	for name, ss := range map[string]store.SyncStore{"b": bSync, "a2": a2Sync, "b2": b2Sync} {
+		if got, want := replica(t, ss), replica(t, aSync); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s replica = %+v, want %+v", name, got, want)
+		}
+	}
+
+	// syncing again, from either side, has nothing left to exchange
+	for _, sync := range []func() (store.PeerResult, error){
+		func() (store.PeerResult, error) { return aSync.SyncPeer(bSync, "a", "b", models.MergeFields) },
+		func() (store.PeerResult, error) { return bSync.SyncPeer(aSync, "b", "a", models.MergeFields) },
+	} {
+		result, err := sync()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Applied != 0 || result.PeerApplied != 0 || len(result.Conflicts) != 0 {
+			t.Errorf("SyncPeer() again = %+v, want nothing exchanged", result)
+		}
+	}
+}
+
+func TestSyncStore_SyncPeer_DeletedAndChanged(t *testing.T) {
+	tests := []struct {
+		name string
+		// change deletes the task 'Task' on one database and checks it on
+		// the other, in the order of the test
+		change func(deleting, checking store.TaskStore)
+		want   []models.Task
+		kept   string
+	}{
+		{
+			name: "Checked after deleted",
+			change: func(deleting, checking store.TaskStore) {
+				deleting.Delete(1)
+				time.Sleep(2 * time.Millisecond)
+				checking.Check(1)
+			},
+			want: []models.Task{{Description: "Task", Done: true}},
+			kept: "changed",
+		},
+		{
+			name: "Deleted after checked",
+			change: func(deleting, checking store.TaskStore) {
+				checking.Check(1)
+				time.Sleep(2 * time.Millisecond)
+				deleting.Delete(1)
+			},
+			want: []models.Task{},
+			kept: "deleted",
+		},
+	}
+	for _, tt := range tests {
+		for _, fromDeleting := range []bool{true, false} {
+			name := tt.name + " synced from the checking side"
+			if fromDeleting {
+				name = tt.name + " synced from the deleting side"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				dir := t.TempDir()
+				deleting, deletingSync := peerDatabase(t, filepath.Join(dir, "deleting.todo"))
+				checking, checkingSync := peerDatabase(t, filepath.Join(dir, "checking.todo"))
+
+				deleting.Insert(models.Task{Description: "Task"})
+				if _, err := deletingSync.SyncPeer(checkingSync, "deleting", "checking", models.MergeFields); err != nil {
+					t.Fatal(err)
+				}
+
+				time.Sleep(2 * time.Millisecond)
+				tt.change(deleting, checking)
+
+				local, peer := checkingSync, deletingSync
+				if fromDeleting {
+					local, peer = deletingSync, checkingSync
+				}
+				result, err := local.SyncPeer(peer, "local", "peer", models.MergeFields)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(result.Conflicts) != 1 || result.Conflicts[0].Field != "deleted" {
+					t.Fatalf("SyncPeer() conflicts = %+v, want the task deleted and changed", result.Conflicts)
+				}
+				conflict := result.Conflicts[0]
+				kept := conflict.Ours
+				if conflict.Kept == "theirs" {
+					kept = conflict.Theirs
+				}
+				if kept != tt.kept {
+					t.Errorf("SyncPeer() conflict = %+v, want the %s task kept", conflict, tt.kept)
+				}
+
+				for name, ts := range map[string]store.TaskStore{"deleting": deleting, "checking": checking} {
+					if got := contents(t, ts); !reflect.DeepEqual(got, tt.want) {
+						t.Errorf("%s tasks = %+v, want %+v", name, got, tt.want)
+					}
+				}
+				if got, want := replica(t, checkingSync), replica(t, deletingSync); !reflect.DeepEqual(got, want) {
+					t.Errorf("replicas differ: %+v and %+v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestSyncStore_Merge_ClockCounters(t *testing.T) {
+	ts, ss := syncDatabase(t, 0)
+	ts.Insert(models.Task{Description: "Task"})
+
+	changes, _, err := ss.Changes(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := changes[0]
+	wall := time.Now().Add(time.Hour).UnixMilli()
+
+	// counters past 99999 outgrow their padding, and still come later
+	for _, c := range []struct{ description, clock string }{
+		{"Counter 100000", fmt.Sprintf("%013d.%05d.b", wall, 100000)},
+		{"Counter 99999", fmt.Sprintf("%013d.%05d.c", wall, 99999)},
+	} {
+		change.Description, change.DescriptionClock, change.DescriptionChanged = c.description, c.clock, true
+		if _, err := ss.Merge([]models.TaskChange{change}, 0, models.MergeFields); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := contents(t, ts); len(got) != 1 || got[0].Description != "Counter 100000" {
+		t.Errorf("tasks = %+v, want the change with the larger counter", got)
+	}
+}
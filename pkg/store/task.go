@@ -1,22 +1,101 @@
 package store
 
 import (
-	"database/sql"
+	"time"
 
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/logging"
 	"github.com/imgabe/todo/pkg/models"
 	"github.com/jmoiron/sqlx"
 )
 
-// TaskStore is responsible for all database actions related to tasks
+// TaskStore is responsible for all database actions related to tasks.
+// Every query is limited to the tasks of OwnerID, where zero stands for
+// the tasks without owner managed by the local CLI. Changes are published
+// to Events when it is set, and operations logged to Log, the default
+// logger when nil.
 type TaskStore struct {
-	DB *sqlx.DB
+	DB      *sqlx.DB
+	OwnerID int64
+	Events  events.Publisher
+	Log     *logging.Logger
+}
+
+// ForOwner returns a copy of the store limited to the tasks of 'ownerID'
+func (s TaskStore) ForOwner(ownerID int64) TaskStore {
+	s.OwnerID = ownerID
+	return s
+}
+
+// WithLogger returns a copy of the store logging to 'l', such as the
+// logger of the request it serves
+func (s TaskStore) WithLogger(l *logging.Logger) TaskStore {
+	s.Log = l
+	return s
+}
+
+func (s TaskStore) log() *logging.Logger {
+	return storeLogger(s.Log, "task", s.OwnerID)
+}
+
+// owner returns the value compared with the 'owner_id' column
+func (s TaskStore) owner() *int64 {
+	if s.OwnerID == 0 {
+		return nil
+	}
+
+	ownerID := s.OwnerID
+	return &ownerID
+}
+
+func (s TaskStore) publish(t events.Type, task models.Task) {
+	if s.Events != nil {
+		s.Events.Publish(events.Event{Type: t, Task: task})
+	}
+}
+
+// selectByID retrieves a task regardless of who it belongs to, used to
+// describe changes to the subscribers of Events
+func (s TaskStore) selectByID(taskID int64) (models.Task, error) {
+	stmt := `
+		SELECT *
+		FROM task
+		WHERE id = $1
+	`
+
+	var received models.Task
+	err := s.DB.Get(&received, stmt, taskID)
+	if err != nil {
+		return models.Task{}, translate(err)
+	}
+
+	return received, nil
+}
+
+// access restricts a query to the tasks the store's user can reach: their
+// own tasks, the ones assigned to them when 'assigned' is set and the ones
+// shared with them with at least 'permission'. 'param' is the placeholder
+// bound to the user.
+func access(param string, permission models.Permission, assigned bool) string {
+	clause := "(owner_id IS " + param
+	if assigned {
+		clause += " OR assignee_id = " + param
+	}
+
+	shares := "SELECT owner_id FROM share WHERE user_id = " + param
+	if permission == models.PermissionWrite {
+		shares += " AND permission = 'write'"
+	}
+
+	return clause + " OR owner_id IN (" + shares + "))"
 }
 
 // Insert inserts a new task on the database
-func (s TaskStore) Insert(task models.Task) (models.Task, error) {
+func (s TaskStore) Insert(task models.Task) (_ models.Task, err error) {
+	defer logged(s.log(), "insert", time.Now(), &err)
 	insertStmt := `
-		INSERT INTO task (description, done)
-		VALUES (:description, :done);
+		INSERT INTO task (description, done, owner_id)
+		VALUES (:description, :done, :owner_id);
 	`
 
 	selectStmt := `
@@ -27,27 +106,59 @@ func (s TaskStore) Insert(task models.Task) (models.Task, error) {
 
 	var received models.Task
 
+	task.OwnerID = s.owner()
 	result, err := s.DB.NamedExec(insertStmt, &task)
 	if err != nil {
-		return received, err
+		return received, translate(err)
 	}
 
 	lastId, _ := result.LastInsertId()
 	err = s.DB.Get(&received, selectStmt, lastId)
 	if err != nil {
-		return received, err
+		return models.Task{}, translate(err)
 	}
 
+	s.publish(events.TaskCreated, received)
+
 	return received, nil
 }
 
-// Update updates an existent task on the database
-func (s TaskStore) Update(task models.Task) (models.Task, error) {
+// missing tells why a write limited to 'version' changed nothing:
+// ErrStale when the task is still reachable with another version,
+// ErrNotFound otherwise
+func (s TaskStore) missing(taskID int64, version int64, assigned bool) error {
+	stmt := `
+		SELECT COUNT(*)
+		FROM task
+		WHERE id = $1 AND ` + access("$2", models.PermissionWrite, assigned)
+
+	if version == 0 {
+		return ErrNotFound
+	}
+
+	var found int
+	err := s.DB.Get(&found, stmt, taskID, s.owner())
+	if err != nil {
+		return translate(err)
+	}
+	if found > 0 {
+		return ErrStale
+	}
+
+	return ErrNotFound
+}
+
+// Update updates an existent task on the database. When 'task.Version' is
+// set the task is only updated if it still has that version.
+func (s TaskStore) Update(task models.Task) (_ models.Task, err error) {
+	defer logged(s.log(), "update", time.Now(), &err)
 	stmt := `
 		UPDATE task
-		SET description = :description,
-			done = :done
-		WHERE id = :id
+		SET description = $1,
+			done = $2,
+			version = version + 1
+		WHERE id = $3 AND ` + access("$4", models.PermissionWrite, true) + `
+			AND ($5 = 0 OR version = $5)
 	`
 
 	selectStmt := `
@@ -58,96 +169,294 @@ func (s TaskStore) Update(task models.Task) (models.Task, error) {
 
 	var received models.Task
 
-	result, err := s.DB.NamedExec(stmt, &task)
+	result, err := s.DB.Exec(stmt, task.Description, task.Done, task.ID, s.owner(), task.Version)
 	if err != nil {
-		return received, err
+		return received, translate(err)
 	}
 
 	affected, _ := result.RowsAffected()
 	if affected == 0 {
-		return received, sql.ErrNoRows
+		return received, s.missing(task.ID, task.Version, true)
 	}
 
 	err = s.DB.Get(&received, selectStmt, task.ID)
 	if err != nil {
-		return received, err
+		return models.Task{}, translate(err)
 	}
 
+	s.publish(events.TaskUpdated, received)
+
 	return received, nil
 }
 
 // Delete deletes a task on the database
 func (s TaskStore) Delete(taskID int64) error {
+	return s.DeleteVersion(taskID, 0)
+}
+
+// DeleteVersion deletes a task on the database if it still has 'version',
+// whatever its version when it is zero
+func (s TaskStore) DeleteVersion(taskID int64, version int64) (err error) {
+	defer logged(s.log(), "delete_version", time.Now(), &err)
 	stmt := `
 		DELETE FROM task
-		WHERE id = $1
+		WHERE id = $1 AND ` + access("$2", models.PermissionWrite, false) + `
+			AND ($3 = 0 OR version = $3)
 	`
 
-	result, err := s.DB.Exec(stmt, &taskID)
+	deleted := models.Task{ID: taskID}
+	if s.Events != nil {
+		if task, err := s.selectByID(taskID); err == nil {
+			deleted = task
+		}
+	}
+
+	result, err := s.DB.Exec(stmt, &taskID, s.owner(), version)
 	if err != nil {
-		return err
+		return translate(err)
 	}
 
 	affected, _ := result.RowsAffected()
 	if affected == 0 {
-		return sql.ErrNoRows
+		return s.missing(taskID, version, false)
 	}
 
+	s.publish(events.TaskDeleted, deleted)
+
 	return nil
 }
 
 // Select retrieves a task from the database
-func (s TaskStore) Select(task models.Task) (models.Task, error) {
+func (s TaskStore) Select(task models.Task) (_ models.Task, err error) {
+	defer logged(s.log(), "select", time.Now(), &err)
 	stmt := `
 		SELECT *
 		FROM task
-		WHERE id = :id
-	`
+		WHERE id = $1 AND ` + access("$2", models.PermissionRead, true)
 
 	var received models.Task
-	err := s.DB.Get(&received, stmt, task.ID)
+	err = s.DB.Get(&received, stmt, task.ID, s.owner())
 	if err != nil {
-		return received, err
+		return models.Task{}, translate(err)
 	}
 
 	return received, err
 }
 
-// SelectAll retrieves all tasks from the database
-func (s TaskStore) SelectAll(done bool) ([]models.Task, error) {
+// paged restricts a query to the tasks of 'page' and sorts them by ID.
+// 'after' and 'limit' are the placeholders bound to 'pageArgs'.
+func paged(after, limit string) string {
+	return " AND id > " + after + " ORDER BY id LIMIT " + limit
+}
+
+// pageArgs returns the arguments of the placeholders added by paged, a
+// negative limit lifting it in SQLite
+func pageArgs(page models.Page) (int64, int) {
+	if page.Limit == 0 {
+		return page.After, -1
+	}
+
+	return page.After, page.Limit
+}
+
+// SelectAll retrieves the tasks of 'page' from the database
+func (s TaskStore) SelectAll(done bool, page models.Page) (_ []models.Task, err error) {
+	defer logged(s.log(), "select_all", time.Now(), &err)
 	stmt := `
 		SELECT *
 		FROM task
-		WHERE done = false OR done = :done
-	`
+		WHERE (done = false OR done = $1) AND owner_id IS $2` + paged("$3", "$4")
 
 	var tasks []models.Task
 
-	err := s.DB.Select(&tasks, stmt, done)
+	after, limit := pageArgs(page)
+	err = s.DB.Select(&tasks, stmt, done, s.owner(), after, limit)
 	if err != nil {
-		return nil, err
+		return nil, translate(err)
 	}
 
 	return tasks, nil
 }
 
+// CountAll returns how many tasks of every user are open and done
+func (s TaskStore) CountAll() (open int64, done int64, err error) {
+	defer logged(s.log(), "count_all", time.Now(), &err)
+	stmt := `
+		SELECT COALESCE(SUM(NOT done), 0) AS open, COALESCE(SUM(done), 0) AS done
+		FROM task
+	`
+
+	var counts struct {
+		Open int64 `db:"open"`
+		Done int64 `db:"done"`
+	}
+
+	err = s.DB.Get(&counts, stmt)
+	if err != nil {
+		return 0, 0, translate(err)
+	}
+
+	return counts.Open, counts.Done, nil
+}
+
 // Check checks a task on the database
-func (s TaskStore) Check(taskID int64) error {
+func (s TaskStore) Check(taskID int64) (err error) {
+	defer logged(s.log(), "check", time.Now(), &err)
 	stmt := `
 	UPDATE task
-	SET done = True
-	WHERE id = :id
-	`
+	SET done = True,
+		version = version + 1
+	WHERE id = $1 AND ` + access("$2", models.PermissionWrite, true)
 
-	result, err := s.DB.Exec(stmt, &taskID)
+	result, err := s.DB.Exec(stmt, &taskID, s.owner())
 	if err != nil {
-		return err
+		return translate(err)
 	}
 
 	affected, _ := result.RowsAffected()
 	if affected == 0 {
-		return sql.ErrNoRows
+		return ErrNotFound
+	}
+
+	if s.Events != nil {
+		if task, err := s.selectByID(taskID); err == nil {
+			s.publish(events.TaskChecked, task)
+		}
 	}
 
 	return nil
 }
+
+// SelectAssigned retrieves the tasks of 'page' assigned to the store's user
+func (s TaskStore) SelectAssigned(done bool, page models.Page) (_ []models.Task, err error) {
+	defer logged(s.log(), "select_assigned", time.Now(), &err)
+	stmt := `
+		SELECT *
+		FROM task
+		WHERE (done = false OR done = $1) AND assignee_id = $2` + paged("$3", "$4")
+
+	var tasks []models.Task
+
+	after, limit := pageArgs(page)
+	err = s.DB.Select(&tasks, stmt, done, s.owner(), after, limit)
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return tasks, nil
+}
+
+// SelectShared retrieves the tasks of 'page' of 'ownerID' when they are
+// shared with the store's user, or ErrNotFound otherwise
+func (s TaskStore) SelectShared(ownerID int64, done bool, page models.Page) (_ []models.Task, err error) {
+	defer logged(s.log(), "select_shared", time.Now(), &err)
+	if ownerID == s.OwnerID {
+		return s.SelectAll(done, page)
+	}
+
+	shareStmt := `
+		SELECT COUNT(*)
+		FROM share
+		WHERE owner_id = $1 AND user_id = $2
+	`
+
+	stmt := `
+		SELECT *
+		FROM task
+		WHERE (done = false OR done = $1) AND owner_id = $2` + paged("$3", "$4")
+
+	var shared int
+	err = s.DB.Get(&shared, shareStmt, ownerID, s.owner())
+	if err != nil {
+		return nil, translate(err)
+	}
+	if shared == 0 {
+		return nil, ErrNotFound
+	}
+
+	var tasks []models.Task
+
+	after, limit := pageArgs(page)
+	err = s.DB.Select(&tasks, stmt, done, ownerID, after, limit)
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return tasks, nil
+}
+
+// Assign sets the user a task is assigned to, removing the assignee when
+// 'assigneeID' is zero
+func (s TaskStore) Assign(taskID int64, assigneeID int64) (_ models.Task, err error) {
+	defer logged(s.log(), "assign", time.Now(), &err)
+	stmt := `
+		UPDATE task
+		SET assignee_id = $1,
+			version = version + 1
+		WHERE id = $2 AND ` + access("$3", models.PermissionWrite, false)
+
+	selectStmt := `
+		SELECT *
+		FROM task
+		WHERE id = $1
+	`
+
+	var assignee *int64
+	if assigneeID != 0 {
+		assignee = &assigneeID
+	}
+
+	var received models.Task
+
+	result, err := s.DB.Exec(stmt, assignee, taskID, s.owner())
+	if err != nil {
+		return received, translate(err)
+	}
+
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		return received, ErrNotFound
+	}
+
+	err = s.DB.Get(&received, selectStmt, taskID)
+	if err != nil {
+		return models.Task{}, translate(err)
+	}
+
+	s.publish(events.TaskUpdated, received)
+
+	return received, nil
+}
+
+// CanRead reports whether the store's user may read 'task', used to filter
+// events for subscribers
+func (s TaskStore) CanRead(task models.Task) (_ bool, err error) {
+	defer logged(s.log(), "can_read", time.Now(), &err)
+	stmt := `
+		SELECT COUNT(*)
+		FROM share
+		WHERE owner_id IS $1 AND user_id = $2
+	`
+
+	if sameUser(task.OwnerID, s.OwnerID) || (task.AssigneeID != nil && *task.AssigneeID == s.OwnerID) {
+		return true, nil
+	}
+
+	var shared int
+	err = s.DB.Get(&shared, stmt, task.OwnerID, s.owner())
+	if err != nil {
+		return false, err
+	}
+
+	return shared > 0, nil
+}
+
+// sameUser compares an owner column with a store's user, where a NULL
+// owner belongs to the local user zero
+func sameUser(id *int64, userID int64) bool {
+	if id == nil {
+		return userID == 0
+	}
+
+	return *id == userID
+}
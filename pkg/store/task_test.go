@@ -1,17 +1,33 @@
 package store_test
 
 import (
-	"database/sql"
+	"bytes"
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
 
-	"github.com/imgabe/todo/pkg/app"
+	"github.com/imgabe/todo/pkg/logging"
 	"github.com/imgabe/todo/pkg/models"
 	"github.com/imgabe/todo/pkg/store"
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/mattn/go-sqlite3"
 )
 
 var databasePath = ":memory:"
 
+// mustOpenDatabase opens the database at 'path' and applies the migrations,
+// panicking on errors
+func mustOpenDatabase(path string) *sqlx.DB {
+	db := sqlx.MustOpen("sqlite3", path)
+	if err := store.Migrate(db); err != nil {
+		panic(err)
+	}
+
+	return db
+}
+
 func TestTaskStore_Insert(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -22,9 +38,9 @@ func TestTaskStore_Insert(t *testing.T) {
 	}{
 		{
 			name:    "Insert a task",
-			store:   store.TaskStore{app.OpenDatabase(databasePath)},
+			store:   store.TaskStore{DB: mustOpenDatabase(databasePath)},
 			arg:     models.Task{Description: "Task 1", Done: false},
-			want:    models.Task{ID: 1, Description: "Task 1", Done: false},
+			want:    models.Task{ID: 1, Description: "Task 1", Done: false, Version: 1},
 			wantErr: false,
 		},
 	}
@@ -53,39 +69,59 @@ func TestTaskStore_Update(t *testing.T) {
 		store   store.TaskStore
 		args    testCase
 		want    models.Task
-		wantErr bool
+		wantErr error
 	}{
 		{
 			name:  "Update a task",
-			store: store.TaskStore{app.OpenDatabase(databasePath)},
+			store: store.TaskStore{DB: mustOpenDatabase(databasePath)},
 			args: testCase{
 				insert: models.Task{Description: "Inserted Task", Done: false},
 				update: models.Task{ID: 1, Description: "Updated Task", Done: true},
 			},
-			want:    models.Task{ID: 1, Description: "Updated Task", Done: true},
-			wantErr: false,
+			want:    models.Task{ID: 1, Description: "Updated Task", Done: true, Version: 2},
+			wantErr: nil,
+		},
+		{
+			name:  "Update the current version",
+			store: store.TaskStore{DB: mustOpenDatabase(databasePath)},
+			args: testCase{
+				insert: models.Task{Description: "Inserted Task", Done: false},
+				update: models.Task{ID: 1, Description: "Updated Task", Done: true, Version: 1},
+			},
+			want:    models.Task{ID: 1, Description: "Updated Task", Done: true, Version: 2},
+			wantErr: nil,
+		},
+		{
+			name:  "Update a stale version",
+			store: store.TaskStore{DB: mustOpenDatabase(databasePath)},
+			args: testCase{
+				insert: models.Task{Description: "Inserted Task", Done: false},
+				update: models.Task{ID: 1, Description: "Updated Task", Done: true, Version: 5},
+			},
+			want:    models.Task{ID: 0, Description: "", Done: false},
+			wantErr: store.ErrStale,
 		},
 		{
 			name:  "Update non-existent task",
-			store: store.TaskStore{app.OpenDatabase(databasePath)},
+			store: store.TaskStore{DB: mustOpenDatabase(databasePath)},
 			args: testCase{
 				insert: models.Task{Description: "Inserted Task", Done: false},
 				update: models.Task{ID: 2, Description: "Updated Task", Done: true},
 			},
 			want:    models.Task{ID: 0, Description: "", Done: false},
-			wantErr: true,
+			wantErr: store.ErrNotFound,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			_, err := tt.store.Insert(tt.args.insert)
 			if err != nil {
-				t.Errorf("TaskStore.Insert() error = %+v, wantErr %+v", err, tt.wantErr)
+				t.Errorf("TaskStore.Insert() error = %+v", err)
 				return
 			}
 
 			got, err := tt.store.Update(tt.args.update)
-			if (err != nil) != tt.wantErr {
+			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("TaskStore.Update() error = %+v, wantErr %+v", err, tt.wantErr)
 				return
 			}
@@ -111,7 +147,7 @@ func TestTaskStore_Delete(t *testing.T) {
 	}{
 		{
 			name:  "Delete a task",
-			store: store.TaskStore{app.OpenDatabase(databasePath)},
+			store: store.TaskStore{DB: mustOpenDatabase(databasePath)},
 			args: testCase{
 				insert: models.Task{Description: "Inserted Task", Done: false},
 				delete: 1,
@@ -121,12 +157,12 @@ func TestTaskStore_Delete(t *testing.T) {
 		},
 		{
 			name:  "Delete non-existent task",
-			store: store.TaskStore{app.OpenDatabase(databasePath)},
+			store: store.TaskStore{DB: mustOpenDatabase(databasePath)},
 			args: testCase{
 				insert: models.Task{Description: "Inserted Task", Done: false},
 				delete: 2,
 			},
-			want:    sql.ErrNoRows,
+			want:    store.ErrNotFound,
 			wantErr: false,
 		},
 	}
@@ -165,17 +201,17 @@ func TestTaskStore_Select(t *testing.T) {
 	}{
 		{
 			name:  "Select a task",
-			store: store.TaskStore{app.OpenDatabase(databasePath)},
+			store: store.TaskStore{DB: mustOpenDatabase(databasePath)},
 			args: testCase{
 				insert:   models.Task{Description: "Inserted Task", Done: false},
 				selected: models.Task{ID: 1},
 			},
-			want:    models.Task{ID: 1, Description: "Inserted Task", Done: false},
+			want:    models.Task{ID: 1, Description: "Inserted Task", Done: false, Version: 1},
 			wantErr: false,
 		},
 		{
 			name:  "Select non-existent task",
-			store: store.TaskStore{app.OpenDatabase(databasePath)},
+			store: store.TaskStore{DB: mustOpenDatabase(databasePath)},
 			args: testCase{
 				insert:   models.Task{Description: "Inserted Task", Done: false},
 				selected: models.Task{ID: 2, Description: "Inserted Task", Done: true},
@@ -219,17 +255,17 @@ func TestTaskStore_Check(t *testing.T) {
 	}{
 		{
 			name:  "Check a task",
-			store: store.TaskStore{app.OpenDatabase(databasePath)},
+			store: store.TaskStore{DB: mustOpenDatabase(databasePath)},
 			args: testCase{
 				insert: models.Task{Description: "Inserted Task", Done: false},
 				taskID: 1,
 			},
-			want:    models.Task{ID: 1, Description: "Inserted Task", Done: true},
+			want:    models.Task{ID: 1, Description: "Inserted Task", Done: true, Version: 2},
 			wantErr: false,
 		},
 		{
 			name:  "Check a non-existent task",
-			store: store.TaskStore{app.OpenDatabase(databasePath)},
+			store: store.TaskStore{DB: mustOpenDatabase(databasePath)},
 			args: testCase{
 				insert: models.Task{Description: "Inserted Task", Done: false},
 				taskID: 2,
@@ -269,32 +305,32 @@ func TestTaskStore_SelectAll(t *testing.T) {
 	}{
 		{
 			name:  "Empty list",
-			store: store.TaskStore{app.OpenDatabase(databasePath)},
+			store: store.TaskStore{DB: mustOpenDatabase(databasePath)},
 			args: testCase{
 				insert: models.Task{},
 				done:   false,
 			},
-			want:    []models.Task{{ID: 1, Done: false}},
+			want:    []models.Task{{ID: 1, Done: false, Version: 1}},
 			wantErr: false,
 		},
 		{
 			name:  "List one task",
-			store: store.TaskStore{app.OpenDatabase(databasePath)},
+			store: store.TaskStore{DB: mustOpenDatabase(databasePath)},
 			args: testCase{
 				insert: models.Task{Description: "Inserted Task", Done: false},
 				done:   false,
 			},
-			want:    []models.Task{{ID: 1, Description: "Inserted Task", Done: false}},
+			want:    []models.Task{{ID: 1, Description: "Inserted Task", Done: false, Version: 1}},
 			wantErr: false,
 		},
 		{
 			name:  "List task with one check",
-			store: store.TaskStore{app.OpenDatabase(databasePath)},
+			store: store.TaskStore{DB: mustOpenDatabase(databasePath)},
 			args: testCase{
 				insert: models.Task{Description: "Inserted Task", Done: true},
 				done:   true,
 			},
-			want:    []models.Task{{ID: 1, Description: "Inserted Task", Done: true}},
+			want:    []models.Task{{ID: 1, Description: "Inserted Task", Done: true, Version: 1}},
 			wantErr: false,
 		},
 	}
@@ -306,7 +342,7 @@ func TestTaskStore_SelectAll(t *testing.T) {
 				return
 			}
 
-			got, err := tt.store.SelectAll(tt.args.done)
+			got, err := tt.store.SelectAll(tt.args.done, models.Page{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("TaskStore.SelectAll() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -318,3 +354,180 @@ func TestTaskStore_SelectAll(t *testing.T) {
 		})
 	}
 }
+
+func TestTaskStore_SelectAll_Page(t *testing.T) {
+	ts := store.TaskStore{DB: mustOpenDatabase(databasePath)}
+	for _, description := range []string{"Task 1", "Task 2", "Task 3", "Task 4"} {
+		if _, err := ts.Insert(models.Task{Description: description}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		page models.Page
+		want []int64
+	}{
+		{name: "Every task", page: models.Page{}, want: []int64{1, 2, 3, 4}},
+		{name: "First page", page: models.Page{Limit: 2}, want: []int64{1, 2}},
+		{name: "Next page", page: models.Page{After: 2, Limit: 2}, want: []int64{3, 4}},
+		{name: "Last page", page: models.Page{After: 3, Limit: 2}, want: []int64{4}},
+		{name: "After the last task", page: models.Page{After: 4}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks, err := ts.SelectAll(true, tt.page)
+			if err != nil {
+				t.Fatalf("TaskStore.SelectAll() error = %+v", err)
+			}
+
+			var got []int64
+			for _, task := range tasks {
+				got = append(got, task.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TaskStore.SelectAll() IDs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTaskStore_CountAll(t *testing.T) {
+	tests := []struct {
+		name     string
+		insert   []models.Task
+		owners   []int64
+		wantOpen int64
+		wantDone int64
+	}{
+		{name: "No tasks"},
+		{
+			name:     "Tasks of every owner",
+			insert:   []models.Task{{Description: "a"}, {Description: "b", Done: true}, {Description: "c"}},
+			owners:   []int64{0, 1, 2},
+			wantOpen: 2, wantDone: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := store.TaskStore{DB: mustOpenDatabase(databasePath)}
+			for i, task := range tt.insert {
+				if _, err := ts.ForOwner(tt.owners[i]).Insert(task); err != nil {
+					t.Fatalf("TaskStore.Insert() error = %+v", err)
+				}
+			}
+
+			open, done, err := ts.CountAll()
+			if err != nil {
+				t.Fatalf("TaskStore.CountAll() error = %+v", err)
+			}
+			if open != tt.wantOpen || done != tt.wantDone {
+				t.Errorf("TaskStore.CountAll() = %d, %d, want %d, %d", open, done, tt.wantOpen, tt.wantDone)
+			}
+		})
+	}
+}
+
+func TestTaskStore_ForOwner(t *testing.T) {
+	db := mustOpenDatabase(databasePath)
+	users := store.UserStore{DB: db}
+
+	alice, err := users.Insert("alice", "secret")
+	if err != nil {
+		t.Fatalf("UserStore.Insert() error = %+v", err)
+	}
+
+	local := store.TaskStore{DB: db}
+	owned := local.ForOwner(alice.ID)
+
+	if _, err := local.Insert(models.Task{Description: "Local Task"}); err != nil {
+		t.Fatalf("TaskStore.Insert() error = %+v", err)
+	}
+	task, err := owned.Insert(models.Task{Description: "Alice Task"})
+	if err != nil {
+		t.Fatalf("TaskStore.Insert() error = %+v", err)
+	}
+
+	tests := []struct {
+		name  string
+		store store.TaskStore
+		want  []string
+	}{
+		{name: "Local tasks", store: local, want: []string{"Local Task"}},
+		{name: "Owned tasks", store: owned, want: []string{"Alice Task"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks, err := tt.store.SelectAll(true, models.Page{})
+			if err != nil {
+				t.Fatalf("TaskStore.SelectAll() error = %+v", err)
+			}
+
+			var got []string
+			for _, task := range tasks {
+				got = append(got, task.Description)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TaskStore.SelectAll() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := local.Select(task); err != store.ErrNotFound {
+		t.Errorf("TaskStore.Select() error = %+v, want %+v", err, store.ErrNotFound)
+	}
+	if err := local.Delete(task.ID); err != store.ErrNotFound {
+		t.Errorf("TaskStore.Delete() error = %+v, want %+v", err, store.ErrNotFound)
+	}
+}
+
+func TestTaskStore_DeleteVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		taskID  int64
+		version int64
+		want    error
+	}{
+		{name: "Any version", taskID: 1, version: 0, want: nil},
+		{name: "Current version", taskID: 1, version: 2, want: nil},
+		{name: "Stale version", taskID: 1, version: 1, want: store.ErrStale},
+		{name: "Non-existent task", taskID: 2, version: 1, want: store.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := store.TaskStore{DB: mustOpenDatabase(databasePath)}
+
+			if _, err := ts.Insert(models.Task{Description: "Inserted Task"}); err != nil {
+				t.Fatalf("TaskStore.Insert() error = %+v", err)
+			}
+			if err := ts.Check(1); err != nil {
+				t.Fatalf("TaskStore.Check() error = %+v", err)
+			}
+
+			if err := ts.DeleteVersion(tt.taskID, tt.version); err != tt.want {
+				t.Errorf("TaskStore.DeleteVersion() error = %+v, want %+v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTaskStore_WithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	db := mustOpenDatabase(databasePath)
+	s := store.TaskStore{DB: db}.ForOwner(7).WithLogger(logging.New(&buf, logging.LevelDebug, logging.FormatText).With("request_id", "req-42"))
+
+	s.Insert(models.Task{Description: "Task 1"})
+	s.Select(models.Task{ID: 404})
+	db.Close()
+	s.SelectAll(true, models.Page{})
+
+	for _, want := range []string{
+		`level=debug msg="store operation" request_id=req-42 store=task owner_id=7 operation=insert`,
+		`level=debug msg="store operation" request_id=req-42 store=task owner_id=7 operation=select`,
+		`level=error msg="store operation failed" request_id=req-42 store=task owner_id=7 operation=select_all`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log missing %q:\n%s", want, buf.String())
+		}
+	}
+}
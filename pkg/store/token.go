@@ -0,0 +1,144 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// tokenPrefix makes tokens recognizable when they leak into logs or files
+const tokenPrefix = "todo_"
+
+// TokenStore is responsible for all database actions related to API tokens
+type TokenStore struct {
+	DB *sqlx.DB
+}
+
+// HashToken returns the value stored in the database for a raw token
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Create generates a new token and stores its hash on the database. The
+// raw token is returned and cannot be recovered afterwards.
+func (s TokenStore) Create(token models.Token) (string, models.Token, error) {
+	insertStmt := `
+		INSERT INTO token (name, hash, scopes, created_at, expires_at, user_id)
+		VALUES (:name, :hash, :scopes, :created_at, :expires_at, :user_id);
+	`
+
+	selectStmt := `
+		SELECT *
+		FROM token
+		WHERE id = $1
+	`
+
+	var received models.Token
+
+	raw, err := generateToken()
+	if err != nil {
+		return "", received, translate(err)
+	}
+
+	token.Hash = HashToken(raw)
+	token.CreatedAt = time.Now().UTC()
+
+	result, err := s.DB.NamedExec(insertStmt, &token)
+	if err != nil {
+		return "", received, translate(err)
+	}
+
+	lastId, _ := result.LastInsertId()
+	err = s.DB.Get(&received, selectStmt, lastId)
+	if err != nil {
+		return "", received, translate(err)
+	}
+
+	return raw, received, nil
+}
+
+// SelectByToken retrieves the token matching a raw token
+func (s TokenStore) SelectByToken(raw string) (models.Token, error) {
+	stmt := `
+		SELECT *
+		FROM token
+		WHERE hash = $1
+	`
+
+	var received models.Token
+	err := s.DB.Get(&received, stmt, HashToken(raw))
+	if err != nil {
+		return received, translate(err)
+	}
+
+	return received, nil
+}
+
+// SelectAll retrieves all tokens from the database
+func (s TokenStore) SelectAll() ([]models.Token, error) {
+	stmt := `
+		SELECT *
+		FROM token
+		ORDER BY id
+	`
+
+	var tokens []models.Token
+
+	err := s.DB.Select(&tokens, stmt)
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return tokens, nil
+}
+
+// Revoke deletes a token from the database
+func (s TokenStore) Revoke(tokenID int64) error {
+	stmt := `
+		DELETE FROM token
+		WHERE id = $1
+	`
+
+	result, err := s.DB.Exec(stmt, tokenID)
+	if err != nil {
+		return translate(err)
+	}
+
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteExpired removes the tokens that expired before 'before', returning
+// how many were removed
+func (s TokenStore) DeleteExpired(before time.Time) (int64, error) {
+	stmt := `
+		DELETE FROM token
+		WHERE expires_at < $1
+	`
+
+	result, err := s.DB.Exec(stmt, before.UTC())
+	if err != nil {
+		return 0, translate(err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,99 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+)
+
+func TestTokenStore_Create(t *testing.T) {
+	ts := store.TokenStore{DB: mustOpenDatabase(databasePath)}
+
+	raw, created, err := ts.Create(models.Token{Name: "ci", Scopes: "read"})
+	if err != nil {
+		t.Fatalf("TokenStore.Create() error = %+v", err)
+	}
+	if created.Hash == raw || created.Hash != store.HashToken(raw) {
+		t.Errorf("TokenStore.Create() stored hash %+v for token %+v", created.Hash, raw)
+	}
+
+	got, err := ts.SelectByToken(raw)
+	if err != nil {
+		t.Fatalf("TokenStore.SelectByToken() error = %+v", err)
+	}
+	if got.ID != created.ID || got.Name != "ci" || got.Scopes != "read" {
+		t.Errorf("TokenStore.SelectByToken() = %+v, want %+v", got, created)
+	}
+
+	if _, err := ts.SelectByToken(raw + "x"); err != store.ErrNotFound {
+		t.Errorf("TokenStore.SelectByToken() error = %+v, want %+v", err, store.ErrNotFound)
+	}
+}
+
+func TestTokenStore_Revoke(t *testing.T) {
+	tests := []struct {
+		name    string
+		tokenID int64
+		want    error
+	}{
+		{
+			name:    "Revoke a token",
+			tokenID: 1,
+			want:    nil,
+		},
+		{
+			name:    "Revoke non-existent token",
+			tokenID: 2,
+			want:    store.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := store.TokenStore{DB: mustOpenDatabase(databasePath)}
+
+			raw, _, err := ts.Create(models.Token{Name: "ci", Scopes: "read"})
+			if err != nil {
+				t.Fatalf("TokenStore.Create() error = %+v", err)
+			}
+
+			if got := ts.Revoke(tt.tokenID); got != tt.want {
+				t.Errorf("TokenStore.Revoke() = %+v, want %+v", got, tt.want)
+			}
+
+			_, err = ts.SelectByToken(raw)
+			if revoked := err == store.ErrNotFound; revoked != (tt.want == nil) {
+				t.Errorf("TokenStore.SelectByToken() error = %+v after revoke", err)
+			}
+		})
+	}
+}
+
+func TestTokenStore_DeleteExpired(t *testing.T) {
+	ts := store.TokenStore{DB: mustOpenDatabase(databasePath)}
+
+	now := time.Now()
+	expired, valid := now.Add(-time.Minute), now.Add(time.Minute)
+	for _, token := range []models.Token{
+		{Name: "expired", Scopes: "read", ExpiresAt: &expired},
+		{Name: "valid", Scopes: "read", ExpiresAt: &valid},
+		{Name: "ci", Scopes: "read"},
+	} {
+		if _, _, err := ts.Create(token); err != nil {
+			t.Fatalf("TokenStore.Create() error = %+v", err)
+		}
+	}
+
+	if got, err := ts.DeleteExpired(now); err != nil || got != 1 {
+		t.Fatalf("TokenStore.DeleteExpired() = %d, %+v, want 1", got, err)
+	}
+
+	tokens, err := ts.SelectAll()
+	if err != nil {
+		t.Fatalf("TokenStore.SelectAll() error = %+v", err)
+	}
+	if len(tokens) != 2 || tokens[0].Name != "valid" || tokens[1].Name != "ci" {
+		t.Errorf("TokenStore.SelectAll() = %+v, want the valid tokens", tokens)
+	}
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"time"
+
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserStore is responsible for all database actions related to users
+type UserStore struct {
+	DB *sqlx.DB
+}
+
+// Insert creates a new user, storing a bcrypt hash of the password
+func (s UserStore) Insert(name, password string) (models.User, error) {
+	insertStmt := `
+		INSERT INTO user (name, password_hash, created_at)
+		VALUES (:name, :password_hash, :created_at);
+	`
+
+	selectStmt := `
+		SELECT *
+		FROM user
+		WHERE id = $1
+	`
+
+	var received models.User
+
+	if name == "" {
+		return received, ValidationError{Field: "name", Message: "must not be empty"}
+	}
+	if password == "" {
+		return received, ValidationError{Field: "password", Message: "must not be empty"}
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return received, translate(err)
+	}
+
+	user := models.User{Name: name, PasswordHash: string(hash), CreatedAt: time.Now().UTC()}
+	result, err := s.DB.NamedExec(insertStmt, &user)
+	if err != nil {
+		return received, translate(err)
+	}
+
+	lastId, _ := result.LastInsertId()
+	err = s.DB.Get(&received, selectStmt, lastId)
+	if err != nil {
+		return models.User{}, translate(err)
+	}
+
+	return received, nil
+}
+
+// SelectByName retrieves a user from the database
+func (s UserStore) SelectByName(name string) (models.User, error) {
+	stmt := `
+		SELECT *
+		FROM user
+		WHERE name = $1
+	`
+
+	var received models.User
+	err := s.DB.Get(&received, stmt, name)
+	if err != nil {
+		return models.User{}, translate(err)
+	}
+
+	return received, nil
+}
+
+// Select retrieves a user from the database by ID
+func (s UserStore) Select(userID int64) (models.User, error) {
+	stmt := `
+		SELECT *
+		FROM user
+		WHERE id = $1
+	`
+
+	var received models.User
+	err := s.DB.Get(&received, stmt, userID)
+	if err != nil {
+		return models.User{}, translate(err)
+	}
+
+	return received, nil
+}
+
+// SelectAll retrieves all users from the database
+func (s UserStore) SelectAll() ([]models.User, error) {
+	stmt := `
+		SELECT *
+		FROM user
+		ORDER BY id
+	`
+
+	var users []models.User
+
+	err := s.DB.Select(&users, stmt)
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return users, nil
+}
+
+// Authenticate retrieves the user matching a name and password
+func (s UserStore) Authenticate(name, password string) (models.User, error) {
+	user, err := s.SelectByName(name)
+	if err == ErrNotFound {
+		return models.User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return models.User{}, translate(err)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	if err != nil {
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
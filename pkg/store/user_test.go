@@ -0,0 +1,80 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/imgabe/todo/pkg/store"
+)
+
+func TestUserStore_Authenticate(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		wantErr  error
+	}{
+		{name: "Valid credentials", user: "alice", password: "secret", wantErr: nil},
+		{name: "Wrong password", user: "alice", password: "guess", wantErr: store.ErrInvalidCredentials},
+		{name: "Unknown user", user: "bob", password: "secret", wantErr: store.ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			us := store.UserStore{DB: mustOpenDatabase(databasePath)}
+
+			inserted, err := us.Insert("alice", "secret")
+			if err != nil {
+				t.Fatalf("UserStore.Insert() error = %+v", err)
+			}
+			if inserted.PasswordHash == "secret" {
+				t.Errorf("UserStore.Insert() stored the password in clear")
+			}
+
+			got, err := us.Authenticate(tt.user, tt.password)
+			if err != tt.wantErr {
+				t.Errorf("UserStore.Authenticate() error = %+v, want %+v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.ID != inserted.ID {
+				t.Errorf("UserStore.Authenticate() = %+v, want %+v", got, inserted)
+			}
+		})
+	}
+}
+
+func TestUserStore_Insert(t *testing.T) {
+	tests := []struct {
+		name          string
+		user          string
+		password      string
+		wantErr       error
+		wantValidator bool
+	}{
+		{name: "New user", user: "bob", password: "secret"},
+		{name: "Taken name", user: "alice", password: "secret", wantErr: store.ErrConflict},
+		{name: "Empty name", user: "", password: "secret", wantValidator: true},
+		{name: "Empty password", user: "bob", password: "", wantValidator: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			us := store.UserStore{DB: mustOpenDatabase(databasePath)}
+
+			if _, err := us.Insert("alice", "secret"); err != nil {
+				t.Fatalf("UserStore.Insert() error = %+v", err)
+			}
+
+			_, err := us.Insert(tt.user, tt.password)
+
+			var validation store.ValidationError
+			if got := errors.As(err, &validation); got != tt.wantValidator {
+				t.Errorf("UserStore.Insert() error = %+v, want a validation error %+v", err, tt.wantValidator)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("UserStore.Insert() error = %+v, want %+v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !tt.wantValidator && err != nil {
+				t.Errorf("UserStore.Insert() error = %+v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// WebhookStore is responsible for all database actions related to webhooks
+// and their deliveries. Webhooks belong to the user OwnerID, zero being the
+// owner of the tasks without owner managed by the local CLI, and receive
+// the events of that owner's tasks only.
+type WebhookStore struct {
+	DB      *sqlx.DB
+	OwnerID int64
+}
+
+// ForOwner returns a copy of the store limited to the webhooks of 'ownerID'
+func (s WebhookStore) ForOwner(ownerID int64) WebhookStore {
+	s.OwnerID = ownerID
+	return s
+}
+
+func (s WebhookStore) owner() *int64 {
+	if s.OwnerID == 0 {
+		return nil
+	}
+
+	ownerID := s.OwnerID
+	return &ownerID
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Insert stores a new webhook with a generated signing secret
+func (s WebhookStore) Insert(webhook models.Webhook) (models.Webhook, error) {
+	insertStmt := `
+		INSERT INTO webhook (url, events, secret, owner_id, created_at)
+		VALUES (:url, :events, :secret, :owner_id, :created_at);
+	`
+
+	selectStmt := `
+		SELECT *
+		FROM webhook
+		WHERE id = $1
+	`
+
+	var received models.Webhook
+
+	secret, err := generateSecret()
+	if err != nil {
+		return received, translate(err)
+	}
+
+	webhook.Secret = secret
+	webhook.OwnerID = s.owner()
+	webhook.CreatedAt = time.Now().UTC()
+
+	result, err := s.DB.NamedExec(insertStmt, &webhook)
+	if err != nil {
+		return received, translate(err)
+	}
+
+	lastId, _ := result.LastInsertId()
+	err = s.DB.Get(&received, selectStmt, lastId)
+	if err != nil {
+		return models.Webhook{}, translate(err)
+	}
+
+	return received, nil
+}
+
+// Delete removes a webhook and its delivery log from the database
+func (s WebhookStore) Delete(webhookID int64) error {
+	deliveriesStmt := `
+		DELETE FROM webhook_delivery
+		WHERE webhook_id IN (SELECT id FROM webhook WHERE id = $1 AND owner_id IS $2)
+	`
+
+	stmt := `
+		DELETE FROM webhook
+		WHERE id = $1 AND owner_id IS $2
+	`
+
+	if _, err := s.DB.Exec(deliveriesStmt, webhookID, s.owner()); err != nil {
+		return translate(err)
+	}
+
+	result, err := s.DB.Exec(stmt, webhookID, s.owner())
+	if err != nil {
+		return translate(err)
+	}
+
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// SelectAll retrieves all webhooks of the owner from the database
+func (s WebhookStore) SelectAll() ([]models.Webhook, error) {
+	stmt := `
+		SELECT *
+		FROM webhook
+		WHERE owner_id IS $1
+		ORDER BY id
+	`
+
+	var webhooks []models.Webhook
+
+	err := s.DB.Select(&webhooks, stmt, s.owner())
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return webhooks, nil
+}
+
+// SelectByEvent retrieves the webhooks subscribed to 'event' on the tasks
+// of 'ownerID', whatever the owner of the store
+func (s WebhookStore) SelectByEvent(event string, ownerID int64) ([]models.Webhook, error) {
+	webhooks, err := s.ForOwner(ownerID).SelectAll()
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	var subscribed []models.Webhook
+	for _, webhook := range webhooks {
+		if webhook.Subscribed(event) {
+			subscribed = append(subscribed, webhook)
+		}
+	}
+
+	return subscribed, nil
+}
+
+// InsertDelivery logs a delivery attempt
+func (s WebhookStore) InsertDelivery(delivery models.Delivery) error {
+	stmt := `
+		INSERT INTO webhook_delivery (webhook_id, delivery, event, attempt, status_code, error, created_at)
+		VALUES (:webhook_id, :delivery, :event, :attempt, :status_code, :error, :created_at);
+	`
+
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := s.DB.NamedExec(stmt, &delivery)
+	return translate(err)
+}
+
+// SelectDeliveries retrieves the latest 'limit' delivery attempts to the
+// webhooks of the owner, newest first
+func (s WebhookStore) SelectDeliveries(limit int) ([]models.Delivery, error) {
+	stmt := `
+		SELECT webhook_delivery.*
+		FROM webhook_delivery
+		JOIN webhook ON webhook.id = webhook_delivery.webhook_id
+		WHERE webhook.owner_id IS $1
+		ORDER BY webhook_delivery.id DESC
+		LIMIT $2
+	`
+
+	var deliveries []models.Delivery
+
+	err := s.DB.Select(&deliveries, stmt, s.owner(), limit)
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return deliveries, nil
+}
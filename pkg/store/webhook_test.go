@@ -0,0 +1,70 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/store"
+)
+
+func TestWebhookStore_Owner(t *testing.T) {
+	db := mustOpenDatabase(databasePath)
+	defer db.Close()
+
+	users := store.UserStore{DB: db}
+	alice, _ := users.Insert("alice", "password")
+	bob, _ := users.Insert("bob", "password")
+
+	webhooks := store.WebhookStore{DB: db}
+	local, err := webhooks.Insert(models.Webhook{URL: "http://localhost/local", Events: "checked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alices, err := webhooks.ForOwner(alice.ID).Insert(models.Webhook{URL: "http://localhost/alice", Events: "checked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := webhooks.InsertDelivery(models.Delivery{WebhookID: alices.ID, Delivery: "d", Event: "checked", Attempt: 1, StatusCode: 200}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		ownerID int64
+		want    []int64
+	}{
+		{name: "Tasks without owner", ownerID: 0, want: []int64{local.ID}},
+		{name: "Tasks of the owner", ownerID: alice.ID, want: []int64{alices.ID}},
+		{name: "Tasks of another user", ownerID: bob.ID, want: nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			subscribed, err := webhooks.SelectByEvent("checked", tt.ownerID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []int64
+			for _, webhook := range subscribed {
+				got = append(got, webhook.ID)
+			}
+			if len(got) != len(tt.want) || len(got) > 0 && got[0] != tt.want[0] {
+				t.Errorf("SelectByEvent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if deliveries, err := webhooks.ForOwner(bob.ID).SelectDeliveries(10); err != nil || len(deliveries) != 0 {
+		t.Errorf("SelectDeliveries() of another user = %+v, %v, want none", deliveries, err)
+	}
+	if deliveries, err := webhooks.ForOwner(alice.ID).SelectDeliveries(10); err != nil || len(deliveries) != 1 {
+		t.Errorf("SelectDeliveries() of the owner = %+v, %v, want the delivery", deliveries, err)
+	}
+
+	if err := webhooks.ForOwner(bob.ID).Delete(alices.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Delete() by another user error = %v, want ErrNotFound", err)
+	}
+	if err := webhooks.ForOwner(alice.ID).Delete(alices.ID); err != nil {
+		t.Errorf("Delete() by the owner error = %v", err)
+	}
+}
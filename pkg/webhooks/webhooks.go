@@ -0,0 +1,187 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/logging"
+	"github.com/imgabe/todo/pkg/models"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 of the body, as 'sha256=<hex>'
+	SignatureHeader = "X-Todo-Signature"
+	// EventHeader carries the event type
+	EventHeader = "X-Todo-Event"
+	// DeliveryHeader carries an identifier shared by all attempts of a delivery
+	DeliveryHeader = "X-Todo-Delivery"
+)
+
+// Store is the set of store operations the dispatcher relies on, satisfied
+// by 'store.WebhookStore'
+type Store interface {
+	// SelectByEvent returns the webhooks subscribed to 'event' on the tasks
+	// of 'ownerID', zero for the tasks without owner
+	SelectByEvent(event string, ownerID int64) ([]models.Webhook, error)
+	InsertDelivery(delivery models.Delivery) error
+}
+
+// Sign returns the signature of 'body' sent in SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether 'signature' is the signature of 'body'
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Dispatcher delivers task events to the webhooks subscribed to them,
+// retrying failed deliveries with exponential backoff
+type Dispatcher struct {
+	Store  Store
+	Client *http.Client
+	// MaxAttempts is how many times a delivery is tried before giving up
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled on every retry
+	Backoff time.Duration
+
+	wg sync.WaitGroup
+}
+
+// NewDispatcher returns a dispatcher with the default retry policy
+func NewDispatcher(store Store) *Dispatcher {
+	return &Dispatcher{
+		Store:       store,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+	}
+}
+
+// Run dispatches every event received on 'ch' until it is closed or 'ctx'
+// is done, then waits for pending deliveries. Cancelling 'ctx' also stops
+// waiting to retry.
+func (d *Dispatcher) Run(ctx context.Context, ch <-chan events.Event) {
+	defer d.wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			d.Dispatch(ctx, event)
+		}
+	}
+}
+
+// Dispatch starts delivering 'event' to the webhooks of the owner of its
+// task subscribed to it
+func (d *Dispatcher) Dispatch(ctx context.Context, event events.Event) {
+	var ownerID int64
+	if event.Task.OwnerID != nil {
+		ownerID = *event.Task.OwnerID
+	}
+
+	webhooks, err := d.Store.SelectByEvent(string(event.Type), ownerID)
+	if err != nil {
+		logging.FromContext(ctx).Error("selecting webhooks", "event", event.Type, "error", err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		logging.FromContext(ctx).Error("encoding webhook event", "event", event.Type, "error", err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		d.wg.Add(1)
+		go func(webhook models.Webhook) {
+			defer d.wg.Done()
+			d.deliver(ctx, webhook, event.Type, body)
+		}(webhook)
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, webhook models.Webhook, event events.Type, body []byte) {
+	delivery := newDeliveryID()
+	backoff := d.Backoff
+
+	for attempt := 1; attempt <= d.MaxAttempts; attempt++ {
+		status, err := d.send(ctx, webhook, event, delivery, body)
+
+		record := models.Delivery{
+			WebhookID:  webhook.ID,
+			Delivery:   delivery,
+			Event:      string(event),
+			Attempt:    attempt,
+			StatusCode: status,
+		}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		if err := d.Store.InsertDelivery(record); err != nil {
+			logging.FromContext(ctx).Error("recording webhook delivery", "delivery", delivery, "webhook_id", webhook.ID, "error", err)
+		}
+
+		if record.Succeeded() || attempt == d.MaxAttempts {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, webhook models.Webhook, event events.Type, delivery string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(event))
+	req.Header.Set(DeliveryHeader, delivery)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func newDeliveryID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,136 @@
+package webhooks_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imgabe/todo/pkg/events"
+	"github.com/imgabe/todo/pkg/models"
+	"github.com/imgabe/todo/pkg/webhooks"
+)
+
+type fakeStore struct {
+	mu         sync.Mutex
+	webhooks   []models.Webhook
+	deliveries []models.Delivery
+}
+
+func (f *fakeStore) SelectByEvent(event string, ownerID int64) ([]models.Webhook, error) {
+	var subscribed []models.Webhook
+	for _, webhook := range f.webhooks {
+		owned := webhook.OwnerID == nil && ownerID == 0 || webhook.OwnerID != nil && *webhook.OwnerID == ownerID
+		if owned && webhook.Subscribed(event) {
+			subscribed = append(subscribed, webhook)
+		}
+	}
+
+	return subscribed, nil
+}
+
+func (f *fakeStore) InsertDelivery(delivery models.Delivery) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.deliveries = append(f.deliveries, delivery)
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	owner, other := int64(1), int64(2)
+
+	tests := []struct {
+		name         string
+		event        events.Type
+		owner        *int64
+		failures     int
+		wantStatuses []int
+	}{
+		{
+			name:         "Deliver on first attempt",
+			event:        events.TaskChecked,
+			wantStatuses: []int{http.StatusOK},
+		},
+		{
+			name:         "Retry failed deliveries",
+			event:        events.TaskChecked,
+			failures:     2,
+			wantStatuses: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK},
+		},
+		{
+			name:         "Give up after max attempts",
+			event:        events.TaskChecked,
+			failures:     10,
+			wantStatuses: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+		},
+		{
+			name:         "Skip unsubscribed events",
+			event:        events.TaskDeleted,
+			wantStatuses: nil,
+		},
+		{
+			name:         "Skip the tasks of other owners",
+			event:        events.TaskChecked,
+			owner:        &other,
+			wantStatuses: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := "s3cret"
+			calls := 0
+
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if !webhooks.Verify(secret, body, r.Header.Get(webhooks.SignatureHeader)) {
+					t.Errorf("invalid signature %s", r.Header.Get(webhooks.SignatureHeader))
+				}
+				if got := r.Header.Get(webhooks.EventHeader); got != string(tt.event) {
+					t.Errorf("%s = %s, want %s", webhooks.EventHeader, got, tt.event)
+				}
+
+				calls++
+				if calls <= tt.failures {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			defer receiver.Close()
+
+			store := &fakeStore{webhooks: []models.Webhook{
+				{ID: 1, URL: receiver.URL, Events: "created,checked", Secret: secret, OwnerID: &owner},
+			}}
+			dispatcher := webhooks.NewDispatcher(store)
+			dispatcher.MaxAttempts = 3
+			dispatcher.Backoff = time.Millisecond
+
+			ch := make(chan events.Event, 1)
+			taskOwner := &owner
+			if tt.owner != nil {
+				taskOwner = tt.owner
+			}
+			ch <- events.Event{Type: tt.event, Task: models.Task{ID: 1, OwnerID: taskOwner}}
+			close(ch)
+			dispatcher.Run(context.Background(), ch)
+
+			var statuses []int
+			for i, delivery := range store.deliveries {
+				statuses = append(statuses, delivery.StatusCode)
+				if delivery.Attempt != i+1 || delivery.Delivery != store.deliveries[0].Delivery {
+					t.Errorf("delivery %d = %+v", i, delivery)
+				}
+			}
+			if len(statuses) != len(tt.wantStatuses) {
+				t.Fatalf("delivery statuses = %+v, want %+v", statuses, tt.wantStatuses)
+			}
+			for i := range statuses {
+				if statuses[i] != tt.wantStatuses[i] {
+					t.Errorf("delivery statuses = %+v, want %+v", statuses, tt.wantStatuses)
+				}
+			}
+		})
+	}
+}